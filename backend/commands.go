@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"github.com/aliBordbar1992/musicstream-backend/internal/repositories"
+	"github.com/aliBordbar1992/musicstream-backend/internal/services"
+	"gorm.io/gorm"
+)
+
+// loudnessBatchSize is the number of tracks backfill-loudness loads at once
+const loudnessBatchSize = 100
+
+// commands are the maintenance tasks that can be run instead of the server,
+// e.g. "musicstream-backend backfill-loudness"
+var commands = map[string]func(db *gorm.DB, storage domain.Storage) error{
+	"backfill-loudness":   backfillLoudness,
+	"backfill-file-sizes": backfillStoredFileSizes,
+}
+
+// runCommand runs the named maintenance command
+func runCommand(name string, db *gorm.DB, storage domain.Storage) error {
+	command, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command %q", name)
+	}
+	return command(db, storage)
+}
+
+// backfillLoudness measures the loudness of the tracks uploaded before
+// loudness analysis existed, then updates the gains of their albums
+func backfillLoudness(db *gorm.DB, storage domain.Storage) error {
+	musicRepo := repositories.NewMusicRepository(db)
+	fileService := services.NewFileService()
+
+	albums := make(map[uint]bool)
+	var afterID uint
+	analyzed, failed := 0, 0
+	for {
+		tracks, err := musicRepo.FindUnanalyzed(afterID, loudnessBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(tracks) == 0 {
+			break
+		}
+
+		for _, music := range tracks {
+			afterID = music.ID
+
+			analysis, err := analyzeStoredAudio(storage, music.FilePath, fileService)
+			if err != nil {
+				// Broken files are skipped so one track cannot stop the backfill
+				log.Printf("Failed to analyze loudness of music %d: %v", music.ID, err)
+				failed++
+				continue
+			}
+			if err := musicRepo.UpdateLoudness(music.ID, analysis); err != nil {
+				return err
+			}
+			if music.AlbumID != nil {
+				albums[*music.AlbumID] = true
+			}
+			analyzed++
+		}
+	}
+
+	for albumID := range albums {
+		if err := musicRepo.UpdateAlbumGain(albumID); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Analyzed loudness of %d tracks, %d failed", analyzed, failed)
+	return nil
+}
+
+// analyzeStoredAudio copies an audio file out of storage so it can be decoded
+// and measures its loudness
+func analyzeStoredAudio(storage domain.Storage, key string, fileService services.FileService) (*domain.LoudnessAnalysis, error) {
+	object, _, err := storage.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	file, err := os.CreateTemp("", "loudness-*"+path.Ext(key))
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if _, err := io.Copy(file, object); err != nil {
+		return nil, err
+	}
+	return fileService.AnalyzeLoudness(file.Name())
+}
+
+// backfillStoredFileSizes sets the size of tracks uploaded before audio files
+// were shared, which the startup backfill cannot copy from a shared file
+func backfillStoredFileSizes(db *gorm.DB, storage domain.Storage) error {
+	var tracks []*domain.Music
+	updated, failed := 0, 0
+	err := db.Where("blob_id IS NULL AND file_size = 0").
+		FindInBatches(&tracks, loudnessBatchSize, func(tx *gorm.DB, batch int) error {
+			for _, music := range tracks {
+				info, err := storage.Stat(music.FilePath)
+				if err != nil {
+					log.Printf("Failed to get size of music %d: %v", music.ID, err)
+					failed++
+					continue
+				}
+				if err := db.Model(music).UpdateColumn("file_size", info.Size).Error; err != nil {
+					return err
+				}
+				updated++
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Updated the size of %d tracks, %d failed", updated, failed)
+	return nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"github.com/aliBordbar1992/musicstream-backend/internal/services"
+)
+
+// getEnvString reads a string from the environment, falling back to the
+// default when unset
+func getEnvString(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getEnvDuration reads a duration (e.g. "15m") from the environment,
+// falling back to the default when unset or invalid
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration %q for %s, using default %s", value, key, fallback)
+		return fallback
+	}
+	return duration
+}
+
+// getEnvInt reads an integer from the environment, falling back to the
+// default when unset or invalid
+func getEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid integer %q for %s, using default %d", value, key, fallback)
+		return fallback
+	}
+	return n
+}
+
+// getEnvBool reads a boolean (e.g. "true") from the environment, falling
+// back to the default when unset or invalid
+func getEnvBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid boolean %q for %s, using default %t", value, key, fallback)
+		return fallback
+	}
+	return b
+}
+
+// openStorage creates the file storage selected by STORAGE_DRIVER, "local"
+// (the default) or "s3"
+func openStorage() (domain.Storage, error) {
+	switch driver := os.Getenv("STORAGE_DRIVER"); driver {
+	case "", "local":
+		return services.NewLocalStorage(getEnvString("LOCAL_STORAGE_DIR", "uploads")), nil
+	case "s3":
+		return services.NewS3Storage(services.S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Region:    os.Getenv("S3_REGION"),
+			UseSSL:    getEnvBool("S3_USE_SSL", true),
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", driver)
+	}
+}
+
+// getEnvList reads a comma separated list from the environment, skipping
+// blank entries
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvPrefixes reads a comma separated list of networks (e.g.
+// "10.1.0.0/16") from the environment. Unlike the other helpers it fails on
+// invalid values, since a mistyped network would silently weaken the policy
+func getEnvPrefixes(key string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range getEnvList(key) {
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q for %s: %w", item, key, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// openRemoteFetcher creates the fetcher used to import music from URLs. By
+// default any public host may be fetched; FETCH_ALLOWED_HOSTS and
+// FETCH_DENIED_HOSTS restrict hosts and FETCH_ALLOWED_NETWORKS exempts
+// internal networks from the blocked ranges
+func openRemoteFetcher() (domain.RemoteFetcher, error) {
+	policy := services.FetchPolicy{
+		AllowedHosts: getEnvList("FETCH_ALLOWED_HOSTS"),
+		DeniedHosts:  getEnvList("FETCH_DENIED_HOSTS"),
+		MaxRedirects: getEnvInt("FETCH_MAX_REDIRECTS", services.DefaultFetchMaxRedirects),
+		MaxSize:      int64(getEnvInt("FETCH_MAX_SIZE", int(services.DefaultFetchMaxSize))),
+	}
+
+	var err error
+	if policy.AllowedNetworks, err = getEnvPrefixes("FETCH_ALLOWED_NETWORKS"); err != nil {
+		return nil, err
+	}
+	if policy.DeniedNetworks, err = getEnvPrefixes("FETCH_DENIED_NETWORKS"); err != nil {
+		return nil, err
+	}
+	return services.NewRemoteFetcher(policy), nil
+}
+
+// loadQuotas returns the upload quota of every role. The defaults can be
+// overridden per role, e.g. QUOTA_UPLOADER_MAX_BYTES, QUOTA_UPLOADER_MAX_TRACKS,
+// QUOTA_UPLOADER_MAX_FILE_SIZE and QUOTA_UPLOADER_MAX_DURATION ("3h"). Zero
+// removes a limit
+func loadQuotas() map[domain.Role]domain.Quota {
+	quotas := make(map[domain.Role]domain.Quota)
+	for _, role := range []domain.Role{domain.RoleAdmin, domain.RoleModerator, domain.RoleUploader, domain.RoleListener} {
+		quota := services.DefaultQuotas[role]
+		prefix := "QUOTA_" + strings.ToUpper(string(role)) + "_"
+		quota.MaxBytes = int64(getEnvInt(prefix+"MAX_BYTES", int(quota.MaxBytes)))
+		quota.MaxTracks = int64(getEnvInt(prefix+"MAX_TRACKS", int(quota.MaxTracks)))
+		quota.MaxFileSize = int64(getEnvInt(prefix+"MAX_FILE_SIZE", int(quota.MaxFileSize)))
+		maxDuration := time.Duration(quota.MaxDuration * float64(time.Second))
+		quota.MaxDuration = getEnvDuration(prefix+"MAX_DURATION", maxDuration).Seconds()
+		quotas[role] = quota
+	}
+	return quotas
+}
+
+// streamURLSecret returns the key stream URLs are signed with. Without
+// STREAM_URL_SECRET it is derived from JWT_SECRET, so the two never share a
+// key
+func streamURLSecret() string {
+	if secret := os.Getenv("STREAM_URL_SECRET"); secret != "" {
+		return secret
+	}
+	mac := hmac.New(sha256.New, []byte(os.Getenv("JWT_SECRET")))
+	mac.Write([]byte("stream-url"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type AdminController struct {
+	adminService  domain.AdminService
+	artistService domain.ArtistService
+}
+
+// NewAdminController creates a new instance of AdminController
+func NewAdminController(adminService domain.AdminService, artistService domain.ArtistService) *AdminController {
+	return &AdminController{
+		adminService:  adminService,
+		artistService: artistService,
+	}
+}
+
+// ListUsers handles listing all users
+func (c *AdminController) ListUsers(ctx *gin.Context) {
+	users, err := c.adminService.ListUsers()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, users)
+}
+
+// SetUserRole handles changing the role of a user
+func (c *AdminController) SetUserRole(ctx *gin.Context) {
+	var req struct {
+		Role domain.Role `json:"role" binding:"required"`
+	}
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if err := c.adminService.SetUserRole(actorFromContext(ctx), ctx.Param("username"), req.Role); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "User role updated successfully"})
+}
+
+// DisableUser handles disabling a user account
+func (c *AdminController) DisableUser(ctx *gin.Context) {
+	if err := c.adminService.SetUserDisabled(actorFromContext(ctx), ctx.Param("username"), true); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "User disabled successfully"})
+}
+
+// EnableUser handles re-enabling a disabled user account
+func (c *AdminController) EnableUser(ctx *gin.Context) {
+	if err := c.adminService.SetUserDisabled(actorFromContext(ctx), ctx.Param("username"), false); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "User enabled successfully"})
+}
+
+// MergeArtists handles merging duplicate artists into a canonical artist
+func (c *AdminController) MergeArtists(ctx *gin.Context) {
+	var req struct {
+		CanonicalID  uint   `json:"canonical_id" binding:"required"`
+		DuplicateIDs []uint `json:"duplicate_ids" binding:"required"`
+	}
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	artist, err := c.artistService.MergeArtists(req.CanonicalID, req.DuplicateIDs)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Artists merged successfully",
+		"artist":  artist,
+	})
+}
+
+// GetStats handles getting system statistics
+func (c *AdminController) GetStats(ctx *gin.Context) {
+	stats, err := c.adminService.GetSystemStats()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stats"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, stats)
+}
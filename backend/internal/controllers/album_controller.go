@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type AlbumController struct {
+	service domain.AlbumService
+}
+
+// NewAlbumController creates a new instance of AlbumController
+func NewAlbumController(service domain.AlbumService) *AlbumController {
+	return &AlbumController{service: service}
+}
+
+// ListAlbums handles listing all albums, optionally filtered by a title query
+func (c *AlbumController) ListAlbums(ctx *gin.Context) {
+	albums, err := c.service.ListAlbums(ctx.Query("query"), pageRequestFromQuery(ctx))
+	if err != nil {
+		respondListError(ctx, err, "Failed to fetch albums")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, albums)
+}
+
+// GetAlbum handles getting an album with its tracklist
+func (c *AlbumController) GetAlbum(ctx *gin.Context) {
+	album, err := c.service.GetAlbum(parseUint(ctx.Param("id")))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, album)
+}
+
+// GetArtistAlbums handles listing the albums of an artist
+func (c *AlbumController) GetArtistAlbums(ctx *gin.Context) {
+	albums, err := c.service.GetArtistAlbums(parseUint(ctx.Param("id")))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch albums"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, albums)
+}
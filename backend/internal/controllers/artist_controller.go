@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
@@ -8,11 +9,96 @@ import (
 )
 
 type ArtistController struct {
-	service domain.ArtistService
+	service         domain.ArtistService
+	musicService    domain.MusicService
+	albumService    domain.AlbumService
+	listenerService domain.ListenerService
 }
 
-func NewArtistController(service domain.ArtistService) *ArtistController {
-	return &ArtistController{service: service}
+func NewArtistController(
+	service domain.ArtistService,
+	musicService domain.MusicService,
+	albumService domain.AlbumService,
+	listenerService domain.ListenerService,
+) *ArtistController {
+	return &ArtistController{
+		service:         service,
+		musicService:    musicService,
+		albumService:    albumService,
+		listenerService: listenerService,
+	}
+}
+
+// GetArtist handles getting an artist page with its tracks, albums and the
+// number of users currently listening to each track
+func (c *ArtistController) GetArtist(ctx *gin.Context) {
+	artist, err := c.service.GetArtist(parseUint(ctx.Param("id")))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Artist not found"})
+		return
+	}
+
+	tracks, err := c.musicService.GetMusicByArtist(artist.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tracks"})
+		return
+	}
+
+	albums, err := c.albumService.GetArtistAlbums(artist.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch albums"})
+		return
+	}
+
+	// Tracks nobody listens to have no listeners entry in the cache
+	listeners := 0
+	trackListeners := make(map[uint]int, len(tracks))
+	for _, track := range tracks {
+		current, err := c.listenerService.GetCurrentListeners(track.ID)
+		if err != nil {
+			continue
+		}
+		trackListeners[track.ID] = len(current)
+		listeners += len(current)
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"artist":          artist,
+		"tracks":          tracks,
+		"albums":          albums,
+		"listeners":       listeners,
+		"track_listeners": trackListeners,
+	})
+}
+
+// UpdateArtist handles updating the name, bio and image of an artist
+func (c *ArtistController) UpdateArtist(ctx *gin.Context) {
+	var input struct {
+		Name  *string `json:"name"`
+		Bio   *string `json:"bio"`
+		Image *string `json:"image"`
+	}
+
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	artist, err := c.service.UpdateArtist(parseUint(ctx.Param("id")), domain.ArtistUpdate{
+		Name:  input.Name,
+		Bio:   input.Bio,
+		Image: input.Image,
+	})
+	if errors.Is(err, domain.ErrArtistNameTaken) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, artist)
 }
 
 func (c *ArtistController) SearchArtists(ctx *gin.Context) {
@@ -22,9 +108,9 @@ func (c *ArtistController) SearchArtists(ctx *gin.Context) {
 		return
 	}
 
-	artists, err := c.service.SearchArtists(query)
+	artists, err := c.service.SearchArtists(query, pageRequestFromQuery(ctx))
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search artists"})
+		respondListError(ctx, err, "Failed to search artists")
 		return
 	}
 
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+const defaultArtworkSize = 512
+
+type ArtworkController struct {
+	artworkService domain.ArtworkService
+}
+
+// NewArtworkController creates a new instance of ArtworkController
+func NewArtworkController(artworkService domain.ArtworkService) *ArtworkController {
+	return &ArtworkController{artworkService: artworkService}
+}
+
+// GetMusicCover handles serving the cover art of a track
+func (c *ArtworkController) GetMusicCover(ctx *gin.Context) {
+	cover, err := c.artworkService.GetMusicCover(uint(parseUint(ctx.Param("id"))), artworkSizeFromQuery(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Music not found"})
+		return
+	}
+
+	serveArtwork(ctx, cover)
+}
+
+// GetAlbumCover handles serving the cover art of an album
+func (c *ArtworkController) GetAlbumCover(ctx *gin.Context) {
+	cover, err := c.artworkService.GetAlbumCover(uint(parseUint(ctx.Param("id"))), artworkSizeFromQuery(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
+		return
+	}
+
+	serveArtwork(ctx, cover)
+}
+
+// GetArtistImage handles serving the picture of an artist
+func (c *ArtworkController) GetArtistImage(ctx *gin.Context) {
+	image, err := c.artworkService.GetArtistImage(uint(parseUint(ctx.Param("id"))), artworkSizeFromQuery(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Artist not found"})
+		return
+	}
+
+	serveArtwork(ctx, image)
+}
+
+// artworkSizeFromQuery reads the requested size from the "size" query parameter
+func artworkSizeFromQuery(ctx *gin.Context) int {
+	size, err := strconv.Atoi(ctx.Query("size"))
+	if err != nil || size <= 0 {
+		return defaultArtworkSize
+	}
+	return size
+}
+
+// serveArtwork writes an image with caching headers, answering conditional
+// requests with 304 Not Modified
+func serveArtwork(ctx *gin.Context, artwork *domain.ArtworkImage) {
+	// Real artwork rarely changes; placeholders may be replaced by real artwork later
+	if artwork.Placeholder {
+		ctx.Header("Cache-Control", "public, max-age=3600")
+	} else {
+		ctx.Header("Cache-Control", "public, max-age=86400")
+	}
+	ctx.Header("ETag", artwork.ETag)
+
+	if ctx.GetHeader("If-None-Match") == artwork.ETag {
+		ctx.Status(http.StatusNotModified)
+		return
+	}
+
+	ctx.Data(http.StatusOK, artwork.MimeType, artwork.Data)
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type HLSController struct {
+	musicService domain.MusicService
+	hlsService   domain.HLSService
+	streamSigner domain.StreamSigner
+}
+
+// NewHLSController creates a new instance of HLSController
+func NewHLSController(musicService domain.MusicService, hlsService domain.HLSService, streamSigner domain.StreamSigner) *HLSController {
+	return &HLSController{
+		musicService: musicService,
+		hlsService:   hlsService,
+		streamSigner: streamSigner,
+	}
+}
+
+// GetPlaylist handles serving the HLS media playlist of a track
+func (c *HLSController) GetPlaylist(ctx *gin.Context) {
+	music, err := c.musicService.GetMusic(uint(parseUint(ctx.Param("id"))))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Music not found"})
+		return
+	}
+
+	// Native players cannot send credentials with segment requests, so each
+	// segment URI carries a stream signature instead
+	signed := c.streamSigner.Sign(music.ID, ctx.GetString("username"), ctx.ClientIP())
+	_, segmentQuery, _ := strings.Cut(signed.URL, "?")
+
+	playlist, err := c.hlsService.GetPlaylist(music, segmentQuery)
+	if err != nil {
+		respondHLSError(ctx, err)
+		return
+	}
+
+	// Players fetch the playlist once per playback
+	if err := c.musicService.RecordPlay(music.ID); err != nil {
+		log.Printf("Failed to record play of music %d: %v", music.ID, err)
+	}
+
+	ctx.Header("Cache-Control", "private, no-cache")
+	ctx.Data(http.StatusOK, "application/vnd.apple.mpegurl", playlist)
+}
+
+// GetSegment handles serving a segment of a track, e.g. "3.mp3". Requests
+// must carry the signature the playlist added to the segment URI
+func (c *HLSController) GetSegment(ctx *gin.Context) {
+	id := uint(parseUint(ctx.Param("id")))
+	if _, err := c.streamSigner.Verify(id, ctx.Request.URL.Query(), ctx.ClientIP()); err != nil {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	index, err := strconv.Atoi(strings.TrimSuffix(ctx.Param("segment"), ".mp3"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Segment not found"})
+		return
+	}
+
+	music, err := c.musicService.GetMusic(id)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Music not found"})
+		return
+	}
+
+	segment, info, err := c.hlsService.GetSegment(music, index)
+	if err != nil {
+		respondHLSError(ctx, err)
+		return
+	}
+	defer segment.Close()
+
+	// Segments never change once cut
+	ctx.Header("Cache-Control", "private, max-age=86400, immutable")
+	ctx.DataFromReader(http.StatusOK, info.Size, "audio/mpeg", segment, nil)
+}
+
+func respondHLSError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, domain.ErrHLSUnsupported):
+		ctx.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrObjectNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Segment not found"})
+	default:
+		log.Printf("Failed to package HLS: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to package stream"})
+	}
+}
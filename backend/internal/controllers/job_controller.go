@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type JobController struct {
+	jobService domain.JobService
+}
+
+// NewJobController creates a new instance of JobController
+func NewJobController(jobService domain.JobService) *JobController {
+	return &JobController{jobService: jobService}
+}
+
+// GetJob handles getting the state of a background job
+func (c *JobController) GetJob(ctx *gin.Context) {
+	job, err := c.jobService.GetJob(uint(parseUint(ctx.Param("id"))), actorFromContext(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, job)
+}
+
+// CancelJob handles canceling a queued or running job
+func (c *JobController) CancelJob(ctx *gin.Context) {
+	job, err := c.jobService.CancelJob(uint(parseUint(ctx.Param("id"))), actorFromContext(ctx))
+	switch {
+	case errors.Is(err, domain.ErrJobNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+	case errors.Is(err, domain.ErrJobFinished):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel job"})
+	default:
+		ctx.JSON(http.StatusOK, job)
+	}
+}
+
+// respondJobAccepted answers a request whose work was queued as a job. The
+// job can be followed at /jobs/:id and over the WebSocket
+func respondJobAccepted(ctx *gin.Context, message string, job *domain.Job) {
+	ctx.Header("Location", fmt.Sprintf("/jobs/%d", job.ID))
+	ctx.JSON(http.StatusAccepted, gin.H{
+		"message": message,
+		"job":     job,
+	})
+}
@@ -1,8 +1,11 @@
 package controllers
 
 import (
+	"errors"
+	"log"
 	"net/http"
-	"os"
+	"path"
+	"strings"
 
 	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
 	"github.com/aliBordbar1992/musicstream-backend/internal/services"
@@ -14,31 +17,48 @@ const maxChunkSize int64 = 64 * 1024 // 64 KB for testing
 type MusicController struct {
 	musicService  domain.MusicService
 	uploadService services.UploadService
-	linkValidator domain.LinkValidator
+	streamSigner  domain.StreamSigner
 }
 
 // NewMusicController creates a new instance of MusicController
-func NewMusicController(musicService domain.MusicService, uploadService services.UploadService, linkValidator domain.LinkValidator) *MusicController {
+func NewMusicController(musicService domain.MusicService, uploadService services.UploadService, streamSigner domain.StreamSigner) *MusicController {
 	return &MusicController{
 		musicService:  musicService,
 		uploadService: uploadService,
-		linkValidator: linkValidator,
+		streamSigner:  streamSigner,
 	}
 }
 
 // UploadMusic handles music file upload
 func (c *MusicController) UploadMusic(ctx *gin.Context) {
 	fileService := services.NewFileService()
-	music, err := c.uploadService.HandleMusicUpload(ctx, fileService, c.musicService)
+	job, err := c.uploadService.HandleMusicUpload(ctx, fileService)
 	if err != nil {
+		if status, ok := uploadLimitStatus(err); ok {
+			ctx.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{
-		"message": "Music uploaded successfully",
-		"music":   music,
-	})
+	respondJobAccepted(ctx, "Music upload queued", job)
+}
+
+// ImportMusic handles importing a ZIP archive of tracks and playlists
+func (c *MusicController) ImportMusic(ctx *gin.Context) {
+	fileService := services.NewFileService()
+	job, err := c.uploadService.HandleImport(ctx, fileService)
+	if err != nil {
+		if status, ok := uploadLimitStatus(err); ok {
+			ctx.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondJobAccepted(ctx, "Music import queued", job)
 }
 
 // GetMusic handles getting music by ID
@@ -65,33 +85,70 @@ func (c *MusicController) GetMusic(ctx *gin.Context) {
 	ctx.File(music.FilePath)
 } */
 
-// StreamMusic streams a music file with byte-range support (for HTTP/1.1 and HTTP/2)
+// GetStreamURL handles issuing a signed URL the track can be streamed from
+func (c *MusicController) GetStreamURL(ctx *gin.Context) {
+	music, err := c.musicService.GetMusic(uint(parseUint(ctx.Param("id"))))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Music not found"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, c.streamSigner.Sign(music.ID, ctx.GetString("username"), ctx.ClientIP()))
+}
+
+// StreamMusic streams a music file with byte-range support (for HTTP/1.1 and HTTP/2).
+// Requests must carry the signature of a URL issued by GetStreamURL
 func (c *MusicController) StreamMusic(ctx *gin.Context) {
-	id := ctx.Param("id")
-	music, err := c.musicService.GetMusic(uint(parseUint(id)))
+	id := uint(parseUint(ctx.Param("id")))
+	if _, err := c.streamSigner.Verify(id, ctx.Request.URL.Query(), ctx.ClientIP()); err != nil {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	music, err := c.musicService.GetMusic(id)
 	if err != nil {
 		ctx.JSON(http.StatusNotFound, gin.H{"error": "Music not found"})
 		return
 	}
 
-	file, err := os.Open(music.FilePath)
+	file, info, err := c.musicService.OpenAudio(music)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "File open error"})
 		return
 	}
-	stat, _ := file.Stat()
+	defer file.Close()
 
-	ctx.Header("Content-Type", "audio/mpeg")
+	// Count a play when playback starts rather than on every range request
+	if rangeHeader := ctx.GetHeader("Range"); rangeHeader == "" || strings.HasPrefix(rangeHeader, "bytes=0-") {
+		if err := c.musicService.RecordPlay(music.ID); err != nil {
+			log.Printf("Failed to record play of music %d: %v", music.ID, err)
+		}
+	}
+
+	// Tracks uploaded before formats were detected rely on the storage
+	contentType := music.MimeType
+	if contentType == "" {
+		contentType = info.ContentType
+	}
+
+	ctx.Header("Content-Type", contentType)
 	ctx.Header("Accept-Ranges", "bytes")
+	ctx.Header("ETag", info.ETag)
 
-	http.ServeContent(ctx.Writer, ctx.Request, stat.Name(), stat.ModTime(), file)
+	http.ServeContent(ctx.Writer, ctx.Request, path.Base(info.Key), info.ModTime, file)
 }
 
 // ListMusic handles listing all music
 func (c *MusicController) ListMusic(ctx *gin.Context) {
-	music, err := c.musicService.ListAllMusic()
+	filter, err := musicFilterFromQuery(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	music, err := c.musicService.ListMusic(filter, pageRequestFromQuery(ctx))
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch music"})
+		respondListError(ctx, err, "Failed to fetch music")
 		return
 	}
 
@@ -99,9 +156,16 @@ func (c *MusicController) ListMusic(ctx *gin.Context) {
 }
 
 func (c *MusicController) GetUserMusic(ctx *gin.Context) {
-	music, err := c.musicService.GetUserMusic(ctx.GetString("username"))
+	filter, err := musicFilterFromQuery(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter.UploadedBy = ctx.GetString("username")
+
+	music, err := c.musicService.ListMusic(filter, pageRequestFromQuery(ctx))
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch music"})
+		respondListError(ctx, err, "Failed to fetch music")
 		return
 	}
 
@@ -110,7 +174,11 @@ func (c *MusicController) GetUserMusic(ctx *gin.Context) {
 
 func (c *MusicController) DeleteMusic(ctx *gin.Context) {
 	id := ctx.Param("id")
-	err := c.musicService.DeleteMusic(uint(parseUint(id)), ctx.GetString("username"))
+	err := c.musicService.DeleteMusic(uint(parseUint(id)), actorFromContext(ctx))
+	if errors.Is(err, domain.ErrForbidden) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete music"})
 		return
@@ -120,10 +188,16 @@ func (c *MusicController) DeleteMusic(ctx *gin.Context) {
 }
 
 func (c *MusicController) SearchMusic(ctx *gin.Context) {
-	query := ctx.Query("q")
-	music, err := c.musicService.SearchMusic(query)
+	filter, err := musicFilterFromQuery(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter.Query = ctx.Query("q")
+
+	music, err := c.musicService.ListMusic(filter, pageRequestFromQuery(ctx))
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search music"})
+		respondListError(ctx, err, "Failed to search music")
 		return
 	}
 
@@ -132,16 +206,19 @@ func (c *MusicController) SearchMusic(ctx *gin.Context) {
 
 // DownloadMusicFromURL handles downloading music from a URL
 func (c *MusicController) DownloadMusicFromURL(ctx *gin.Context) {
-	fileService := services.NewFileService()
-
-	music, err := c.uploadService.HandleMusicDownload(ctx, fileService, c.musicService)
+	job, err := c.uploadService.HandleMusicDownload(ctx)
 	if err != nil {
+		if errors.Is(err, domain.ErrURLNotAllowed) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if status, ok := uploadLimitStatus(err); ok {
+			ctx.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{
-		"message": "Music downloaded successfully",
-		"music":   music,
-	})
+	respondJobAccepted(ctx, "Music download queued", job)
 }
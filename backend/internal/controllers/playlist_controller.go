@@ -1,7 +1,13 @@
 package controllers
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"net/http"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
 	"github.com/gin-gonic/gin"
@@ -9,11 +15,21 @@ import (
 
 type PlaylistController struct {
 	playlistService domain.PlaylistService
+	exporter        domain.PlaylistExporter
+	streamSigner    domain.StreamSigner
+	publicBaseURL   string        // e.g. "https://music.example.com", derived from requests when empty
+	exportURLTTL    time.Duration // Lifetime of the stream URLs in exported playlists
 }
 
 // NewPlaylistController creates a new instance of PlaylistController
-func NewPlaylistController(playlistService domain.PlaylistService) *PlaylistController {
-	return &PlaylistController{playlistService: playlistService}
+func NewPlaylistController(playlistService domain.PlaylistService, exporter domain.PlaylistExporter, streamSigner domain.StreamSigner, publicBaseURL string, exportURLTTL time.Duration) *PlaylistController {
+	return &PlaylistController{
+		playlistService: playlistService,
+		exporter:        exporter,
+		streamSigner:    streamSigner,
+		publicBaseURL:   strings.TrimSuffix(publicBaseURL, "/"),
+		exportURLTTL:    exportURLTTL,
+	}
 }
 
 // CreatePlaylist handles playlist creation
@@ -39,9 +55,9 @@ func (c *PlaylistController) CreatePlaylist(ctx *gin.Context) {
 // GetPlaylist handles getting playlist by ID
 func (c *PlaylistController) GetPlaylist(ctx *gin.Context) {
 	id := ctx.Param("id")
-	playlist, err := c.playlistService.GetPlaylist(uint(parseUint(id)), ctx.GetString("username"))
+	playlist, err := c.playlistService.GetPlaylist(uint(parseUint(id)), actorFromContext(ctx))
 	if err != nil {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": "Playlist not found"})
+		respondPlaylistError(ctx, err, http.StatusNotFound, "Playlist not found")
 		return
 	}
 
@@ -50,9 +66,9 @@ func (c *PlaylistController) GetPlaylist(ctx *gin.Context) {
 
 // ListPlaylists handles listing user's playlists
 func (c *PlaylistController) ListPlaylists(ctx *gin.Context) {
-	playlists, err := c.playlistService.ListUserPlaylists(ctx.GetString("username"))
+	playlists, err := c.playlistService.ListUserPlaylists(ctx.GetString("username"), pageRequestFromQuery(ctx))
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch playlists"})
+		respondListError(ctx, err, "Failed to fetch playlists")
 		return
 	}
 
@@ -62,8 +78,8 @@ func (c *PlaylistController) ListPlaylists(ctx *gin.Context) {
 // DeletePlaylist handles playlist deletion
 func (c *PlaylistController) DeletePlaylist(ctx *gin.Context) {
 	id := ctx.Param("id")
-	if err := c.playlistService.DeletePlaylist(uint(parseUint(id)), ctx.GetString("username")); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := c.playlistService.DeletePlaylist(uint(parseUint(id)), actorFromContext(ctx)); err != nil {
+		respondPlaylistError(ctx, err, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -82,20 +98,24 @@ func (c *PlaylistController) AddSongToPlaylist(ctx *gin.Context) {
 	}
 
 	id := ctx.Param("id")
-	if err := c.playlistService.AddSongToPlaylist(uint(parseUint(id)), req.MusicID, ctx.GetString("username")); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	entry, err := c.playlistService.AddSongToPlaylist(uint(parseUint(id)), req.MusicID, actorFromContext(ctx))
+	if err != nil {
+		respondPlaylistError(ctx, err, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"message": "Song added to playlist successfully"})
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Song added to playlist successfully",
+		"entry":   entry,
+	})
 }
 
 // RemoveSongFromPlaylist handles removing a song from a playlist
 func (c *PlaylistController) RemoveSongFromPlaylist(ctx *gin.Context) {
 	id := ctx.Param("id")
 	musicID := ctx.Param("musicId")
-	if err := c.playlistService.RemoveSongFromPlaylist(uint(parseUint(id)), uint(parseUint(musicID)), ctx.GetString("username")); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := c.playlistService.RemoveSongFromPlaylist(uint(parseUint(id)), uint(parseUint(musicID)), actorFromContext(ctx)); err != nil {
+		respondPlaylistError(ctx, err, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -105,11 +125,268 @@ func (c *PlaylistController) RemoveSongFromPlaylist(ctx *gin.Context) {
 // GetPlaylistSongs handles getting songs from a playlist
 func (c *PlaylistController) GetPlaylistSongs(ctx *gin.Context) {
 	id := ctx.Param("id")
-	songs, err := c.playlistService.GetPlaylistSongs(uint(parseUint(id)), ctx.GetString("username"))
+	songs, err := c.playlistService.GetPlaylistSongs(uint(parseUint(id)), pageRequestFromQuery(ctx), actorFromContext(ctx))
 	if err != nil {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": "Failed to fetch playlist songs"})
+		respondPlaylistError(ctx, err, http.StatusNotFound, "Failed to fetch playlist songs")
 		return
 	}
 
 	ctx.JSON(http.StatusOK, songs)
 }
+
+// GetPlaylistEntries handles getting the entries of a playlist in order
+func (c *PlaylistController) GetPlaylistEntries(ctx *gin.Context) {
+	id := ctx.Param("id")
+	entries, err := c.playlistService.GetPlaylistEntries(uint(parseUint(id)), actorFromContext(ctx))
+	if err != nil {
+		respondPlaylistError(ctx, err, http.StatusNotFound, "Failed to fetch playlist entries")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, entries)
+}
+
+// RemovePlaylistEntry handles removing one entry from a playlist, leaving
+// other entries of the same song in place
+func (c *PlaylistController) RemovePlaylistEntry(ctx *gin.Context) {
+	id := ctx.Param("id")
+	entryID := ctx.Param("entryId")
+	if err := c.playlistService.RemovePlaylistEntry(uint(parseUint(id)), uint(parseUint(entryID)), actorFromContext(ctx)); err != nil {
+		respondPlaylistError(ctx, err, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Song removed from playlist successfully"})
+}
+
+// MovePlaylistEntry handles moving an entry to another index of a playlist,
+// responding with the entries in their new order
+func (c *PlaylistController) MovePlaylistEntry(ctx *gin.Context) {
+	var req struct {
+		Index *int `json:"index" binding:"required,min=0"`
+	}
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	id := ctx.Param("id")
+	entryID := ctx.Param("entryId")
+	entries, err := c.playlistService.MovePlaylistEntry(uint(parseUint(id)), uint(parseUint(entryID)), *req.Index, actorFromContext(ctx))
+	if err != nil {
+		respondPlaylistError(ctx, err, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, entries)
+}
+
+// ReorderPlaylistEntries handles putting every entry of a playlist in a new
+// order at once, responding with the entries in their new order
+func (c *PlaylistController) ReorderPlaylistEntries(ctx *gin.Context) {
+	var req struct {
+		EntryIDs []uint `json:"entry_ids" binding:"required"`
+	}
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	id := ctx.Param("id")
+	entries, err := c.playlistService.ReorderPlaylistEntries(uint(parseUint(id)), req.EntryIDs, actorFromContext(ctx))
+	if err != nil {
+		respondPlaylistError(ctx, err, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, entries)
+}
+
+// ListMembers handles listing the members and pending invitations of a
+// playlist
+func (c *PlaylistController) ListMembers(ctx *gin.Context) {
+	id := ctx.Param("id")
+	members, err := c.playlistService.ListMembers(uint(parseUint(id)), actorFromContext(ctx))
+	if err != nil {
+		respondPlaylistError(ctx, err, http.StatusNotFound, "Failed to fetch playlist members")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, members)
+}
+
+// InviteMember handles inviting a user to a playlist with a role
+func (c *PlaylistController) InviteMember(ctx *gin.Context) {
+	var req struct {
+		Username string              `json:"username" binding:"required"`
+		Role     domain.PlaylistRole `json:"role" binding:"required"`
+	}
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	id := ctx.Param("id")
+	member, err := c.playlistService.InviteMember(uint(parseUint(id)), req.Username, req.Role, actorFromContext(ctx))
+	if err != nil {
+		respondPlaylistError(ctx, err, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, member)
+}
+
+// UpdateMember handles changing the role of a member
+func (c *PlaylistController) UpdateMember(ctx *gin.Context) {
+	var req struct {
+		Role domain.PlaylistRole `json:"role" binding:"required"`
+	}
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	id := ctx.Param("id")
+	member, err := c.playlistService.UpdateMemberRole(uint(parseUint(id)), ctx.Param("username"), req.Role, actorFromContext(ctx))
+	if err != nil {
+		respondPlaylistError(ctx, err, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, member)
+}
+
+// RemoveMember handles removing a member or canceling an invitation
+func (c *PlaylistController) RemoveMember(ctx *gin.Context) {
+	id := ctx.Param("id")
+	if err := c.playlistService.RemoveMember(uint(parseUint(id)), ctx.Param("username"), actorFromContext(ctx)); err != nil {
+		respondPlaylistError(ctx, err, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Member removed from playlist successfully"})
+}
+
+// AcceptInvitation handles accepting an invitation to a playlist
+func (c *PlaylistController) AcceptInvitation(ctx *gin.Context) {
+	id := ctx.Param("id")
+	member, err := c.playlistService.AcceptInvitation(uint(parseUint(id)), actorFromContext(ctx))
+	if err != nil {
+		respondPlaylistError(ctx, err, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, member)
+}
+
+// LeavePlaylist handles leaving a playlist or declining an invitation to it
+func (c *PlaylistController) LeavePlaylist(ctx *gin.Context) {
+	id := ctx.Param("id")
+	actor := actorFromContext(ctx)
+	if err := c.playlistService.RemoveMember(uint(parseUint(id)), actor.Username, actor); err != nil {
+		respondPlaylistError(ctx, err, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Left playlist successfully"})
+}
+
+// ListInvitations handles listing the pending playlist invitations of the
+// current user
+func (c *PlaylistController) ListInvitations(ctx *gin.Context) {
+	invitations, err := c.playlistService.ListInvitations(ctx.GetString("username"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invitations"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, invitations)
+}
+
+// respondPlaylistError writes the error of a playlist request. Errors the
+// client can act on are reported as they are, others with the given status
+// and message. A stale order is a conflict, the client should reload
+func respondPlaylistError(ctx *gin.Context, err error, status int, message string) {
+	switch {
+	case errors.Is(err, domain.ErrForbidden):
+		status = http.StatusForbidden
+	case errors.Is(err, domain.ErrPlaylistEntryNotFound),
+		errors.Is(err, domain.ErrPlaylistMemberNotFound),
+		errors.Is(err, domain.ErrInviteeNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, domain.ErrInvalidPlaylistOrder),
+		errors.Is(err, domain.ErrPlaylistMemberExists):
+		status = http.StatusConflict
+	case errors.Is(err, domain.ErrInvalidPlaylistRole),
+		errors.Is(err, domain.ErrInvalidPlaylistInvite),
+		errors.Is(err, domain.ErrInvalidCursor),
+		errors.Is(err, domain.ErrInvalidSort):
+		status = http.StatusBadRequest
+	default:
+		ctx.JSON(status, gin.H{"error": message})
+		return
+	}
+	ctx.JSON(status, gin.H{"error": err.Error()})
+}
+
+// unsafeFilenameChars are replaced in the names of downloaded files
+var unsafeFilenameChars = regexp.MustCompile(`[^\pL\pN ._-]+`)
+
+// ExportPlaylist handles downloading a playlist as M3U8, XSPF or JSPF. Songs
+// are located by absolute signed stream URLs so other players can open them
+func (c *PlaylistController) ExportPlaylist(ctx *gin.Context) {
+	format := ctx.DefaultQuery("format", domain.PlaylistFormatM3U8)
+	mediaType, extension, err := c.exporter.ContentType(format)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	actor := actorFromContext(ctx)
+	id := uint(parseUint(ctx.Param("id")))
+	// Only members of a playlist can get it, with its songs in order
+	playlist, err := c.playlistService.GetPlaylist(id, actor)
+	if err != nil {
+		respondPlaylistError(ctx, err, http.StatusNotFound, "Playlist not found")
+		return
+	}
+
+	baseURL := c.baseURL(ctx)
+	locate := func(song *domain.Music) string {
+		return baseURL + c.streamSigner.SignFor(song.ID, actor.Username, ctx.ClientIP(), c.exportURLTTL).URL
+	}
+
+	var buf bytes.Buffer
+	if err := c.exporter.Export(&buf, format, playlist, playlist.Songs, locate); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export playlist"})
+		return
+	}
+
+	filename := strings.TrimSpace(unsafeFilenameChars.ReplaceAllString(playlist.Name, "_"))
+	if filename == "" {
+		filename = fmt.Sprintf("playlist-%d", playlist.ID)
+	}
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s%s"`, filename, extension))
+	ctx.Header("Cache-Control", "private, no-store")
+	ctx.Data(http.StatusOK, mediaType, buf.Bytes())
+}
+
+// baseURL returns the absolute URL the API is reached at
+func (c *PlaylistController) baseURL(ctx *gin.Context) string {
+	if c.publicBaseURL != "" {
+		return c.publicBaseURL
+	}
+
+	scheme := "http"
+	if ctx.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := ctx.GetHeader("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	return scheme + "://" + ctx.Request.Host
+}
@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type QuotaController struct {
+	quotaService domain.QuotaService
+}
+
+// NewQuotaController creates a new instance of QuotaController
+func NewQuotaController(quotaService domain.QuotaService) *QuotaController {
+	return &QuotaController{quotaService: quotaService}
+}
+
+// GetUsage handles getting what the current user's uploads consume and the
+// quota of their role
+func (c *QuotaController) GetUsage(ctx *gin.Context) {
+	usage, err := c.quotaService.GetUsage(ctx.GetString("username"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get usage"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, usage)
+}
+
+// uploadLimitStatus returns the status for an upload rejected by a quota or
+// size limit, or false for other errors
+func uploadLimitStatus(err error) (int, bool) {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, domain.ErrFileTooLarge), errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge, true
+	case errors.Is(err, domain.ErrQuotaExceeded):
+		return http.StatusForbidden, true
+	case errors.Is(err, domain.ErrTrackTooLong):
+		return http.StatusBadRequest, true
+	}
+	return 0, false
+}
@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type SearchController struct {
+	service domain.SearchService
+}
+
+// NewSearchController creates a new instance of SearchController
+func NewSearchController(service domain.SearchService) *SearchController {
+	return &SearchController{service: service}
+}
+
+// Search handles searching tracks, artists, albums and playlists at once.
+// The optional "types" parameter limits the result types, e.g. "tracks,artists"
+func (c *SearchController) Search(ctx *gin.Context) {
+	text := strings.TrimSpace(ctx.Query("q"))
+	if text == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter is required"})
+		return
+	}
+
+	var types []string
+	if param := ctx.Query("types"); param != "" {
+		for _, searchType := range strings.Split(param, ",") {
+			searchType = strings.TrimSpace(searchType)
+			if !isSearchType(searchType) {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid search type: " + searchType})
+				return
+			}
+			types = append(types, searchType)
+		}
+	}
+
+	limit, _ := strconv.Atoi(ctx.Query("limit"))
+
+	results, err := c.service.Search(domain.SearchQuery{
+		Text:     text,
+		Types:    types,
+		Username: ctx.GetString("username"),
+		Limit:    limit,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, results)
+}
+
+func isSearchType(searchType string) bool {
+	for _, t := range domain.SearchTypes {
+		if t == searchType {
+			return true
+		}
+	}
+	return false
+}
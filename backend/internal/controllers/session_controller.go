@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type SessionController struct {
+	sessionService domain.SessionService
+}
+
+// NewSessionController creates a new instance of SessionController
+func NewSessionController(sessionService domain.SessionService) *SessionController {
+	return &SessionController{sessionService: sessionService}
+}
+
+// Refresh exchanges a refresh token for a new token pair
+func (c *SessionController) Refresh(ctx *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	tokens, err := c.sessionService.RefreshSession(req.RefreshToken, ctx.Request.UserAgent(), ctx.ClientIP())
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+// Logout revokes the session of the current access token
+func (c *SessionController) Logout(ctx *gin.Context) {
+	if err := c.sessionService.RevokeSession(ctx.GetString("session_id"), ctx.GetString("username")); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// LogoutAll revokes every session of the current user
+func (c *SessionController) LogoutAll(ctx *gin.Context) {
+	if err := c.sessionService.RevokeAllSessions(ctx.GetString("username")); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout from all devices"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Logged out from all devices successfully"})
+}
+
+// ListSessions lists the active sessions (devices) of the current user
+func (c *SessionController) ListSessions(ctx *gin.Context) {
+	sessions, err := c.sessionService.ListSessions(ctx.GetString("username"), ctx.GetString("session_id"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession revokes one of the current user's sessions
+func (c *SessionController) RevokeSession(ctx *gin.Context) {
+	err := c.sessionService.RevokeSession(ctx.Param("id"), ctx.GetString("username"))
+	if errors.Is(err, domain.ErrSessionNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
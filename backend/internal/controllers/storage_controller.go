@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"github.com/aliBordbar1992/musicstream-backend/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// signedUploadURLExpiry is how long redirects to signed storage URLs are valid
+const signedUploadURLExpiry = 15 * time.Minute
+
+// publicUploadPrefixes are the storage prefixes served without authentication
+var publicUploadPrefixes = []string{"profile_pictures/"}
+
+type StorageController struct {
+	storage domain.Storage
+}
+
+// NewStorageController creates a new instance of StorageController
+func NewStorageController(storage domain.Storage) *StorageController {
+	return &StorageController{storage: storage}
+}
+
+// ServeUpload handles serving public uploads such as profile pictures.
+// Storage backends that support signed URLs serve the file themselves
+func (c *StorageController) ServeUpload(ctx *gin.Context) {
+	key := strings.TrimPrefix(path.Clean(ctx.Param("key")), "/")
+	if !isPublicUpload(key) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	info, err := c.storage.Stat(key)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	if url, err := c.storage.SignedURL(key, signedUploadURLExpiry); err == nil {
+		ctx.Redirect(http.StatusFound, url)
+		return
+	}
+
+	file := services.NewStorageReader(c.storage, info)
+	defer file.Close()
+
+	ctx.Header("Content-Type", info.ContentType)
+	ctx.Header("ETag", info.ETag)
+	http.ServeContent(ctx.Writer, ctx.Request, path.Base(key), info.ModTime, file)
+}
+
+func isPublicUpload(key string) bool {
+	for _, prefix := range publicUploadPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
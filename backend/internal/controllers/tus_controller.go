@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// tusExtensions are the tus protocol extensions supported
+const tusExtensions = "creation,termination,expiration"
+
+// TusController implements the tus resumable upload protocol for music
+// uploads, see https://tus.io/protocols/resumable-upload
+type TusController struct {
+	tusService domain.TusService
+}
+
+// NewTusController creates a new instance of TusController
+func NewTusController(tusService domain.TusService) *TusController {
+	return &TusController{tusService: tusService}
+}
+
+// RequireTusVersion rejects requests made with another version of the
+// protocol. Every response carries the version supported
+func (c *TusController) RequireTusVersion(ctx *gin.Context) {
+	ctx.Header("Tus-Resumable", domain.TusVersion)
+	if ctx.Request.Method == http.MethodOptions {
+		ctx.Next()
+		return
+	}
+
+	if ctx.GetHeader("Tus-Resumable") != domain.TusVersion {
+		ctx.Header("Tus-Version", domain.TusVersion)
+		ctx.AbortWithStatusJSON(http.StatusPreconditionFailed, gin.H{"error": "Unsupported tus version"})
+		return
+	}
+	ctx.Next()
+}
+
+// Options handles discovering the capabilities of the server
+func (c *TusController) Options(ctx *gin.Context) {
+	ctx.Header("Tus-Version", domain.TusVersion)
+	ctx.Header("Tus-Extension", tusExtensions)
+	ctx.Header("Tus-Max-Size", strconv.FormatInt(c.tusService.MaxSize(), 10))
+	ctx.Status(http.StatusNoContent)
+}
+
+// CreateUpload handles starting a resumable upload. The file name, title,
+// artist and album are passed in Upload-Metadata
+func (c *TusController) CreateUpload(ctx *gin.Context) {
+	if ctx.GetHeader("Upload-Defer-Length") != "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Deferred upload length is not supported"})
+		return
+	}
+	length, err := strconv.ParseInt(ctx.GetHeader("Upload-Length"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Upload-Length"})
+		return
+	}
+	metadata, err := parseUploadMetadata(ctx.GetHeader("Upload-Metadata"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	upload, err := c.tusService.Create(ctx.GetString("username"), length, metadata)
+	if err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+
+	c.setUploadHeaders(ctx, upload)
+	ctx.Header("Location", c.uploadURL(ctx, upload.ID))
+	ctx.Status(http.StatusCreated)
+}
+
+// GetUpload handles getting the offset of an upload to resume it
+func (c *TusController) GetUpload(ctx *gin.Context) {
+	upload, err := c.tusService.GetUpload(ctx.Param("id"), ctx.GetString("username"))
+	if err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if len(upload.Metadata) > 0 {
+		ctx.Header("Upload-Metadata", formatUploadMetadata(upload.Metadata))
+	}
+	c.setUploadHeaders(ctx, upload)
+	ctx.Status(http.StatusOK)
+}
+
+// PatchUpload handles receiving the next bytes of an upload. Once complete
+// the upload is queued for ingest, the job is linked in the Location header
+func (c *TusController) PatchUpload(ctx *gin.Context) {
+	if ctx.ContentType() != "application/offset+octet-stream" {
+		ctx.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be application/offset+octet-stream"})
+		return
+	}
+	offset, err := strconv.ParseInt(ctx.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Upload-Offset"})
+		return
+	}
+
+	upload, err := c.tusService.Write(ctx.Param("id"), ctx.GetString("username"), offset, ctx.Request.Body)
+	if err != nil {
+		if upload != nil {
+			// Bytes received before the error are kept
+			log.Printf("Upload %s interrupted at %d bytes: %v", upload.ID, upload.Offset, err)
+			c.setUploadHeaders(ctx, upload)
+		}
+		c.respondError(ctx, err)
+		return
+	}
+
+	c.setUploadHeaders(ctx, upload)
+	ctx.Status(http.StatusNoContent)
+}
+
+// DeleteUpload handles abandoning an upload
+func (c *TusController) DeleteUpload(ctx *gin.Context) {
+	if err := c.tusService.Terminate(ctx.Param("id"), ctx.GetString("username")); err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+func (c *TusController) setUploadHeaders(ctx *gin.Context, upload *domain.TusUpload) {
+	ctx.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	ctx.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if upload.JobID != nil {
+		ctx.Header("Location", fmt.Sprintf("/jobs/%d", *upload.JobID))
+	}
+}
+
+// uploadURL returns the URL of an upload relative to the creation request
+func (c *TusController) uploadURL(ctx *gin.Context, id string) string {
+	return strings.TrimSuffix(ctx.Request.URL.Path, "/") + "/" + id
+}
+
+func (c *TusController) respondError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, domain.ErrTusUploadNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+	case errors.Is(err, domain.ErrTusUploadExpired):
+		ctx.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrTusOffsetMismatch):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrTusUploadLocked):
+		ctx.JSON(http.StatusLocked, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrTusUploadTooLarge):
+		ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrTusMissingFilename), errors.Is(err, domain.ErrTusInvalidUploadSize), errors.Is(err, domain.ErrUnsupportedAudioFormat):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		if status, ok := uploadLimitStatus(err); ok {
+			ctx.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// parseUploadMetadata decodes an Upload-Metadata header: comma separated
+// pairs of a key and a base64 encoded value, which may be omitted
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, fmt.Errorf("invalid Upload-Metadata")
+		}
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("invalid Upload-Metadata value for %s", key)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// formatUploadMetadata encodes metadata for an Upload-Metadata header
+func formatUploadMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key
+		if value := metadata[key]; value != "" {
+			pairs[i] += " " + base64.StdEncoding.EncodeToString([]byte(value))
+		}
+	}
+	return strings.Join(pairs, ",")
+}
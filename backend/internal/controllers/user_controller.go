@@ -8,12 +8,13 @@ import (
 )
 
 type UserController struct {
-	userService domain.UserService
+	userService    domain.UserService
+	passwordPolicy domain.PasswordPolicy
 }
 
 // NewUserController creates a new instance of UserController
-func NewUserController(userService domain.UserService) *UserController {
-	return &UserController{userService: userService}
+func NewUserController(userService domain.UserService, passwordPolicy domain.PasswordPolicy) *UserController {
+	return &UserController{userService: userService, passwordPolicy: passwordPolicy}
 }
 
 // Register handles user registration
@@ -28,6 +29,11 @@ func (c *UserController) Register(ctx *gin.Context) {
 		return
 	}
 
+	if err := c.passwordPolicy.Validate(req.Username, req.Password); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	if err := c.userService.Register(req.Username, req.Password); err != nil {
 		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		return
@@ -48,13 +54,13 @@ func (c *UserController) Login(ctx *gin.Context) {
 		return
 	}
 
-	token, err := c.userService.Login(req.Username, req.Password)
+	tokens, err := c.userService.Login(req.Username, req.Password, ctx.Request.UserAgent(), ctx.ClientIP())
 	if err != nil {
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"token": token})
+	ctx.JSON(http.StatusOK, tokens)
 }
 
 // GetUser handles getting user information
@@ -1,6 +1,15 @@
 package controllers
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"github.com/gin-gonic/gin"
+)
 
 // Helper function to parse uint from string
 func parseUint(s string) uint {
@@ -11,3 +20,55 @@ func parseUint(s string) uint {
 	}
 	return result
 }
+
+// pageRequestFromQuery reads the "cursor", "limit", "sort" and "order"
+// query parameters of a list request
+func pageRequestFromQuery(ctx *gin.Context) domain.PageRequest {
+	limit, _ := strconv.Atoi(ctx.Query("limit"))
+	return domain.PageRequest{
+		Cursor: ctx.Query("cursor"),
+		Limit:  limit,
+		Sort:   ctx.Query("sort"),
+		Order:  domain.SortOrder(strings.ToLower(ctx.Query("order"))),
+	}
+}
+
+// musicFilterFromQuery reads the filters of a music list request
+func musicFilterFromQuery(ctx *gin.Context) (domain.MusicFilter, error) {
+	filter := domain.MusicFilter{
+		ArtistID:   parseUint(ctx.Query("artist_id")),
+		AlbumID:    parseUint(ctx.Query("album_id")),
+		UploadedBy: ctx.Query("uploaded_by"),
+	}
+
+	var err error
+	if value := ctx.Query("min_duration"); value != "" {
+		if filter.MinDuration, err = strconv.ParseFloat(value, 64); err != nil {
+			return filter, errors.New("invalid min_duration")
+		}
+	}
+	if value := ctx.Query("max_duration"); value != "" {
+		if filter.MaxDuration, err = strconv.ParseFloat(value, 64); err != nil {
+			return filter, errors.New("invalid max_duration")
+		}
+	}
+	return filter, nil
+}
+
+// respondListError writes the error of a list request, reporting invalid
+// cursors and sort keys as bad requests
+func respondListError(ctx *gin.Context, err error, message string) {
+	if errors.Is(err, domain.ErrInvalidCursor) || errors.Is(err, domain.ErrInvalidSort) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
+
+// actorFromContext builds the acting user from the values set by the auth middleware
+func actorFromContext(ctx *gin.Context) domain.Actor {
+	return domain.Actor{
+		Username: ctx.GetString("username"),
+		Role:     domain.Role(ctx.GetString("role")),
+	}
+}
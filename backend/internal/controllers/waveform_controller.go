@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+type WaveformController struct {
+	musicService    domain.MusicService
+	waveformService domain.WaveformService
+}
+
+// NewWaveformController creates a new instance of WaveformController
+func NewWaveformController(musicService domain.MusicService, waveformService domain.WaveformService) *WaveformController {
+	return &WaveformController{
+		musicService:    musicService,
+		waveformService: waveformService,
+	}
+}
+
+// GetWaveform handles serving the waveform of a track. The "buckets" query
+// parameter sets the resolution and "format=dat" selects the binary
+// audiowaveform format instead of JSON
+func (c *WaveformController) GetWaveform(ctx *gin.Context) {
+	buckets, err := strconv.Atoi(ctx.DefaultQuery("buckets", strconv.Itoa(domain.DefaultWaveformBuckets)))
+	if err != nil || buckets <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "buckets must be a positive number"})
+		return
+	}
+	format := ctx.DefaultQuery("format", "json")
+	if format != "json" && format != "dat" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or dat"})
+		return
+	}
+
+	music, err := c.musicService.GetMusic(uint(parseUint(ctx.Param("id"))))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Music not found"})
+		return
+	}
+
+	// Waveforms only change with the audio file they are computed from
+	etag := fmt.Sprintf(`"%x-%d-%s"`, sha256.Sum256([]byte(music.FilePath)), buckets, format)
+	ctx.Header("Cache-Control", "private, max-age=86400")
+	ctx.Header("ETag", etag)
+	if ctx.GetHeader("If-None-Match") == etag {
+		ctx.Status(http.StatusNotModified)
+		return
+	}
+
+	waveform, err := c.waveformService.GetWaveform(music, buckets)
+	if err != nil {
+		if errors.Is(err, domain.ErrObjectNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Audio file not found"})
+			return
+		}
+		log.Printf("Failed to get waveform of music %d: %v", music.ID, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate waveform"})
+		return
+	}
+
+	if format == "dat" {
+		data, err := waveform.MarshalBinary()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode waveform"})
+			return
+		}
+		ctx.Data(http.StatusOK, "application/octet-stream", data)
+		return
+	}
+	ctx.JSON(http.StatusOK, waveform)
+}
@@ -45,6 +45,16 @@ func (b *Broadcaster) BroadcastToMusic(musicID uint, message []byte, sender stri
 	}
 }
 
+// SendToUser sends a message to the client of a user, if connected
+func (b *Broadcaster) SendToUser(username string, message []byte) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if client, ok := b.clients[username]; ok {
+		client.Send(message)
+	}
+}
+
 // BroadcastUserJoined notifies all clients when a user joins
 func (b *Broadcaster) BroadcastUserJoined(username string, musicID uint) {
 	event := BaseEvent{
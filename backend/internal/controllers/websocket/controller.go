@@ -1,6 +1,7 @@
 package websocket
 
 import (
+	"encoding/json"
 	"log"
 	"net/http"
 	"time"
@@ -189,3 +190,33 @@ func (c *WebSocketController) UpdatePosition(username string, musicID uint, posi
 func (c *WebSocketController) BroadcastToMusic(musicID uint, message []byte, sender string) {
 	c.broadcaster.BroadcastToMusic(musicID, message, sender)
 }
+
+// NotifyJob sends the state of a job to the user that owns it
+func (c *WebSocketController) NotifyJob(job *domain.Job) {
+	data, err := json.Marshal(BaseEvent{
+		Type:    EventTypeJobUpdated,
+		Payload: job,
+	})
+	if err != nil {
+		log.Printf("Failed to marshal job updated event: %v", err)
+		return
+	}
+
+	c.broadcaster.SendToUser(job.Owner, data)
+}
+
+// NotifyPlaylist sends a change of a playlist to the given members
+func (c *WebSocketController) NotifyPlaylist(recipients []string, event *domain.PlaylistEvent) {
+	data, err := json.Marshal(BaseEvent{
+		Type:    EventTypePlaylistUpdated,
+		Payload: event,
+	})
+	if err != nil {
+		log.Printf("Failed to marshal playlist updated event: %v", err)
+		return
+	}
+
+	for _, username := range recipients {
+		c.broadcaster.SendToUser(username, data)
+	}
+}
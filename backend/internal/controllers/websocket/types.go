@@ -65,4 +65,6 @@ const (
 	EventTypePause            = "pause"
 	EventTypeResume           = "resume"
 	EventTypeChatMessage      = "chat_message"
+	EventTypeJobUpdated       = "job_updated"
+	EventTypePlaylistUpdated  = "playlist_updated"
 )
@@ -0,0 +1,21 @@
+package domain
+
+// SystemStats represents an overview of the system for administrators
+type SystemStats struct {
+	Users         int64          `json:"users"`
+	UsersByRole   map[Role]int64 `json:"users_by_role"`
+	DisabledUsers int64          `json:"disabled_users"`
+	Tracks        int64          `json:"tracks"`
+	TotalDuration float64        `json:"total_duration"` // Duration in seconds
+	Artists       int64          `json:"artists"`
+	Albums        int64          `json:"albums"`
+	Playlists     int64          `json:"playlists"`
+}
+
+// AdminService defines the interface for administrative operations
+type AdminService interface {
+	ListUsers() ([]*User, error)
+	SetUserRole(actor Actor, username string, role Role) error
+	SetUserDisabled(actor Actor, username string, disabled bool) error
+	GetSystemStats() (*SystemStats, error)
+}
@@ -0,0 +1,69 @@
+package domain
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Album represents an album of an artist. Albums are matched by their
+// normalized title, so differently spelt tags end up on the same album
+type Album struct {
+	ID              uint           `json:"id" gorm:"primaryKey"`
+	Title           string         `json:"title" gorm:"not null"`
+	NormalizedTitle string         `json:"-" gorm:"not null;uniqueIndex:idx_albums_artist_title"`
+	ArtistID        uint           `json:"artist_id" gorm:"not null;uniqueIndex:idx_albums_artist_title"`
+	Artist          *Artist        `json:"artist" gorm:"foreignKey:ArtistID"`
+	Year            int            `json:"year"`
+	ArtworkID       *uint          `json:"artwork_id"`
+	Tracks          []*Music       `json:"tracks,omitempty" gorm:"foreignKey:AlbumID"`
+	CreatedAt       time.Time      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt       time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// TableName specifies the table name for the Album model
+func (Album) TableName() string {
+	return "albums"
+}
+
+// Sort keys of album lists
+const (
+	AlbumSortTitle     = "title"
+	AlbumSortYear      = "year"
+	AlbumSortCreatedAt = "created_at"
+)
+
+// NormalizeAlbumTitle returns the key albums are matched by: the title in
+// lower case with surrounding and repeated whitespace removed
+func NormalizeAlbumTitle(title string) string {
+	return strings.ToLower(strings.Join(strings.Fields(title), " "))
+}
+
+// AlbumRepository defines the interface for album data operations
+type AlbumRepository interface {
+	Create(album *Album) error
+	Update(album *Album) error
+	FindByID(id uint) (*Album, error)
+	FindByArtistAndTitle(artistID uint, normalizedTitle string) (*Album, error)
+	FindByArtist(artistID uint) ([]*Album, error)
+	// List finds albums whose title contains the query, or all albums for an
+	// empty query
+	List(query string, page PageRequest) (*Page[*Album], error)
+	// FindTracks returns the tracks of an album in disc and track order
+	FindTracks(albumID uint) ([]*Music, error)
+	Count() (int64, error)
+}
+
+// AlbumService defines the interface for album business logic
+type AlbumService interface {
+	// GetAlbum returns an album with its tracklist
+	GetAlbum(id uint) (*Album, error)
+	// ListAlbums lists albums, filtered by a title query unless it is empty
+	ListAlbums(query string, page PageRequest) (*Page[*Album], error)
+	GetArtistAlbums(artistID uint) ([]*Album, error)
+	// GetOrCreateAlbum finds the album of an artist by title or creates it.
+	// Missing year and artwork of an existing album are filled in
+	GetOrCreateAlbum(title string, artistID uint, year int, artworkID *uint) (*Album, error)
+}
@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"errors"
 	"time"
 
 	"gorm.io/gorm"
@@ -10,11 +11,28 @@ import (
 type Artist struct {
 	ID        uint           `json:"id" gorm:"primaryKey"`
 	Name      string         `json:"name" gorm:"uniqueIndex;not null"`
+	Bio       string         `json:"bio" gorm:"type:text"`
+	ImageID   *uint          `json:"image_id"` // Artwork used as the artist's picture
 	CreatedAt time.Time      `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
+var ErrArtistNameTaken = errors.New("another artist already has this name, merge the artists instead")
+
+// Sort keys of artist lists
+const (
+	ArtistSortName      = "name"
+	ArtistSortCreatedAt = "created_at"
+)
+
+// ArtistUpdate holds the artist fields to change. Nil fields are left as is
+type ArtistUpdate struct {
+	Name  *string
+	Bio   *string
+	Image *string // Base64 encoded image, an empty string removes the image
+}
+
 // TableName specifies the table name for the Artist model
 func (Artist) TableName() string {
 	return "artists"
@@ -25,14 +43,27 @@ type ArtistRepository interface {
 	Create(artist *Artist) error
 	FindByID(id uint) (*Artist, error)
 	FindByName(name string) (*Artist, error)
-	Search(query string) ([]*Artist, error)
+	// Search finds artists whose name contains the query
+	Search(query string, page PageRequest) (*Page[*Artist], error)
 	FindAll() ([]*Artist, error)
+	Count() (int64, error)
+	Update(artist *Artist) error
+	// Merge reassigns all tracks of the duplicate artists to the canonical
+	// artist and removes the duplicates in a single transaction
+	Merge(canonicalID uint, duplicateIDs []uint) error
 }
 
 // ArtistService defines the interface for artist business logic
 type ArtistService interface {
 	CreateArtist(name string) (*Artist, error)
 	GetArtist(id uint) (*Artist, error)
-	SearchArtists(query string) ([]*Artist, error)
+	SearchArtists(query string, page PageRequest) (*Page[*Artist], error)
+	// GetOrCreateArtist returns the artist with the given name. A name made of
+	// several credits, like "A feat. B", resolves to its first primary artist
 	GetOrCreateArtist(name string) (*Artist, error)
+	// ResolveCredits parses the credits of a track from its artist and title
+	// tags, creating missing artists. The first credit is the primary artist
+	ResolveCredits(artists, title string) ([]*TrackArtist, error)
+	UpdateArtist(id uint, update ArtistUpdate) (*Artist, error)
+	MergeArtists(canonicalID uint, duplicateIDs []uint) (*Artist, error)
 }
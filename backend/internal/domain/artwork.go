@@ -0,0 +1,67 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// ArtworkSizes lists the thumbnail sizes (in pixels) generated for every artwork
+var ArtworkSizes = []int{64, 256, 512}
+
+// ErrArtworkTooLarge is returned for images with more pixels than artwork may have
+var ErrArtworkTooLarge = errors.New("artwork dimensions are too large")
+
+// Artwork represents a cover image, stored once per unique content
+type Artwork struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Hash      string    `json:"hash" gorm:"uniqueIndex;not null"` // SHA-256 of the original image
+	MimeType  string    `json:"mime_type"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	FilePath  string    `json:"-"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for the Artwork model
+func (Artwork) TableName() string {
+	return "artworks"
+}
+
+// Picture represents an image embedded in an audio file
+type Picture struct {
+	MimeType string
+	Data     []byte
+}
+
+// ArtworkImage is an encoded image ready to be served
+type ArtworkImage struct {
+	Data        []byte
+	MimeType    string
+	ETag        string
+	Placeholder bool // Indicates a generated image rather than real artwork
+}
+
+// ArtworkRepository defines the interface for artwork data operations
+type ArtworkRepository interface {
+	Create(artwork *Artwork) error
+	FindByID(id uint) (*Artwork, error)
+	FindByHash(hash string) (*Artwork, error)
+}
+
+// ArtworkService defines the interface for artwork business logic
+type ArtworkService interface {
+	// SaveArtwork stores an image and its thumbnails, reusing an existing
+	// artwork with the same content
+	SaveArtwork(picture *Picture) (*Artwork, error)
+	// GetArtworkImage returns the artwork scaled to the nearest available size
+	GetArtworkImage(id uint, size int) (*ArtworkImage, error)
+	// GetMusicCover returns the cover of a track, or a placeholder generated
+	// from the track when it has no artwork
+	GetMusicCover(musicID uint, size int) (*ArtworkImage, error)
+	// GetAlbumCover returns the cover of an album, or a placeholder generated
+	// from the album when it has no artwork
+	GetAlbumCover(albumID uint, size int) (*ArtworkImage, error)
+	// GetArtistImage returns the picture of an artist, or a placeholder
+	// generated from the artist when it has no picture
+	GetArtistImage(artistID uint, size int) (*ArtworkImage, error)
+}
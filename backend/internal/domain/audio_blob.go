@@ -0,0 +1,58 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// AudioBlob is an uploaded audio file stored once per unique content and
+// shared by every track referencing it
+type AudioBlob struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Hash        string    `json:"hash" gorm:"uniqueIndex;not null"` // SHA-256 of the file content
+	FilePath    string    `json:"-" gorm:"not null"`                // Storage key
+	Size        int64     `json:"size"`
+	Duration    float64   `json:"duration" gorm:"index"` // Duration in seconds
+	Fingerprint []byte    `json:"-"`                     // Acoustic fingerprint of the decoded audio
+	RefCount    int       `json:"ref_count" gorm:"not null;default:0"`
+	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for the AudioBlob model
+func (AudioBlob) TableName() string {
+	return "audio_blobs"
+}
+
+// ErrAudioBlobNotFound is returned for blobs that do not exist or were
+// deleted when their last reference was released
+var ErrAudioBlobNotFound = errors.New("audio blob not found")
+
+// AudioBlobRepository defines the interface for audio blob data operations
+type AudioBlobRepository interface {
+	Create(blob *AudioBlob) error
+	FindByID(id uint) (*AudioBlob, error)
+	FindByHash(hash string) (*AudioBlob, error)
+	// FindByDuration finds blobs whose duration lies within the given range
+	FindByDuration(min, max float64) ([]*AudioBlob, error)
+	// AcquireByHash finds the blob with the given content and adds a reference
+	// to it in one step, so it cannot be released in between
+	AcquireByHash(hash string) (*AudioBlob, error)
+	// Release removes a reference to a blob. When no references are left the
+	// blob is deleted and remove is called with it before the deletion is
+	// committed, the blob cannot be acquired while its files are removed
+	Release(id uint, remove func(blob *AudioBlob) error) error
+}
+
+// AudioBlobService defines the interface for content addressed audio storage
+type AudioBlobService interface {
+	// Store copies a local file of the given format into content addressed
+	// storage. When a blob with the same content exists the existing blob is
+	// returned instead. The caller holds a reference to the returned blob.
+	// The local file is left for the caller to remove
+	Store(filePath string, format AudioFormat, duration float64) (blob *AudioBlob, existed bool, err error)
+	// FindSimilar finds other blobs with the same audio, e.g. re-encodes
+	FindSimilar(blob *AudioBlob) ([]*AudioBlob, error)
+	// Release removes a reference to a blob and deletes the blob and its file
+	// when no references are left
+	Release(id uint) error
+}
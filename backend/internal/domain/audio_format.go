@@ -0,0 +1,23 @@
+package domain
+
+import "errors"
+
+var ErrUnsupportedAudioFormat = errors.New("unsupported audio format")
+
+// AudioFormat describes the container and codec of an audio file
+type AudioFormat struct {
+	Container string // e.g. "ogg"
+	Codec     string // e.g. "vorbis"
+	MimeType  string
+	Extension string // Extension files of the format are stored with, e.g. ".ogg"
+}
+
+// Audio formats that can be uploaded and streamed
+var (
+	AudioFormatMP3    = AudioFormat{Container: "mp3", Codec: "mp3", MimeType: "audio/mpeg", Extension: ".mp3"}
+	AudioFormatWAV    = AudioFormat{Container: "wav", Codec: "pcm", MimeType: "audio/wav", Extension: ".wav"}
+	AudioFormatVorbis = AudioFormat{Container: "ogg", Codec: "vorbis", MimeType: "audio/ogg", Extension: ".ogg"}
+	AudioFormatFLAC   = AudioFormat{Container: "flac", Codec: "flac", MimeType: "audio/flac", Extension: ".flac"}
+
+	AudioFormats = []AudioFormat{AudioFormatMP3, AudioFormatWAV, AudioFormatVorbis, AudioFormatFLAC}
+)
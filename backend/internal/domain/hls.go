@@ -0,0 +1,18 @@
+package domain
+
+import (
+	"errors"
+	"io"
+)
+
+var ErrHLSUnsupported = errors.New("HLS is only available for MP3 tracks")
+
+// HLSService packages tracks for HTTP Live Streaming. Segments are cut on
+// demand and cached in storage
+type HLSService interface {
+	// GetPlaylist returns the media playlist (.m3u8) of a track. Segment URIs
+	// are relative to the playlist and carry the given query, e.g. a signature
+	GetPlaylist(music *Music, segmentQuery string) ([]byte, error)
+	// GetSegment opens a segment of a track, or returns ErrObjectNotFound
+	GetSegment(music *Music, index int) (io.ReadCloser, *ObjectInfo, error)
+}
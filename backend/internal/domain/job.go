@@ -0,0 +1,135 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// JobStatus is the state of a background job
+type JobStatus string
+
+// Job states. Queued jobs are also those waiting for a retry
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCanceled  JobStatus = "canceled"
+)
+
+// Job is a unit of work run in the background, e.g. ingesting an upload
+type Job struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Type        string     `json:"type" gorm:"not null"`
+	Status      JobStatus  `json:"status" gorm:"not null;index:idx_jobs_status_run_at"`
+	Owner       string     `json:"owner" gorm:"index;not null"` // Username of the user the job runs for
+	Payload     string     `json:"-" gorm:"type:text"`          // JSON input of the handler
+	Result      string     `json:"-" gorm:"type:text"`          // JSON output of the handler
+	Error       string     `json:"error,omitempty"`             // Error of the last attempt
+	Stage       string     `json:"stage,omitempty"`             // e.g. "downloading"
+	Progress    float64    `json:"progress"`                    // Between 0 and 1
+	Attempts    int        `json:"attempts" gorm:"not null;default:0"`
+	MaxAttempts int        `json:"max_attempts" gorm:"not null;default:1"`
+	RunAt       time.Time  `json:"run_at" gorm:"index:idx_jobs_status_run_at"` // Earliest time the job may run
+	StartedAt   *time.Time `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// TableName specifies the table name for the Job model
+func (Job) TableName() string {
+	return "jobs"
+}
+
+// IsFinished reports whether the job will not run again
+func (j *Job) IsFinished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed || j.Status == JobCanceled
+}
+
+// MarshalJSON includes the result of the job as JSON rather than a string
+func (j Job) MarshalJSON() ([]byte, error) {
+	type job Job
+	var result json.RawMessage
+	if j.Result != "" {
+		result = json.RawMessage(j.Result)
+	}
+	return json.Marshal(struct {
+		job
+		Result json.RawMessage `json:"result,omitempty"`
+	}{job(j), result})
+}
+
+// Job errors
+var (
+	ErrJobNotFound    = errors.New("job not found")
+	ErrJobFinished    = errors.New("job has already finished")
+	ErrUnknownJobType = errors.New("unknown job type")
+)
+
+// PermanentError marks a job error retrying cannot fix, e.g. an invalid file
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// JobProgress reports the stage a running job is in and how far along the
+// whole job is, between 0 and 1
+type JobProgress func(stage string, progress float64)
+
+// JobHandler runs the jobs of one type
+type JobHandler interface {
+	// Run runs a job and returns its result, which is stored as JSON. Run
+	// must stop when the context is canceled. Errors are retried unless they
+	// are a PermanentError
+	Run(ctx context.Context, job *Job, progress JobProgress) (interface{}, error)
+	// Cleanup releases what a job holds once it will not run again, whether
+	// it succeeded, failed or was canceled
+	Cleanup(job *Job)
+}
+
+// JobNotifier delivers updates of jobs to the users that own them
+type JobNotifier interface {
+	NotifyJob(job *Job)
+}
+
+// JobRepository defines the interface for job data operations
+type JobRepository interface {
+	Create(job *Job) error
+	FindByID(id uint) (*Job, error)
+	// Claim marks the next due queued job as running and returns it, or nil
+	// when no job is due. Concurrent claims never return the same job
+	Claim() (*Job, error)
+	// Update saves the state of a job if its stored status is one of the
+	// given ones, reporting whether it was saved
+	Update(job *Job, from ...JobStatus) (bool, error)
+	// Touch marks running jobs as alive
+	Touch(ids []uint) error
+	// RequeueStale puts running jobs not touched since the given time back in
+	// the queue, failing those out of attempts. Their workers are gone. It
+	// returns the number of requeued jobs and the failed jobs
+	RequeueStale(before time.Time) (int64, []*Job, error)
+}
+
+// JobService defines the interface for running background jobs
+type JobService interface {
+	// RegisterHandler sets the handler of a job type. Handlers must be
+	// registered before Start
+	RegisterHandler(jobType string, handler JobHandler)
+	// Enqueue queues a job for a user. The payload is stored as JSON
+	Enqueue(jobType, owner string, payload interface{}) (*Job, error)
+	GetJob(id uint, actor Actor) (*Job, error)
+	// CancelJob stops a queued or running job
+	CancelJob(id uint, actor Actor) (*Job, error)
+	// Start runs the given number of workers in the background
+	Start(workers int)
+}
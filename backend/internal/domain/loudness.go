@@ -0,0 +1,26 @@
+package domain
+
+// ReferenceLoudness is the loudness, in LUFS, track and album gains bring
+// audio to. It matches ReplayGain 2.0
+const ReferenceLoudness = -18.0
+
+// AbsoluteGate is the loudness, in LUFS, below which EBU R128 treats audio as
+// silence. Silent tracks measure exactly this
+const AbsoluteGate = -70.0
+
+// LoudnessAnalysis is the result of measuring the loudness of an audio file
+// per EBU R128
+type LoudnessAnalysis struct {
+	Integrated float64 // Integrated loudness in LUFS
+	TruePeak   float64 // Maximum true peak in dBTP
+}
+
+// TrackGain returns the gain in dB that brings the audio to ReferenceLoudness,
+// or nil for silence, which no gain brings there
+func (a *LoudnessAnalysis) TrackGain() *float64 {
+	if a.Integrated <= AbsoluteGate {
+		return nil
+	}
+	gain := ReferenceLoudness - a.Integrated
+	return &gain
+}
@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"io"
 	"time"
 
 	"gorm.io/gorm"
@@ -8,17 +9,70 @@ import (
 
 // Music represents a music track in the system
 type Music struct {
-	ID         uint           `json:"id" gorm:"primaryKey"`
-	Title      string         `json:"title"`
-	ArtistID   uint           `json:"artist_id" gorm:"not null"`
-	Artist     *Artist        `json:"artist" gorm:"foreignKey:ArtistID"`
-	Album      string         `json:"album"`
-	FilePath   string         `json:"file_path"`
-	UploadedBy string         `json:"uploaded_by"`
-	Duration   float64        `json:"duration"` // Duration in seconds
-	CreatedAt  time.Time      `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt  time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
-	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"`
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	Title       string         `json:"title"`
+	ArtistID    uint           `json:"artist_id" gorm:"not null"`
+	Artist      *Artist        `json:"artist" gorm:"foreignKey:ArtistID"`
+	Credits     []*TrackArtist `json:"credits,omitempty" gorm:"foreignKey:MusicID"`
+	Album       string         `json:"album"`
+	AlbumID     *uint          `json:"album_id" gorm:"index"`
+	FilePath    string         `json:"file_path"`
+	BlobID      *uint          `json:"-" gorm:"index"` // Shared audio file, nil for files uploaded before deduplication
+	Container   string         `json:"container"`      // e.g. "ogg"
+	Codec       string         `json:"codec"`          // e.g. "vorbis"
+	MimeType    string         `json:"mime_type"`
+	FileSize    int64          `json:"file_size" gorm:"not null;default:0"` // In bytes, counted against the uploader's quota
+	UploadedBy  string         `json:"uploaded_by"`
+	Duration    float64        `json:"duration"`   // Duration in seconds
+	Loudness    *float64       `json:"loudness"`   // Integrated loudness in LUFS, nil until analysed
+	TruePeak    *float64       `json:"true_peak"`  // In dBTP
+	TrackGain   *float64       `json:"track_gain"` // Gain in dB to play the track at ReferenceLoudness
+	AlbumGain   *float64       `json:"album_gain"` // Gain in dB to play the album at ReferenceLoudness
+	PlayCount   int64          `json:"play_count" gorm:"not null;default:0"`
+	TrackNumber int            `json:"track_number"`
+	DiscNumber  int            `json:"disc_number"`
+	Year        int            `json:"year"`
+	Genre       string         `json:"genre"`
+	Composer    string         `json:"composer"`
+	ArtworkID   *uint          `json:"artwork_id"`
+	CreatedAt   time.Time      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	Duplicate   bool           `json:"duplicate,omitempty" gorm:"-"` // Indicates an upload matched this existing track
+}
+
+// AudioMetadata represents the tags embedded in an audio file
+type AudioMetadata struct {
+	Title       string   `json:"title"`
+	Artist      string   `json:"artist"`
+	AlbumArtist string   `json:"album_artist"`
+	Album       string   `json:"album"`
+	TrackNumber int      `json:"track_number"`
+	TrackTotal  int      `json:"track_total"`
+	DiscNumber  int      `json:"disc_number"`
+	DiscTotal   int      `json:"disc_total"`
+	Year        int      `json:"year"`
+	Genre       string   `json:"genre"`
+	Composer    string   `json:"composer"`
+	Picture     *Picture `json:"-"` // Embedded cover art, if any
+}
+
+// Sort keys of music lists
+const (
+	MusicSortCreatedAt = "created_at"
+	MusicSortTitle     = "title"
+	MusicSortDuration  = "duration"
+	MusicSortPlayCount = "play_count"
+)
+
+// MusicFilter narrows down a music list. Zero values are ignored
+type MusicFilter struct {
+	Query       string // Matches the title or the name of a credited artist
+	ArtistID    uint   // Matches tracks the artist is credited on in any role
+	AlbumID     uint
+	UploadedBy  string
+	MinDuration float64 // In seconds
+	MaxDuration float64 // In seconds
 }
 
 // TableName specifies the table name for the Music model
@@ -31,20 +85,44 @@ type MusicRepository interface {
 	Create(music *Music) error
 	FindByID(id uint) (*Music, error)
 	FindAll() ([]*Music, error)
-	Delete(id uint) error
-	FindByUploader(username string) ([]*Music, error)
+	// Delete removes a track and its playlist entries. release is called
+	// before the deletion is committed, when it fails the track is kept
+	Delete(id uint, release func() error) error
+	// FindByArtist finds the tracks an artist is credited on in any role
 	FindByArtist(artistID uint) ([]*Music, error)
-	FindByTitle(title string) ([]*Music, error)
+	// List returns a page of the tracks matching the filter
+	List(filter MusicFilter, page PageRequest) (*Page[*Music], error)
+	IncrementPlayCount(id uint) error
 	GetFilePath(id uint) (string, error)
+	FindByBlobID(blobID uint) (*Music, error)
+	Count() (int64, error)
+	TotalDuration() (float64, error)
+	// FindUnanalyzed returns up to limit tracks after the given ID whose
+	// loudness has not been measured, in ID order
+	FindUnanalyzed(afterID uint, limit int) ([]*Music, error)
+	UpdateLoudness(id uint, analysis *LoudnessAnalysis) error
+	// UpdateAlbumGain recomputes the album gain of every analysed track of an
+	// album from their combined loudness
+	UpdateAlbumGain(albumID uint) error
+	// UploaderUsage returns the total file size and number of the tracks a
+	// user uploaded
+	UploaderUsage(username string) (bytes int64, tracks int64, err error)
 }
 
 // MusicService defines the interface for music business logic
 type MusicService interface {
-	UploadMusic(title string, artistID uint, album, filePath, username string, duration float64) (*Music, error)
+	UploadMusic(music *Music) (*Music, error)
 	GetMusic(id uint) (*Music, error)
-	ListAllMusic() ([]*Music, error)
-	DeleteMusic(id uint, username string) error
-	SearchMusic(query string) ([]*Music, error)
-	GetUserMusic(username string) ([]*Music, error)
+	ListMusic(filter MusicFilter, page PageRequest) (*Page[*Music], error)
+	DeleteMusic(id uint, actor Actor) error
+	// RecordPlay counts a play of a track
+	RecordPlay(id uint) error
 	GetMusicByArtist(artistID uint) ([]*Music, error)
+	// GetMusicByBlob returns a track using the given audio file
+	GetMusicByBlob(blobID uint) (*Music, error)
+	// OpenAudio opens the audio file of a track for streaming
+	OpenAudio(music *Music) (io.ReadSeekCloser, *ObjectInfo, error)
+	// SetLoudness stores the loudness analysis of a track
+	SetLoudness(music *Music, analysis *LoudnessAnalysis) error
+	UpdateAlbumGain(albumID uint) error
 }
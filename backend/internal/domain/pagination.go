@@ -0,0 +1,37 @@
+package domain
+
+import "errors"
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidSort   = errors.New("invalid sort key")
+)
+
+// SortOrder is the direction of a sort
+type SortOrder string
+
+const (
+	SortAsc  SortOrder = "asc"
+	SortDesc SortOrder = "desc"
+)
+
+// PageRequest selects a page of a list. Cursor is the opaque NextCursor of
+// the previous page and must be used with the same sort key and order
+type PageRequest struct {
+	Cursor string
+	Limit  int
+	Sort   string
+	Order  SortOrder
+}
+
+// Page is a page of a list, the shared envelope of all list responses
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
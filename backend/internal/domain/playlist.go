@@ -1,41 +1,140 @@
 package domain
 
-import "time"
+import (
+	"errors"
+	"io"
+	"time"
+)
 
 // Playlist represents a music playlist in the system
 type Playlist struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	Name      string    `json:"name"`
-	CreatedBy string    `json:"created_by"`
-	CreatedAt time.Time `json:"created_at"`
-	Songs     []*Music  `json:"songs,omitempty" gorm:"many2many:playlist_musics;"`
-	IsOwner   bool      `json:"is_owner" gorm:"-"` // Indicates if the requesting user is the owner
+	ID        uint         `json:"id" gorm:"primaryKey"`
+	Name      string       `json:"name"`
+	CreatedBy string       `json:"created_by"`
+	CreatedAt time.Time    `json:"created_at"`
+	Songs     []*Music     `json:"songs,omitempty" gorm:"-"` // In playlist order
+	IsOwner   bool         `json:"is_owner" gorm:"-"`        // Indicates if the requesting user is the owner
+	Role      PlaylistRole `json:"role,omitempty" gorm:"-"`  // Role of the requesting user
 }
 
-// PlaylistMusic represents the relationship between playlists and music
-type PlaylistMusic struct {
-	PlaylistID uint `json:"playlist_id" gorm:"primaryKey"`
-	MusicID    uint `json:"music_id" gorm:"primaryKey"`
+// Sort keys of playlist lists
+const (
+	PlaylistSortCreatedAt = "created_at"
+	PlaylistSortName      = "name"
+)
+
+// PlaylistSongSortPosition is the only sort key of playlist songs, their order
+// in the playlist
+const PlaylistSongSortPosition = "position"
+
+// PlaylistEntry is a song at a position of a playlist. The same song can be
+// in a playlist more than once
+type PlaylistEntry struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	PlaylistID uint      `json:"playlist_id" gorm:"not null;index:idx_playlist_entries_position,priority:1"`
+	MusicID    uint      `json:"music_id" gorm:"not null;index"`
+	Music      *Music    `json:"music,omitempty" gorm:"foreignKey:MusicID"`
+	Position   int64     `json:"position" gorm:"not null;index:idx_playlist_entries_position,priority:2"`
+	AddedBy    string    `json:"added_by"`
+	AddedAt    time.Time `json:"added_at"`
 }
 
+// PlaylistPositionGap is the distance between the positions of neighbouring
+// entries. Entries are moved between their new neighbours without touching
+// other entries until the gap between two of them runs out
+const PlaylistPositionGap int64 = 1024
+
+var (
+	// ErrPlaylistEntryNotFound is returned for entries not in the playlist
+	ErrPlaylistEntryNotFound = errors.New("playlist entry not found")
+	// ErrInvalidPlaylistOrder is returned when a new order does not list every
+	// entry of the playlist exactly once
+	ErrInvalidPlaylistOrder = errors.New("order must list every entry of the playlist exactly once")
+)
+
 // PlaylistRepository defines the interface for playlist data operations
 type PlaylistRepository interface {
 	Create(playlist *Playlist) error
 	FindByID(id uint) (*Playlist, error)
-	FindByCreator(username string) ([]*Playlist, error)
+	// FindByMember finds the playlists a user created or accepted an
+	// invitation to
+	FindByMember(username string, page PageRequest) (*Page[*Playlist], error)
 	Delete(id uint) error
-	AddSong(playlistID, musicID uint) error
-	RemoveSong(playlistID, musicID uint) error
+	// AddEntry appends an entry to the end of its playlist
+	AddEntry(entry *PlaylistEntry) error
+	// RemoveSong removes every entry of a song from a playlist and returns
+	// the IDs of the removed entries
+	RemoveSong(playlistID, musicID uint) ([]uint, error)
+	FindEntry(playlistID, entryID uint) (*PlaylistEntry, error)
+	RemoveEntry(playlistID, entryID uint) error
+	// GetSongs returns the songs of a playlist in order
 	GetSongs(playlistID uint) ([]*Music, error)
+	// ListSongs returns a page of the songs of a playlist in order
+	ListSongs(playlistID uint, page PageRequest) (*Page[*Music], error)
+	// GetEntries returns the entries of a playlist in order
+	GetEntries(playlistID uint) ([]*PlaylistEntry, error)
+	// MoveEntry moves an entry to the given index of its playlist
+	MoveEntry(playlistID, entryID uint, index int) error
+	// ReorderEntries puts all entries of a playlist in the given order at once
+	ReorderEntries(playlistID uint, entryIDs []uint) error
+	Count() (int64, error)
+
+	AddMember(member *PlaylistMember) error
+	FindMember(playlistID uint, username string) (*PlaylistMember, error)
+	// FindMembers returns the members of a playlist, including pending ones
+	FindMembers(playlistID uint) ([]*PlaylistMember, error)
+	UpdateMember(member *PlaylistMember) error
+	RemoveMember(playlistID uint, username string) error
+	// FindInvitations returns the pending invitations of a user with their
+	// playlists
+	FindInvitations(username string) ([]*PlaylistMember, error)
+	// MemberRoles returns the roles of a user in the given playlists, for the
+	// playlists the user is an accepted member of
+	MemberRoles(username string, playlistIDs []uint) (map[uint]PlaylistRole, error)
 }
 
 // PlaylistService defines the interface for playlist business logic
 type PlaylistService interface {
 	CreatePlaylist(name, username string) (*Playlist, error)
-	GetPlaylist(id uint, username string) (*Playlist, error)
-	ListUserPlaylists(username string) ([]*Playlist, error)
-	DeletePlaylist(id uint, username string) error
-	AddSongToPlaylist(playlistID, musicID uint, username string) error
-	RemoveSongFromPlaylist(playlistID, musicID uint, username string) error
-	GetPlaylistSongs(playlistID uint, username string) ([]*Music, error)
+	GetPlaylist(id uint, actor Actor) (*Playlist, error)
+	// ListUserPlaylists lists the playlists a user owns or is a member of
+	ListUserPlaylists(username string, page PageRequest) (*Page[*Playlist], error)
+	DeletePlaylist(id uint, actor Actor) error
+	AddSongToPlaylist(playlistID, musicID uint, actor Actor) (*PlaylistEntry, error)
+	RemoveSongFromPlaylist(playlistID, musicID uint, actor Actor) error
+	RemovePlaylistEntry(playlistID, entryID uint, actor Actor) error
+	GetPlaylistSongs(playlistID uint, page PageRequest, actor Actor) (*Page[*Music], error)
+	GetPlaylistEntries(playlistID uint, actor Actor) ([]*PlaylistEntry, error)
+	// MovePlaylistEntry moves an entry and returns the entries in their new order
+	MovePlaylistEntry(playlistID, entryID uint, index int, actor Actor) ([]*PlaylistEntry, error)
+	// ReorderPlaylistEntries reorders all entries and returns them in their new order
+	ReorderPlaylistEntries(playlistID uint, entryIDs []uint, actor Actor) ([]*PlaylistEntry, error)
+
+	ListMembers(playlistID uint, actor Actor) ([]*PlaylistMember, error)
+	InviteMember(playlistID uint, username string, role PlaylistRole, actor Actor) (*PlaylistMember, error)
+	UpdateMemberRole(playlistID uint, username string, role PlaylistRole, actor Actor) (*PlaylistMember, error)
+	// RemoveMember removes a member or cancels an invitation. Members may
+	// remove themselves to leave a playlist or decline an invitation
+	RemoveMember(playlistID uint, username string, actor Actor) error
+	AcceptInvitation(playlistID uint, actor Actor) (*PlaylistMember, error)
+	ListInvitations(username string) ([]*PlaylistMember, error)
+}
+
+// Formats playlists can be exported in
+const (
+	PlaylistFormatM3U8 = "m3u8"
+	PlaylistFormatXSPF = "xspf"
+	PlaylistFormatJSPF = "jspf"
+)
+
+// ErrUnsupportedPlaylistFormat is returned when exporting to an unknown format
+var ErrUnsupportedPlaylistFormat = errors.New("unsupported playlist format, use m3u8, xspf or jspf")
+
+// PlaylistExporter writes playlists in formats media players can open
+type PlaylistExporter interface {
+	// Export writes a playlist and its songs in the given format. Songs are
+	// located at the URL returned by locate
+	Export(w io.Writer, format string, playlist *Playlist, songs []*Music, locate func(*Music) string) error
+	// ContentType returns the media type and file extension of a format
+	ContentType(format string) (mediaType, extension string, err error)
 }
@@ -0,0 +1,100 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// PlaylistRole is what a user may do with a playlist
+type PlaylistRole string
+
+// Roles in a playlist, each role may do everything the roles before it may
+const (
+	// PlaylistRoleViewer may see and play the songs of a playlist
+	PlaylistRoleViewer PlaylistRole = "viewer"
+	// PlaylistRoleContributor may add songs and remove the entries they added
+	PlaylistRoleContributor PlaylistRole = "contributor"
+	// PlaylistRoleEditor may remove and reorder any entry
+	PlaylistRoleEditor PlaylistRole = "editor"
+	// PlaylistRoleOwner is the creator of a playlist, the only one managing its
+	// members and deleting it. It cannot be given to members
+	PlaylistRoleOwner PlaylistRole = "owner"
+)
+
+// playlistRoleRanks orders the playlist roles
+var playlistRoleRanks = map[PlaylistRole]int{
+	PlaylistRoleViewer:      1,
+	PlaylistRoleContributor: 2,
+	PlaylistRoleEditor:      3,
+	PlaylistRoleOwner:       4,
+}
+
+// IsValid reports whether the role can be given to a member
+func (r PlaylistRole) IsValid() bool {
+	return r == PlaylistRoleViewer || r == PlaylistRoleContributor || r == PlaylistRoleEditor
+}
+
+// Allows reports whether the role may do what the given role may. The empty
+// role allows nothing
+func (r PlaylistRole) Allows(role PlaylistRole) bool {
+	rank, ok := playlistRoleRanks[r]
+	return ok && rank >= playlistRoleRanks[role]
+}
+
+// PlaylistMember is a user a playlist is shared with. Members are invited by
+// the owner and have no access until they accept
+type PlaylistMember struct {
+	PlaylistID uint         `json:"playlist_id" gorm:"primaryKey"`
+	Username   string       `json:"username" gorm:"primaryKey;index"`
+	Role       PlaylistRole `json:"role" gorm:"not null"`
+	InvitedBy  string       `json:"invited_by"`
+	InvitedAt  time.Time    `json:"invited_at"`
+	AcceptedAt *time.Time   `json:"accepted_at"` // Nil while the invitation is pending
+	Playlist   *Playlist    `json:"playlist,omitempty" gorm:"foreignKey:PlaylistID"`
+}
+
+// IsPending reports whether the member has not accepted the invitation yet
+func (m *PlaylistMember) IsPending() bool {
+	return m.AcceptedAt == nil
+}
+
+var (
+	// ErrPlaylistMemberNotFound is returned for users not invited to a playlist
+	ErrPlaylistMemberNotFound = errors.New("playlist member not found")
+	// ErrPlaylistMemberExists is returned when inviting a user twice
+	ErrPlaylistMemberExists = errors.New("user is already invited to the playlist")
+	// ErrInvalidPlaylistRole is returned for roles members cannot have
+	ErrInvalidPlaylistRole = errors.New("invalid playlist role, use viewer, contributor or editor")
+	// ErrInviteeNotFound is returned when inviting a user that does not exist
+	ErrInviteeNotFound = errors.New("invited user not found")
+	// ErrInvalidPlaylistInvite is returned when the owner invites themselves
+	ErrInvalidPlaylistInvite = errors.New("the owner cannot be invited to their own playlist")
+)
+
+// Kinds of playlist events
+const (
+	PlaylistEventEntryAdded       = "entry_added"
+	PlaylistEventEntriesRemoved   = "entries_removed"
+	PlaylistEventEntriesReordered = "entries_reordered"
+	PlaylistEventMemberInvited    = "member_invited"
+	PlaylistEventMemberJoined     = "member_joined"
+	PlaylistEventMemberUpdated    = "member_updated"
+	PlaylistEventMemberLeft       = "member_left"
+	PlaylistEventDeleted          = "playlist_deleted"
+)
+
+// PlaylistEvent describes a change to a playlist made by one of its members
+type PlaylistEvent struct {
+	Kind       string          `json:"kind"`
+	PlaylistID uint            `json:"playlist_id"`
+	Actor      string          `json:"actor"`
+	Entry      *PlaylistEntry  `json:"entry,omitempty"`
+	EntryIDs   []uint          `json:"entry_ids,omitempty"` // Removed entries, or all entries in their new order
+	Member     *PlaylistMember `json:"member,omitempty"`
+}
+
+// PlaylistNotifier delivers changes of playlists to their members as they
+// happen
+type PlaylistNotifier interface {
+	NotifyPlaylist(recipients []string, event *PlaylistEvent)
+}
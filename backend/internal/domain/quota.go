@@ -0,0 +1,36 @@
+package domain
+
+import "errors"
+
+// Quota limits what the users of a role may upload. Zero values mean no limit
+type Quota struct {
+	MaxBytes    int64   `json:"max_bytes"`     // Total size of all tracks of a user
+	MaxTracks   int64   `json:"max_tracks"`    // Number of tracks of a user
+	MaxFileSize int64   `json:"max_file_size"` // Size of a single file in bytes
+	MaxDuration float64 `json:"max_duration"`  // Duration of a single track in seconds
+}
+
+// Usage is what a user's uploads consume, along with the quota of their role
+type Usage struct {
+	Bytes  int64 `json:"bytes"`
+	Tracks int64 `json:"tracks"`
+	Quota  Quota `json:"quota"`
+}
+
+// Quota errors
+var (
+	ErrQuotaExceeded = errors.New("upload quota exceeded")
+	ErrFileTooLarge  = errors.New("file exceeds the maximum upload size")
+	ErrTrackTooLong  = errors.New("track exceeds the maximum duration")
+)
+
+// QuotaService defines the interface for enforcing upload quotas
+type QuotaService interface {
+	// GetQuota returns the quota of a role
+	GetQuota(role Role) Quota
+	GetUsage(username string) (*Usage, error)
+	// CheckUpload reports whether a user may add a track of the given size in
+	// bytes and duration in seconds. Unknown values are passed as zero and
+	// only checked against the totals
+	CheckUpload(username string, size int64, duration float64) error
+}
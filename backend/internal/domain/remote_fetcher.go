@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Remote fetch errors
+var (
+	ErrURLNotAllowed      = errors.New("URL is not allowed")
+	ErrRemoteFileTooLarge = errors.New("remote file is too large")
+)
+
+// RemoteFetcher fetches files from URLs supplied by users. Requests,
+// redirects and the addresses they connect to are checked against a policy,
+// so users cannot reach internal services through the server
+type RemoteFetcher interface {
+	// ValidateLink checks that a URL may be fetched and serves audio, judged
+	// by its content rather than its Content-Type
+	ValidateLink(ctx context.Context, url string) error
+	// CheckURL checks a URL against the policy without fetching it
+	CheckURL(url string) error
+	// Do sends a request under the policy
+	Do(req *http.Request) (*http.Response, error)
+	// MaxSize is the largest file that may be fetched, in bytes
+	MaxSize() int64
+}
@@ -0,0 +1,86 @@
+package domain
+
+import "errors"
+
+// Role represents the role of a user in the system
+type Role string
+
+// Available roles
+const (
+	RoleAdmin     Role = "admin"
+	RoleModerator Role = "moderator"
+	RoleUploader  Role = "uploader"
+	RoleListener  Role = "listener"
+)
+
+// DefaultRole is assigned to newly registered users. Every user could upload
+// before roles existed, so new users keep that ability by default
+const DefaultRole = RoleUploader
+
+// Permission represents an action that can be granted to roles
+type Permission string
+
+// Available permissions
+const (
+	PermUploadMusic       Permission = "music:upload"
+	PermDeleteAnyMusic    Permission = "music:delete_any"
+	PermManageAnyPlaylist Permission = "playlists:manage_any"
+	PermManageArtists     Permission = "artists:manage"
+	PermManageUsers       Permission = "users:manage"
+	PermViewStats         Permission = "stats:view"
+	PermManageAnyJob      Permission = "jobs:manage_any"
+)
+
+// rolePermissions maps every role to the permissions it grants
+var rolePermissions = map[Role][]Permission{
+	RoleAdmin: {
+		PermUploadMusic,
+		PermDeleteAnyMusic,
+		PermManageAnyPlaylist,
+		PermManageArtists,
+		PermManageUsers,
+		PermViewStats,
+		PermManageAnyJob,
+	},
+	RoleModerator: {
+		PermUploadMusic,
+		PermDeleteAnyMusic,
+		PermManageAnyPlaylist,
+		PermManageArtists,
+		PermViewStats,
+	},
+	RoleUploader: {
+		PermUploadMusic,
+	},
+	RoleListener: {},
+}
+
+// ErrForbidden is returned when a user lacks the permission for an operation
+var ErrForbidden = errors.New("forbidden: insufficient permissions")
+
+// IsValid reports whether the role is one of the known roles
+func (r Role) IsValid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Can reports whether the role grants the given permission
+func (r Role) Can(permission Permission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Actor identifies the user performing an operation
+type Actor struct {
+	Username string
+	Role     Role
+}
+
+// Can reports whether the actor has the given permission
+func (a Actor) Can(permission Permission) bool {
+	return a.Role.Can(permission)
+}
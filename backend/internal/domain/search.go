@@ -0,0 +1,76 @@
+package domain
+
+// Search result types that can be requested
+const (
+	SearchTypeTracks    = "tracks"
+	SearchTypeArtists   = "artists"
+	SearchTypeAlbums    = "albums"
+	SearchTypePlaylists = "playlists"
+)
+
+// SearchTypes lists all search result types
+var SearchTypes = []string{SearchTypeTracks, SearchTypeArtists, SearchTypeAlbums, SearchTypePlaylists}
+
+// SearchQuery represents a search request
+type SearchQuery struct {
+	Text     string
+	Types    []string // Result types to search, all when empty
+	Username string   // Only playlists of this user are searched
+	Limit    int      // Maximum number of results per type
+}
+
+// SearchHit is a matching row with its relevance score
+type SearchHit struct {
+	ID    uint
+	Score float64
+}
+
+// TrackResult is a track matching a search
+type TrackResult struct {
+	*Music
+	Score float64 `json:"score"`
+}
+
+// ArtistResult is an artist matching a search
+type ArtistResult struct {
+	*Artist
+	Score float64 `json:"score"`
+}
+
+// AlbumResult is an album matching a search
+type AlbumResult struct {
+	*Album
+	Score float64 `json:"score"`
+}
+
+// PlaylistResult is a playlist matching a search
+type PlaylistResult struct {
+	*Playlist
+	Score float64 `json:"score"`
+}
+
+// SearchResults groups the results of a search by type, best matches first
+type SearchResults struct {
+	Tracks    []*TrackResult    `json:"tracks"`
+	Artists   []*ArtistResult   `json:"artists"`
+	Albums    []*AlbumResult    `json:"albums"`
+	Playlists []*PlaylistResult `json:"playlists"`
+}
+
+// SearchRepository defines the interface for search operations. tsQuery is a
+// Postgres tsquery, text is the raw query used for typo tolerant matching
+type SearchRepository interface {
+	SearchTracks(tsQuery, text string, limit int) ([]SearchHit, error)
+	SearchArtists(tsQuery, text string, limit int) ([]SearchHit, error)
+	SearchAlbums(tsQuery, text string, limit int) ([]SearchHit, error)
+	SearchPlaylists(tsQuery, text, username string, limit int) ([]SearchHit, error)
+	FindTracks(ids []uint) ([]*Music, error)
+	FindArtists(ids []uint) ([]*Artist, error)
+	FindAlbums(ids []uint) ([]*Album, error)
+	FindPlaylists(ids []uint) ([]*Playlist, error)
+}
+
+// SearchService defines the interface for search business logic
+type SearchService interface {
+	Search(query SearchQuery) (*SearchResults, error)
+}
@@ -1,17 +1,82 @@
 package domain
 
-import "time"
+import (
+	"errors"
+	"time"
+)
 
-// Session represents a user session in the system
+// Session represents a logged in device of a user. Every session owns a
+// family of rotating refresh tokens; revoking the session revokes them all
 type Session struct {
-	Token     string    `json:"token"`
-	Username  string    `json:"username"`
-	CreatedAt time.Time `json:"created_at"`
+	ID         string     `json:"id" gorm:"primaryKey"`
+	Username   string     `json:"username" gorm:"index;not null"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"-" gorm:"index"`
+	Current    bool       `json:"current" gorm:"-"` // Indicates if this is the session of the requesting client
 }
 
+// TableName specifies the table name for the Session model
+func (Session) TableName() string {
+	return "sessions"
+}
+
+// RefreshToken represents a single refresh token issued for a session.
+// Only the SHA-256 hash of the token is stored
+type RefreshToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	SessionID string     `json:"session_id" gorm:"index;not null"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex;not null"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+// TableName specifies the table name for the RefreshToken model
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+// AuthTokens is the token pair handed to clients on login and refresh
+type AuthTokens struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // Access token lifetime in seconds
+}
+
+// Session errors
+var (
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrSessionRevoked      = errors.New("session has been revoked or has expired")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected, session revoked")
+)
+
 // SessionRepository defines the interface for session data operations
 type SessionRepository interface {
 	Create(session *Session) error
-	FindByToken(token string) (*Session, error)
-	DeleteByUsername(username string) error
+	FindByID(id string) (*Session, error)
+	FindActiveByUsername(username string) ([]*Session, error)
+	Update(session *Session) error
+	Revoke(id string) error
+	RevokeAllByUsername(username string) error
+	CreateRefreshToken(token *RefreshToken) error
+	FindRefreshTokenByHash(hash string) (*RefreshToken, error)
+	// MarkRefreshTokenUsed atomically consumes a refresh token and reports
+	// whether this call was the one that consumed it
+	MarkRefreshTokenUsed(id uint) (bool, error)
+}
+
+// SessionService defines the interface for session business logic
+type SessionService interface {
+	CreateSession(username, userAgent, ipAddress string) (*AuthTokens, error)
+	RefreshSession(refreshToken, userAgent, ipAddress string) (*AuthTokens, error)
+	// ValidateSession returns an error if the session is unknown, revoked or expired
+	ValidateSession(sessionID string) error
+	ListSessions(username, currentSessionID string) ([]*Session, error)
+	RevokeSession(sessionID, username string) error
+	RevokeAllSessions(username string) error
 }
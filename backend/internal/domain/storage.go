@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	ErrObjectNotFound        = errors.New("object not found")
+	ErrSignedURLNotSupported = errors.New("signed URLs are not supported by this storage")
+)
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+	ETag        string
+}
+
+// Storage stores files such as audio, artwork and profile pictures. Keys are
+// slash separated paths like "audio/ab/abcd.mp3"
+type Storage interface {
+	// Put stores the content of r under key, replacing any existing object
+	Put(key string, r io.Reader, size int64, contentType string) error
+	// Get opens an object for reading
+	Get(key string) (io.ReadCloser, *ObjectInfo, error)
+	// Range opens length bytes of an object starting at offset for reading
+	Range(key string, offset, length int64) (io.ReadCloser, error)
+	// Delete removes an object. Deleting a missing object is not an error
+	Delete(key string) error
+	// Stat returns the details of an object or ErrObjectNotFound
+	Stat(key string) (*ObjectInfo, error)
+	// SignedURL returns a URL the object can be downloaded from without
+	// credentials until the expiry passes, or ErrSignedURLNotSupported
+	SignedURL(key string, expiry time.Duration) (string, error)
+}
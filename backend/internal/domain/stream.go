@@ -0,0 +1,29 @@
+package domain
+
+import (
+	"errors"
+	"net/url"
+	"time"
+)
+
+var ErrInvalidStreamURL = errors.New("invalid or expired stream URL")
+
+// StreamURL is a signed URL a track can be streamed from without sending
+// credentials, e.g. by an <audio> element
+type StreamURL struct {
+	URL       string    `json:"url"` // Path and query, relative to the API
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// StreamSigner issues and verifies signed stream URLs
+type StreamSigner interface {
+	// Sign returns a stream URL of a track issued to a user. When IP binding
+	// is enabled the URL only works from the given client IP
+	Sign(musicID uint, username, ip string) *StreamURL
+	// SignFor is Sign with a lifetime other than the default, e.g. for URLs
+	// written to exported playlists
+	SignFor(musicID uint, username, ip string, ttl time.Duration) *StreamURL
+	// Verify checks the signature in the query of a stream request and
+	// returns the user the URL was issued to
+	Verify(musicID uint, query url.Values, ip string) (string, error)
+}
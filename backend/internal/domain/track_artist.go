@@ -0,0 +1,26 @@
+package domain
+
+// ArtistRole describes how an artist is credited on a track
+type ArtistRole string
+
+const (
+	ArtistRolePrimary  ArtistRole = "primary"
+	ArtistRoleFeatured ArtistRole = "featured"
+	ArtistRoleRemixer  ArtistRole = "remixer"
+	ArtistRoleProducer ArtistRole = "producer"
+)
+
+// TrackArtist credits an artist on a track. A track has at least one primary
+// artist, the first of which is also stored as Music.ArtistID
+type TrackArtist struct {
+	MusicID  uint       `json:"-" gorm:"primaryKey"`
+	ArtistID uint       `json:"artist_id" gorm:"primaryKey;index"`
+	Role     ArtistRole `json:"role" gorm:"primaryKey;type:varchar(20)"`
+	Position int        `json:"position"` // Order of the credit within the track
+	Artist   *Artist    `json:"artist" gorm:"foreignKey:ArtistID"`
+}
+
+// TableName specifies the table name for the TrackArtist model
+func (TrackArtist) TableName() string {
+	return "track_artists"
+}
@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// TusVersion is the version of the tus resumable upload protocol supported
+const TusVersion = "1.0.0"
+
+// TusUpload is a resumable upload made with the tus protocol. Once all bytes
+// have arrived the file is handed to an ingest job
+type TusUpload struct {
+	ID        string            `json:"id"`
+	Owner     string            `json:"owner"`    // Username of the uploader
+	Length    int64             `json:"length"`   // Total size in bytes
+	Offset    int64             `json:"offset"`   // Bytes received so far
+	Metadata  map[string]string `json:"metadata"` // e.g. filename, title, artist and album
+	ExpiresAt time.Time         `json:"expires_at"`
+	JobID     *uint             `json:"job_id,omitempty"` // Ingest job, set once the upload is complete
+}
+
+// IsComplete reports whether all bytes of the upload have arrived
+func (u *TusUpload) IsComplete() bool {
+	return u.Offset == u.Length
+}
+
+// Tus upload errors
+var (
+	ErrTusUploadNotFound    = errors.New("upload not found")
+	ErrTusUploadExpired     = errors.New("upload has expired")
+	ErrTusUploadLocked      = errors.New("upload is being written by another request")
+	ErrTusOffsetMismatch    = errors.New("upload offset does not match")
+	ErrTusUploadTooLarge    = errors.New("upload exceeds the allowed size")
+	ErrTusMissingFilename   = errors.New("upload metadata must include a filename")
+	ErrTusInvalidUploadSize = errors.New("upload length must not be negative")
+)
+
+// TusService defines the interface for resumable uploads. Uploads are only
+// visible to their owner
+type TusService interface {
+	// Create starts an upload of the given length
+	Create(owner string, length int64, metadata map[string]string) (*TusUpload, error)
+	GetUpload(id, owner string) (*TusUpload, error)
+	// Write appends the data read from r to an upload, which must currently
+	// hold offset bytes. Bytes received before an error are kept so the client
+	// can resume. A complete upload is queued for ingest
+	Write(id, owner string, offset int64, r io.Reader) (*TusUpload, error)
+	// Terminate deletes an upload and the bytes received so far
+	Terminate(id, owner string) error
+	// MaxSize is the largest upload accepted, in bytes
+	MaxSize() int64
+	// Start removes expired uploads in the background
+	Start()
+}
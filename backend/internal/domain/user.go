@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"errors"
 	"time"
 
 	"gorm.io/gorm"
@@ -12,6 +13,8 @@ type User struct {
 	Password       string         `json:"-" gorm:"not null"` // Password is not exposed in JSON
 	Name           *string        `json:"name" gorm:"null"`
 	ProfilePicture *string        `json:"profile_picture" gorm:"null"`
+	Role           Role           `json:"role" gorm:"type:varchar(20);not null;default:uploader"`
+	DisabledAt     *time.Time     `json:"disabled_at" gorm:"null"`
 	CreatedAt      time.Time      `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt      time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
 	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
@@ -23,12 +26,41 @@ type UserRepository interface {
 	FindByUsername(username string) (*User, error)
 	Delete(username string) error
 	Update(user *User) error
+	FindAll() ([]*User, error)
+	Count() (int64, error)
+	CountByRole() (map[Role]int64, error)
+	CountDisabled() (int64, error)
 }
 
 // UserService defines the interface for user business logic
 type UserService interface {
 	Register(username, password string) error
-	Login(username, password string) (string, error)
+	Login(username, password, userAgent, ipAddress string) (*AuthTokens, error)
 	GetUser(username string) (*User, error)
 	UpdateProfile(username string, name string, profilePicture string) error
 }
+
+// Password policy errors
+var (
+	ErrPasswordTooShort    = errors.New("password must be at least 8 characters long")
+	ErrPasswordTooLong     = errors.New("password must be at most 72 bytes long")
+	ErrPasswordIsUsername  = errors.New("password must not match the username")
+	ErrPasswordTooCommon   = errors.New("password is too common, please choose another one")
+	ErrInvalidPasswordHash = errors.New("invalid password hash")
+	ErrUserDisabled        = errors.New("user account is disabled")
+)
+
+// PasswordHasher defines the interface for hashing and verifying passwords
+type PasswordHasher interface {
+	// Hash returns the encoded hash of a password
+	Hash(password string) (string, error)
+	// Verify compares a password with an encoded hash in constant time.
+	// needsRehash reports whether the stored hash should be replaced with
+	// a fresh one, e.g. because it uses an outdated algorithm or parameters
+	Verify(password, encodedHash string) (match bool, needsRehash bool, err error)
+}
+
+// PasswordPolicy defines the rules a new password must satisfy
+type PasswordPolicy interface {
+	Validate(username, password string) error
+}
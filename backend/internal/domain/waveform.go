@@ -0,0 +1,105 @@
+package domain
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var ErrInvalidWaveform = errors.New("invalid waveform data")
+
+// DefaultWaveformBuckets is the number of peaks returned when a client does
+// not ask for a resolution
+const DefaultWaveformBuckets = 1000
+
+// Waveform holds the peaks of a track: the minimum and maximum sample of
+// every bucket of SamplesPerPixel samples, with channels mixed down. The
+// layout follows the .dat and JSON formats of audiowaveform
+type Waveform struct {
+	SampleRate      int     `json:"sample_rate"`
+	SamplesPerPixel int     `json:"samples_per_pixel"`
+	Bits            int     `json:"bits"`   // Always 16
+	Length          int     `json:"length"` // Number of buckets
+	Data            []int16 `json:"data"`   // Min and max of each bucket, interleaved
+}
+
+// waveformHeaderSize is the size of a version 1 .dat header
+const waveformHeaderSize = 20
+
+// MarshalBinary encodes the waveform as a version 1 audiowaveform .dat file
+func (w *Waveform) MarshalBinary() ([]byte, error) {
+	data := make([]byte, waveformHeaderSize+2*len(w.Data))
+	binary.LittleEndian.PutUint32(data[0:], 1) // Version
+	binary.LittleEndian.PutUint32(data[4:], 0) // Flags, 0 for 16 bit samples
+	binary.LittleEndian.PutUint32(data[8:], uint32(w.SampleRate))
+	binary.LittleEndian.PutUint32(data[12:], uint32(w.SamplesPerPixel))
+	binary.LittleEndian.PutUint32(data[16:], uint32(w.Length))
+	for i, v := range w.Data {
+		binary.LittleEndian.PutUint16(data[waveformHeaderSize+2*i:], uint16(v))
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes a version 1 audiowaveform .dat file with 16 bit
+// samples
+func (w *Waveform) UnmarshalBinary(data []byte) error {
+	if len(data) < waveformHeaderSize ||
+		binary.LittleEndian.Uint32(data[0:]) != 1 ||
+		binary.LittleEndian.Uint32(data[4:])&1 != 0 {
+		return ErrInvalidWaveform
+	}
+
+	length := int(binary.LittleEndian.Uint32(data[16:]))
+	if len(data) != waveformHeaderSize+4*length {
+		return ErrInvalidWaveform
+	}
+
+	w.SampleRate = int(binary.LittleEndian.Uint32(data[8:]))
+	w.SamplesPerPixel = int(binary.LittleEndian.Uint32(data[12:]))
+	w.Bits = 16
+	w.Length = length
+	w.Data = make([]int16, 2*length)
+	for i := range w.Data {
+		w.Data[i] = int16(binary.LittleEndian.Uint16(data[waveformHeaderSize+2*i:]))
+	}
+	return nil
+}
+
+// Resample merges buckets so the waveform has at most the given number of
+// them. Waveforms cannot be upsampled, so a waveform that is already small
+// enough is returned as is
+func (w *Waveform) Resample(buckets int) *Waveform {
+	if buckets <= 0 || buckets >= w.Length {
+		return w
+	}
+
+	ratio := float64(w.Length) / float64(buckets)
+	resampled := &Waveform{
+		SampleRate:      w.SampleRate,
+		SamplesPerPixel: int(math.Round(float64(w.SamplesPerPixel) * ratio)),
+		Bits:            w.Bits,
+		Length:          buckets,
+		Data:            make([]int16, 2*buckets),
+	}
+	for i := 0; i < buckets; i++ {
+		start, end := int(float64(i)*ratio), int(float64(i+1)*ratio)
+		low, high := int16(math.MaxInt16), int16(math.MinInt16)
+		for j := start; j < end; j++ {
+			low = min(low, w.Data[2*j])
+			high = max(high, w.Data[2*j+1])
+		}
+		resampled.Data[2*i], resampled.Data[2*i+1] = low, high
+	}
+	return resampled
+}
+
+// WaveformService generates and serves the waveforms of tracks. Waveforms
+// are stored next to the audio they are computed from
+type WaveformService interface {
+	// Generate computes the waveform of a local audio file and stores it for
+	// the audio stored under the given key
+	Generate(filePath, audioKey string) error
+	// GetWaveform returns the waveform of a track with at most the given
+	// number of buckets. Waveforms missing for older tracks are generated
+	GetWaveform(music *Music, buckets int) (*Waveform, error)
+}
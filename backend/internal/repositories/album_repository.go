@@ -0,0 +1,96 @@
+package repositories
+
+import (
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"gorm.io/gorm"
+)
+
+type albumRepository struct {
+	db *gorm.DB
+}
+
+// NewAlbumRepository creates a new instance of AlbumRepository
+func NewAlbumRepository(db *gorm.DB) domain.AlbumRepository {
+	return &albumRepository{db: db}
+}
+
+func (r *albumRepository) Create(album *domain.Album) error {
+	return r.db.Create(album).Error
+}
+
+func (r *albumRepository) Update(album *domain.Album) error {
+	return r.db.Omit("Artist", "Tracks").Save(album).Error
+}
+
+func (r *albumRepository) FindByID(id uint) (*domain.Album, error) {
+	var album domain.Album
+	err := r.db.Preload("Artist").First(&album, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &album, nil
+}
+
+func (r *albumRepository) FindByArtistAndTitle(artistID uint, normalizedTitle string) (*domain.Album, error) {
+	var album domain.Album
+	err := r.db.Where("artist_id = ? AND normalized_title = ?", artistID, normalizedTitle).First(&album).Error
+	if err != nil {
+		return nil, err
+	}
+	return &album, nil
+}
+
+func (r *albumRepository) FindByArtist(artistID uint) ([]*domain.Album, error) {
+	var albums []*domain.Album
+	err := r.db.Preload("Artist").
+		Where("artist_id = ?", artistID).
+		Order("year DESC, title").
+		Find(&albums).Error
+	return albums, err
+}
+
+// albumSortKeys are the keys album lists can be sorted by
+var albumSortKeys = map[string]sortKey[*domain.Album]{
+	domain.AlbumSortTitle: {
+		column:       "albums.title",
+		defaultOrder: domain.SortAsc,
+		value:        func(a *domain.Album) interface{} { return a.Title },
+		parse:        parseStringValue,
+	},
+	domain.AlbumSortYear: {
+		column:       "albums.year",
+		defaultOrder: domain.SortDesc,
+		value:        func(a *domain.Album) interface{} { return a.Year },
+		parse:        parseIntValue,
+	},
+	domain.AlbumSortCreatedAt: {
+		column:       "albums.created_at",
+		defaultOrder: domain.SortDesc,
+		value:        func(a *domain.Album) interface{} { return a.CreatedAt },
+		parse:        parseTimeValue,
+	},
+}
+
+func (r *albumRepository) List(query string, page domain.PageRequest) (*domain.Page[*domain.Album], error) {
+	albums := r.db.Preload("Artist").Model(&domain.Album{})
+	if query != "" {
+		albums = albums.Where("albums.title ILIKE ?", containsPattern(query))
+	}
+	return paginate(albums, page, albumSortKeys, domain.AlbumSortTitle, "albums.id",
+		func(a *domain.Album) uint { return a.ID })
+}
+
+func (r *albumRepository) FindTracks(albumID uint) ([]*domain.Music, error) {
+	var tracks []*domain.Music
+	err := preloadArtists(r.db).
+		Where("album_id = ?", albumID).
+		Order("disc_number, track_number, id").
+		Find(&tracks).Error
+	return tracks, err
+}
+
+func (r *albumRepository) Count() (int64, error) {
+	var count int64
+	err := r.db.Model(&domain.Album{}).Count(&count).Error
+	return count, err
+}
@@ -35,10 +35,27 @@ func (r *artistRepository) FindByName(name string) (*domain.Artist, error) {
 	return &artist, nil
 }
 
-func (r *artistRepository) Search(query string) ([]*domain.Artist, error) {
-	var artists []*domain.Artist
-	err := r.db.Where("name LIKE ?", "%"+query+"%").Find(&artists).Error
-	return artists, err
+// artistSortKeys are the keys artist lists can be sorted by
+var artistSortKeys = map[string]sortKey[*domain.Artist]{
+	domain.ArtistSortName: {
+		column:       "artists.name",
+		defaultOrder: domain.SortAsc,
+		value:        func(a *domain.Artist) interface{} { return a.Name },
+		parse:        parseStringValue,
+	},
+	domain.ArtistSortCreatedAt: {
+		column:       "artists.created_at",
+		defaultOrder: domain.SortDesc,
+		value:        func(a *domain.Artist) interface{} { return a.CreatedAt },
+		parse:        parseTimeValue,
+	},
+}
+
+func (r *artistRepository) Search(query string, page domain.PageRequest) (*domain.Page[*domain.Artist], error) {
+	search := containsPattern(query)
+	artists := r.db.Model(&domain.Artist{}).Where("artists.name ILIKE ?", search)
+	return paginate(artists, page, artistSortKeys, domain.ArtistSortName, "artists.id",
+		func(a *domain.Artist) uint { return a.ID })
 }
 
 func (r *artistRepository) FindAll() ([]*domain.Artist, error) {
@@ -46,3 +63,104 @@ func (r *artistRepository) FindAll() ([]*domain.Artist, error) {
 	err := r.db.Find(&artists).Error
 	return artists, err
 }
+
+func (r *artistRepository) Count() (int64, error) {
+	var count int64
+	err := r.db.Model(&domain.Artist{}).Count(&count).Error
+	return count, err
+}
+
+func (r *artistRepository) Update(artist *domain.Artist) error {
+	return r.db.Save(artist).Error
+}
+
+func (r *artistRepository) Merge(canonicalID uint, duplicateIDs []uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// Soft deleted tracks reference the duplicates too and would block the
+		// delete below
+		if err := tx.Unscoped().Model(&domain.Music{}).
+			Where("artist_id IN ?", duplicateIDs).
+			Update("artist_id", canonicalID).Error; err != nil {
+			return err
+		}
+
+		if err := mergeTrackArtists(tx, canonicalID, duplicateIDs); err != nil {
+			return err
+		}
+
+		if err := mergeArtistAlbums(tx, canonicalID, duplicateIDs); err != nil {
+			return err
+		}
+
+		// Hard delete so the misspelt names are free to be used again
+		return tx.Unscoped().Where("id IN ?", duplicateIDs).Delete(&domain.Artist{}).Error
+	})
+}
+
+// mergeTrackArtists moves the credits of the duplicate artists to the
+// canonical artist, dropping credits the canonical artist already has
+func mergeTrackArtists(tx *gorm.DB, canonicalID uint, duplicateIDs []uint) error {
+	for _, duplicateID := range duplicateIDs {
+		if err := tx.Exec(`DELETE FROM track_artists d WHERE d.artist_id = ? AND EXISTS (
+			SELECT 1 FROM track_artists c WHERE c.music_id = d.music_id AND c.role = d.role AND c.artist_id = ?)`,
+			duplicateID, canonicalID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&domain.TrackArtist{}).
+			Where("artist_id = ?", duplicateID).
+			Update("artist_id", canonicalID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeArtistAlbums moves the albums of the duplicate artists to the canonical
+// artist. An album the canonical artist already has is merged into it
+func mergeArtistAlbums(tx *gorm.DB, canonicalID uint, duplicateIDs []uint) error {
+	var albums []*domain.Album
+	if err := tx.Unscoped().Where("artist_id = ? OR artist_id IN ?", canonicalID, duplicateIDs).
+		Order("id").Find(&albums).Error; err != nil {
+		return err
+	}
+
+	kept := make(map[string]*domain.Album)
+	for _, album := range albums {
+		if album.ArtistID == canonicalID {
+			kept[album.NormalizedTitle] = album
+		}
+	}
+
+	for _, album := range albums {
+		if album.ArtistID == canonicalID {
+			continue
+		}
+
+		target, exists := kept[album.NormalizedTitle]
+		if !exists {
+			if err := tx.Unscoped().Model(album).Update("artist_id", canonicalID).Error; err != nil {
+				return err
+			}
+			album.ArtistID = canonicalID
+			kept[album.NormalizedTitle] = album
+			continue
+		}
+
+		if err := tx.Model(&domain.Music{}).Unscoped().
+			Where("album_id = ?", album.ID).
+			Update("album_id", target.ID).Error; err != nil {
+			return err
+		}
+		if target.ArtworkID == nil && album.ArtworkID != nil {
+			if err := tx.Unscoped().Model(target).Update("artwork_id", album.ArtworkID).Error; err != nil {
+				return err
+			}
+			target.ArtworkID = album.ArtworkID
+		}
+		if err := tx.Unscoped().Delete(album).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
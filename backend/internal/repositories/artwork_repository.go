@@ -0,0 +1,37 @@
+package repositories
+
+import (
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"gorm.io/gorm"
+)
+
+type artworkRepository struct {
+	db *gorm.DB
+}
+
+// NewArtworkRepository creates a new instance of ArtworkRepository
+func NewArtworkRepository(db *gorm.DB) domain.ArtworkRepository {
+	return &artworkRepository{db: db}
+}
+
+func (r *artworkRepository) Create(artwork *domain.Artwork) error {
+	return r.db.Create(artwork).Error
+}
+
+func (r *artworkRepository) FindByID(id uint) (*domain.Artwork, error) {
+	var artwork domain.Artwork
+	err := r.db.First(&artwork, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &artwork, nil
+}
+
+func (r *artworkRepository) FindByHash(hash string) (*domain.Artwork, error) {
+	var artwork domain.Artwork
+	err := r.db.Where("hash = ?", hash).First(&artwork).Error
+	if err != nil {
+		return nil, err
+	}
+	return &artwork, nil
+}
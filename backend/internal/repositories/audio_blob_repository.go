@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"errors"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type audioBlobRepository struct {
+	db *gorm.DB
+}
+
+// NewAudioBlobRepository creates a new instance of AudioBlobRepository
+func NewAudioBlobRepository(db *gorm.DB) domain.AudioBlobRepository {
+	return &audioBlobRepository{db: db}
+}
+
+func (r *audioBlobRepository) Create(blob *domain.AudioBlob) error {
+	return r.db.Create(blob).Error
+}
+
+func (r *audioBlobRepository) FindByID(id uint) (*domain.AudioBlob, error) {
+	var blob domain.AudioBlob
+	err := r.db.First(&blob, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &blob, nil
+}
+
+func (r *audioBlobRepository) FindByHash(hash string) (*domain.AudioBlob, error) {
+	var blob domain.AudioBlob
+	err := r.db.Where("hash = ?", hash).First(&blob).Error
+	if err != nil {
+		return nil, err
+	}
+	return &blob, nil
+}
+
+func (r *audioBlobRepository) FindByDuration(min, max float64) ([]*domain.AudioBlob, error) {
+	var blobs []*domain.AudioBlob
+	err := r.db.Where("duration BETWEEN ? AND ?", min, max).Find(&blobs).Error
+	return blobs, err
+}
+
+func (r *audioBlobRepository) AcquireByHash(hash string) (*domain.AudioBlob, error) {
+	var blob domain.AudioBlob
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Waits for a release of the blob deleting it to finish
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("hash = ?", hash).
+			First(&blob).Error; err != nil {
+			return err
+		}
+
+		blob.RefCount++
+		return tx.Model(&blob).UpdateColumn("ref_count", blob.RefCount).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, domain.ErrAudioBlobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &blob, nil
+}
+
+func (r *audioBlobRepository) Release(id uint, remove func(blob *domain.AudioBlob) error) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var blob domain.AudioBlob
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&blob, id).Error; err != nil {
+			return err
+		}
+
+		blob.RefCount--
+		if blob.RefCount > 0 {
+			return tx.Model(&blob).UpdateColumn("ref_count", blob.RefCount).Error
+		}
+
+		if err := tx.Delete(&blob).Error; err != nil {
+			return err
+		}
+		return remove(&blob)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.ErrAudioBlobNotFound
+	}
+	return err
+}
@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"gorm.io/gorm"
+)
+
+type jobRepository struct {
+	db *gorm.DB
+}
+
+// NewJobRepository creates a new instance of JobRepository
+func NewJobRepository(db *gorm.DB) domain.JobRepository {
+	return &jobRepository{db: db}
+}
+
+func (r *jobRepository) Create(job *domain.Job) error {
+	return r.db.Create(job).Error
+}
+
+func (r *jobRepository) FindByID(id uint) (*domain.Job, error) {
+	var job domain.Job
+	if err := r.db.First(&job, id).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *jobRepository) Claim() (*domain.Job, error) {
+	// Locked rows are skipped so workers of every instance can claim at once
+	var job domain.Job
+	err := r.db.Raw(`
+		UPDATE jobs SET status = ?, attempts = attempts + 1, started_at = NOW(), updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM jobs WHERE status = ? AND run_at <= NOW()
+			ORDER BY run_at, id LIMIT 1 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`, domain.JobRunning, domain.JobQueued).
+		Scan(&job).Error
+	if err != nil || job.ID == 0 {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *jobRepository) Update(job *domain.Job, from ...domain.JobStatus) (bool, error) {
+	result := r.db.Model(job).
+		Where("status IN ?", from).
+		Select("status", "stage", "progress", "result", "error", "run_at", "finished_at", "updated_at").
+		Updates(job)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *jobRepository) Touch(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.Model(&domain.Job{}).
+		Where("id IN ? AND status = ?", ids, domain.JobRunning).
+		UpdateColumn("updated_at", time.Now()).Error
+}
+
+func (r *jobRepository) RequeueStale(before time.Time) (int64, []*domain.Job, error) {
+	const reason = "worker stopped responding"
+
+	requeued := r.db.Model(&domain.Job{}).
+		Where("status = ? AND updated_at < ? AND attempts < max_attempts", domain.JobRunning, before).
+		UpdateColumns(map[string]interface{}{
+			"status":      domain.JobQueued,
+			"finished_at": nil,
+			"error":       reason,
+			"run_at":      time.Now(),
+		})
+	if requeued.Error != nil {
+		return 0, nil, requeued.Error
+	}
+
+	// Failed jobs are returned so their handlers can clean up
+	var failed []*domain.Job
+	err := r.db.Raw(`
+		UPDATE jobs SET status = ?, finished_at = NOW(), error = ?, run_at = NOW()
+		WHERE status = ? AND updated_at < ? AND attempts >= max_attempts
+		RETURNING *`, domain.JobFailed, reason, domain.JobRunning, before).
+		Scan(&failed).Error
+	if err != nil {
+		return requeued.RowsAffected, nil, err
+	}
+	return requeued.RowsAffected, failed, nil
+}
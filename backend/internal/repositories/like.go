@@ -0,0 +1,12 @@
+package repositories
+
+import "strings"
+
+// likeEscaper escapes the wildcards of LIKE patterns and the backslash that
+// escapes them, so queries match literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// containsPattern returns a LIKE pattern matching values containing the query
+func containsPattern(query string) string {
+	return "%" + likeEscaper.Replace(query) + "%"
+}
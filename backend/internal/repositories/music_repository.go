@@ -1,8 +1,6 @@
 package repositories
 
 import (
-	"strings"
-
 	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
 	"gorm.io/gorm"
 )
@@ -22,7 +20,7 @@ func (r *musicRepository) Create(music *domain.Music) error {
 
 func (r *musicRepository) FindByID(id uint) (*domain.Music, error) {
 	var music domain.Music
-	err := r.db.Preload("Artist").First(&music, id).Error
+	err := preloadArtists(r.db).First(&music, id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -31,36 +29,117 @@ func (r *musicRepository) FindByID(id uint) (*domain.Music, error) {
 
 func (r *musicRepository) FindAll() ([]*domain.Music, error) {
 	var music []*domain.Music
-	err := r.db.Preload("Artist").Find(&music).Error
+	err := preloadArtists(r.db).Find(&music).Error
 	return music, err
 }
 
-func (r *musicRepository) Delete(id uint) error {
-	// Delete all playlist associations
-	if err := r.db.Where("music_id = ?", id).Delete(&domain.PlaylistMusic{}).Error; err != nil {
-		return err
-	}
-	// Delete the music record
-	return r.db.Delete(&domain.Music{}, id).Error
+func (r *musicRepository) Delete(id uint, release func() error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// Delete all playlist entries of the track
+		if err := tx.Where("music_id = ?", id).Delete(&domain.PlaylistEntry{}).Error; err != nil {
+			return err
+		}
+		// Delete the music record
+		if err := tx.Delete(&domain.Music{}, id).Error; err != nil {
+			return err
+		}
+		return release()
+	})
 }
 
-func (r *musicRepository) FindByUploader(username string) ([]*domain.Music, error) {
+func (r *musicRepository) FindByArtist(artistID uint) ([]*domain.Music, error) {
 	var music []*domain.Music
-	err := r.db.Preload("Artist").Where("uploaded_by = ?", username).Find(&music).Error
+	err := preloadArtists(r.db).
+		Where("artist_id = ? OR id IN (?)", artistID,
+			r.db.Model(&domain.TrackArtist{}).Select("music_id").Where("artist_id = ?", artistID)).
+		Find(&music).Error
 	return music, err
 }
 
-func (r *musicRepository) FindByArtist(artistID uint) ([]*domain.Music, error) {
-	var music []*domain.Music
-	err := r.db.Preload("Artist").Where("artist_id = ?", artistID).Find(&music).Error
-	return music, err
+// musicSortKeys are the keys music lists can be sorted by
+var musicSortKeys = map[string]sortKey[*domain.Music]{
+	domain.MusicSortCreatedAt: {
+		column:       "musics.created_at",
+		defaultOrder: domain.SortDesc,
+		value:        func(m *domain.Music) interface{} { return m.CreatedAt },
+		parse:        parseTimeValue,
+	},
+	domain.MusicSortTitle: {
+		column:       "musics.title",
+		defaultOrder: domain.SortAsc,
+		value:        func(m *domain.Music) interface{} { return m.Title },
+		parse:        parseStringValue,
+	},
+	domain.MusicSortDuration: {
+		column:       "musics.duration",
+		defaultOrder: domain.SortAsc,
+		value:        func(m *domain.Music) interface{} { return m.Duration },
+		parse:        parseFloatValue,
+	},
+	domain.MusicSortPlayCount: {
+		column:       "musics.play_count",
+		defaultOrder: domain.SortDesc,
+		value:        func(m *domain.Music) interface{} { return m.PlayCount },
+		parse:        parseIntValue,
+	},
 }
 
-func (r *musicRepository) FindByTitle(title string) ([]*domain.Music, error) {
-	var music []*domain.Music
-	search := "%" + strings.ReplaceAll(title, "%", "\\%") + "%"
-	err := r.db.Preload("Artist").Where("title ILIKE ?", search).Find(&music).Error
-	return music, err
+func (r *musicRepository) List(filter domain.MusicFilter, page domain.PageRequest) (*domain.Page[*domain.Music], error) {
+	query := preloadArtists(r.db).Model(&domain.Music{})
+
+	if filter.Query != "" {
+		search := containsPattern(filter.Query)
+		credited := r.db.Model(&domain.TrackArtist{}).
+			Select("track_artists.music_id").
+			Joins("JOIN artists ON artists.id = track_artists.artist_id").
+			Where("artists.name ILIKE ?", search)
+		query = query.Where("(musics.title ILIKE ? OR musics.id IN (?))", search, credited)
+	}
+	if filter.ArtistID != 0 {
+		query = query.Where("(musics.artist_id = ? OR musics.id IN (?))", filter.ArtistID,
+			r.db.Model(&domain.TrackArtist{}).Select("music_id").Where("artist_id = ?", filter.ArtistID))
+	}
+	if filter.AlbumID != 0 {
+		query = query.Where("musics.album_id = ?", filter.AlbumID)
+	}
+	if filter.UploadedBy != "" {
+		query = query.Where("musics.uploaded_by = ?", filter.UploadedBy)
+	}
+	if filter.MinDuration > 0 {
+		query = query.Where("musics.duration >= ?", filter.MinDuration)
+	}
+	if filter.MaxDuration > 0 {
+		query = query.Where("musics.duration <= ?", filter.MaxDuration)
+	}
+
+	return paginate(query, page, musicSortKeys, domain.MusicSortCreatedAt, "musics.id",
+		func(m *domain.Music) uint { return m.ID })
+}
+
+func (r *musicRepository) IncrementPlayCount(id uint) error {
+	return r.db.Model(&domain.Music{}).Where("id = ?", id).
+		UpdateColumn("play_count", gorm.Expr("play_count + 1")).Error
+}
+
+func (r *musicRepository) Count() (int64, error) {
+	var count int64
+	err := r.db.Model(&domain.Music{}).Count(&count).Error
+	return count, err
+}
+
+func (r *musicRepository) TotalDuration() (float64, error) {
+	var total float64
+	err := r.db.Model(&domain.Music{}).Select("COALESCE(SUM(duration), 0)").Scan(&total).Error
+	return total, err
+}
+
+func (r *musicRepository) FindByBlobID(blobID uint) (*domain.Music, error) {
+	var music domain.Music
+	err := preloadArtists(r.db).Where("blob_id = ?", blobID).Order("id").First(&music).Error
+	if err != nil {
+		return nil, err
+	}
+	return &music, nil
 }
 
 // GetFilePath returns the file path for a music record
@@ -71,3 +150,50 @@ func (r *musicRepository) GetFilePath(id uint) (string, error) {
 	}
 	return music.FilePath, nil
 }
+
+// preloadArtists loads the primary artist and all credits of the tracks
+func preloadArtists(db *gorm.DB) *gorm.DB {
+	return db.Preload("Artist").
+		Preload("Credits", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position")
+		}).
+		Preload("Credits.Artist")
+}
+
+func (r *musicRepository) FindUnanalyzed(afterID uint, limit int) ([]*domain.Music, error) {
+	var music []*domain.Music
+	err := r.db.Where("loudness IS NULL AND id > ?", afterID).Order("id").Limit(limit).Find(&music).Error
+	return music, err
+}
+
+func (r *musicRepository) UpdateLoudness(id uint, analysis *domain.LoudnessAnalysis) error {
+	return r.db.Model(&domain.Music{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+		"loudness":   analysis.Integrated,
+		"true_peak":  analysis.TruePeak,
+		"track_gain": analysis.TrackGain(),
+	}).Error
+}
+
+func (r *musicRepository) UpdateAlbumGain(albumID uint) error {
+	// The album is measured as one long track: the mean energy of its tracks
+	// weighted by their duration. Silent tracks are gated out like silent
+	// blocks are, an album of silence gets no gain
+	albumLoudness := r.db.Model(&domain.Music{}).
+		Select("10 * LOG(SUM(duration * POWER(10, loudness / 10)) / SUM(duration))").
+		Where("album_id = ? AND loudness > ? AND duration > 0", albumID, domain.AbsoluteGate)
+	return r.db.Model(&domain.Music{}).
+		Where("album_id = ? AND loudness IS NOT NULL", albumID).
+		UpdateColumn("album_gain", gorm.Expr("? - (?)", domain.ReferenceLoudness, albumLoudness)).Error
+}
+
+func (r *musicRepository) UploaderUsage(username string) (int64, int64, error) {
+	var usage struct {
+		Bytes  int64
+		Tracks int64
+	}
+	err := r.db.Model(&domain.Music{}).
+		Select("COALESCE(SUM(file_size), 0) AS bytes, COUNT(*) AS tracks").
+		Where("uploaded_by = ?", username).
+		Scan(&usage).Error
+	return usage.Bytes, usage.Tracks, err
+}
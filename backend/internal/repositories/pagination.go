@@ -0,0 +1,169 @@
+package repositories
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"gorm.io/gorm"
+)
+
+// sortKey describes a column a list can be sorted by
+type sortKey[T any] struct {
+	column       string
+	defaultOrder domain.SortOrder
+	// value returns the sort value of an item, stored in the cursor
+	value func(item T) interface{}
+	// parse reads a sort value back from a cursor
+	parse func(raw json.RawMessage) (interface{}, error)
+}
+
+// pageCursor is the decoded form of an opaque cursor: the sort value and ID
+// of the last item of a page. Sort and order are included so a cursor cannot
+// be reused with a different sort
+type pageCursor struct {
+	Sort  string           `json:"s"`
+	Order domain.SortOrder `json:"o"`
+	Value json.RawMessage  `json:"v"`
+	ID    uint             `json:"id"`
+}
+
+// paginate runs a keyset paginated query. Items are ordered by the sort
+// column and then by ID, and a page starts right after the cursor's item, so
+// pages stay stable while rows are added
+func paginate[T any](
+	query *gorm.DB,
+	page domain.PageRequest,
+	keys map[string]sortKey[T],
+	defaultSort string,
+	idColumn string,
+	idOf func(item T) uint,
+) (*domain.Page[T], error) {
+	sort := page.Sort
+	if sort == "" {
+		sort = defaultSort
+	}
+	key, ok := keys[sort]
+	if !ok {
+		return nil, domain.ErrInvalidSort
+	}
+
+	order := page.Order
+	if order == "" {
+		order = key.defaultOrder
+	}
+	if order != domain.SortAsc && order != domain.SortDesc {
+		return nil, domain.ErrInvalidSort
+	}
+
+	limit := page.Limit
+	if limit <= 0 {
+		limit = domain.DefaultPageLimit
+	}
+	if limit > domain.MaxPageLimit {
+		limit = domain.MaxPageLimit
+	}
+
+	direction, operator := "ASC", ">"
+	if order == domain.SortDesc {
+		direction, operator = "DESC", "<"
+	}
+
+	if page.Cursor != "" {
+		cursor, err := decodeCursor(page.Cursor)
+		if err != nil || cursor.Sort != sort || cursor.Order != order {
+			return nil, domain.ErrInvalidCursor
+		}
+		value, err := key.parse(cursor.Value)
+		if err != nil {
+			return nil, domain.ErrInvalidCursor
+		}
+		query = query.Where(
+			fmt.Sprintf("(%s %s ? OR (%s = ? AND %s %s ?))", key.column, operator, key.column, idColumn, operator),
+			value, value, cursor.ID,
+		)
+	}
+
+	// Fetch one extra item to know whether there is another page
+	var items []T
+	if err := query.
+		Order(key.column + " " + direction).
+		Order(idColumn + " " + direction).
+		Limit(limit + 1).
+		Find(&items).Error; err != nil {
+		return nil, err
+	}
+
+	result := &domain.Page[T]{Items: items}
+	if len(items) > limit {
+		result.Items = items[:limit]
+		result.HasMore = true
+
+		last := result.Items[limit-1]
+		cursor, err := encodeCursor(pageCursor{Sort: sort, Order: order, ID: idOf(last)}, key.value(last))
+		if err != nil {
+			return nil, err
+		}
+		result.NextCursor = cursor
+	}
+	if result.Items == nil {
+		result.Items = []T{}
+	}
+
+	return result, nil
+}
+
+func encodeCursor(cursor pageCursor, value interface{}) (string, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	cursor.Value = raw
+
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(encoded string) (*pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// Parsers of the sort values stored in cursors
+
+func parseTimeValue(raw json.RawMessage) (interface{}, error) {
+	var value time.Time
+	err := json.Unmarshal(raw, &value)
+	return value, err
+}
+
+func parseStringValue(raw json.RawMessage) (interface{}, error) {
+	var value string
+	err := json.Unmarshal(raw, &value)
+	return value, err
+}
+
+func parseFloatValue(raw json.RawMessage) (interface{}, error) {
+	var value float64
+	err := json.Unmarshal(raw, &value)
+	return value, err
+}
+
+func parseIntValue(raw json.RawMessage) (interface{}, error) {
+	var value int64
+	err := json.Unmarshal(raw, &value)
+	return value, err
+}
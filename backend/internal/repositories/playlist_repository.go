@@ -1,8 +1,14 @@
 package repositories
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type playlistRepository struct {
@@ -27,41 +33,116 @@ func (r *playlistRepository) FindByID(id uint) (*domain.Playlist, error) {
 	return &playlist, nil
 }
 
-func (r *playlistRepository) FindByCreator(username string) ([]*domain.Playlist, error) {
-	var playlists []*domain.Playlist
-	err := r.db.Where("created_by = ?", username).Find(&playlists).Error
-	if err != nil {
-		return nil, err
-	}
-	return playlists, nil
+// playlistSortKeys are the keys playlist lists can be sorted by
+var playlistSortKeys = map[string]sortKey[*domain.Playlist]{
+	domain.PlaylistSortCreatedAt: {
+		column:       "playlists.created_at",
+		defaultOrder: domain.SortDesc,
+		value:        func(p *domain.Playlist) interface{} { return p.CreatedAt },
+		parse:        parseTimeValue,
+	},
+	domain.PlaylistSortName: {
+		column:       "playlists.name",
+		defaultOrder: domain.SortAsc,
+		value:        func(p *domain.Playlist) interface{} { return p.Name },
+		parse:        parseStringValue,
+	},
+}
+
+func (r *playlistRepository) FindByMember(username string, page domain.PageRequest) (*domain.Page[*domain.Playlist], error) {
+	memberships := r.db.Model(&domain.PlaylistMember{}).
+		Select("playlist_id").
+		Where("username = ? AND accepted_at IS NOT NULL", username)
+	query := r.db.Model(&domain.Playlist{}).Where("created_by = ? OR id IN (?)", username, memberships)
+	return paginate(query, page, playlistSortKeys, domain.PlaylistSortCreatedAt, "playlists.id",
+		func(p *domain.Playlist) uint { return p.ID })
 }
 
 func (r *playlistRepository) Delete(id uint) error {
-	// First delete all songs in the playlist
-	if err := r.db.Where("playlist_id = ?", id).Delete(&domain.PlaylistMusic{}).Error; err != nil {
+	// First delete all entries and members of the playlist
+	if err := r.db.Where("playlist_id = ?", id).Delete(&domain.PlaylistEntry{}).Error; err != nil {
+		return err
+	}
+	if err := r.db.Where("playlist_id = ?", id).Delete(&domain.PlaylistMember{}).Error; err != nil {
 		return err
 	}
 	// Then delete the playlist
 	return r.db.Delete(&domain.Playlist{}, id).Error
 }
 
-func (r *playlistRepository) AddSong(playlistID, musicID uint) error {
-	playlistMusic := domain.PlaylistMusic{
-		PlaylistID: playlistID,
-		MusicID:    musicID,
+func (r *playlistRepository) AddEntry(entry *domain.PlaylistEntry) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockPlaylist(tx, entry.PlaylistID); err != nil {
+			return err
+		}
+
+		var last int64
+		if err := tx.Model(&domain.PlaylistEntry{}).
+			Where("playlist_id = ?", entry.PlaylistID).
+			Select("COALESCE(MAX(position), 0)").
+			Scan(&last).Error; err != nil {
+			return err
+		}
+
+		entry.Position = last + domain.PlaylistPositionGap
+		if entry.AddedAt.IsZero() {
+			entry.AddedAt = time.Now()
+		}
+		return tx.Create(entry).Error
+	})
+}
+
+func (r *playlistRepository) RemoveSong(playlistID, musicID uint) ([]uint, error) {
+	var removed []*domain.PlaylistEntry
+	err := r.db.Clauses(clause.Returning{Columns: []clause.Column{{Name: "id"}}}).
+		Where("playlist_id = ? AND music_id = ?", playlistID, musicID).
+		Delete(&removed).Error
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, len(removed))
+	for i, entry := range removed {
+		ids[i] = entry.ID
+	}
+	return ids, nil
+}
+
+func (r *playlistRepository) FindEntry(playlistID, entryID uint) (*domain.PlaylistEntry, error) {
+	var entry domain.PlaylistEntry
+	err := r.db.Where("playlist_id = ? AND id = ?", playlistID, entryID).First(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, domain.ErrPlaylistEntryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (r *playlistRepository) RemoveEntry(playlistID, entryID uint) error {
+	result := r.db.Where("playlist_id = ? AND id = ?", playlistID, entryID).
+		Delete(&domain.PlaylistEntry{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrPlaylistEntryNotFound
 	}
-	return r.db.Create(&playlistMusic).Error
+	return nil
 }
 
-func (r *playlistRepository) RemoveSong(playlistID, musicID uint) error {
-	return r.db.Where("playlist_id = ? AND music_id = ?", playlistID, musicID).
-		Delete(&domain.PlaylistMusic{}).Error
+func (r *playlistRepository) Count() (int64, error) {
+	var count int64
+	err := r.db.Model(&domain.Playlist{}).Count(&count).Error
+	return count, err
 }
 
 func (r *playlistRepository) GetSongs(playlistID uint) ([]*domain.Music, error) {
 	var songs []*domain.Music
-	err := r.db.Joins("JOIN playlist_musics ON playlist_musics.music_id = musics.id").
-		Where("playlist_musics.playlist_id = ?", playlistID).
+	err := r.db.Joins("JOIN playlist_entries ON playlist_entries.music_id = musics.id").
+		Where("playlist_entries.playlist_id = ?", playlistID).
+		Order("playlist_entries.position, playlist_entries.id").
 		Preload("Artist").
 		Find(&songs).Error
 	if err != nil {
@@ -69,3 +150,263 @@ func (r *playlistRepository) GetSongs(playlistID uint) ([]*domain.Music, error)
 	}
 	return songs, nil
 }
+
+// playlistSongSortKeys are the keys playlist songs can be sorted by. Songs
+// are paged through their entries since a song can be in a playlist twice
+var playlistSongSortKeys = map[string]sortKey[*domain.PlaylistEntry]{
+	domain.PlaylistSongSortPosition: {
+		column:       "playlist_entries.position",
+		defaultOrder: domain.SortAsc,
+		value:        func(e *domain.PlaylistEntry) interface{} { return e.Position },
+		parse:        parseIntValue,
+	},
+}
+
+func (r *playlistRepository) ListSongs(playlistID uint, page domain.PageRequest) (*domain.Page[*domain.Music], error) {
+	query := r.db.Model(&domain.PlaylistEntry{}).
+		Joins("JOIN musics ON musics.id = playlist_entries.music_id AND musics.deleted_at IS NULL").
+		Where("playlist_entries.playlist_id = ?", playlistID).
+		Preload("Music.Artist")
+	entries, err := paginate(query, page, playlistSongSortKeys, domain.PlaylistSongSortPosition, "playlist_entries.id",
+		func(e *domain.PlaylistEntry) uint { return e.ID })
+	if err != nil {
+		return nil, err
+	}
+
+	songs := &domain.Page[*domain.Music]{
+		Items:      make([]*domain.Music, 0, len(entries.Items)),
+		NextCursor: entries.NextCursor,
+		HasMore:    entries.HasMore,
+	}
+	for _, entry := range entries.Items {
+		songs.Items = append(songs.Items, entry.Music)
+	}
+	return songs, nil
+}
+
+func (r *playlistRepository) GetEntries(playlistID uint) ([]*domain.PlaylistEntry, error) {
+	var entries []*domain.PlaylistEntry
+	err := r.db.Where("playlist_id = ?", playlistID).
+		Order("position, id").
+		Preload("Music.Artist").
+		Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (r *playlistRepository) MoveEntry(playlistID, entryID uint, index int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		entries, err := lockEntries(tx, playlistID)
+		if err != nil {
+			return err
+		}
+
+		// The entry is taken out and put back before the entry at index
+		var moved *domain.PlaylistEntry
+		others := make([]*domain.PlaylistEntry, 0, len(entries))
+		for _, entry := range entries {
+			if entry.ID == entryID {
+				moved = entry
+			} else {
+				others = append(others, entry)
+			}
+		}
+		if moved == nil {
+			return domain.ErrPlaylistEntryNotFound
+		}
+		index = max(0, min(index, len(others)))
+
+		if position, ok := positionAt(others, index); ok {
+			return tx.Model(&domain.PlaylistEntry{}).
+				Where("id = ?", moved.ID).
+				UpdateColumn("position", position).Error
+		}
+
+		// No room left between the neighbours, spread the whole playlist out
+		order := make([]uint, 0, len(entries))
+		for _, entry := range others[:index] {
+			order = append(order, entry.ID)
+		}
+		order = append(order, moved.ID)
+		for _, entry := range others[index:] {
+			order = append(order, entry.ID)
+		}
+		return renumberEntries(tx, order)
+	})
+}
+
+func (r *playlistRepository) ReorderEntries(playlistID uint, entryIDs []uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		entries, err := lockEntries(tx, playlistID)
+		if err != nil {
+			return err
+		}
+
+		if len(entryIDs) != len(entries) {
+			return domain.ErrInvalidPlaylistOrder
+		}
+		remaining := make(map[uint]bool, len(entries))
+		for _, entry := range entries {
+			remaining[entry.ID] = true
+		}
+		for _, id := range entryIDs {
+			if !remaining[id] {
+				return domain.ErrInvalidPlaylistOrder
+			}
+			delete(remaining, id)
+		}
+
+		return renumberEntries(tx, entryIDs)
+	})
+}
+
+func (r *playlistRepository) AddMember(member *domain.PlaylistMember) error {
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(member)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrPlaylistMemberExists
+	}
+	return nil
+}
+
+func (r *playlistRepository) FindMember(playlistID uint, username string) (*domain.PlaylistMember, error) {
+	var member domain.PlaylistMember
+	err := r.db.Where("playlist_id = ? AND username = ?", playlistID, username).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, domain.ErrPlaylistMemberNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (r *playlistRepository) FindMembers(playlistID uint) ([]*domain.PlaylistMember, error) {
+	var members []*domain.PlaylistMember
+	err := r.db.Where("playlist_id = ?", playlistID).
+		Order("invited_at, username").
+		Find(&members).Error
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func (r *playlistRepository) UpdateMember(member *domain.PlaylistMember) error {
+	return r.db.Model(member).
+		Select("role", "accepted_at").
+		Updates(member).Error
+}
+
+func (r *playlistRepository) RemoveMember(playlistID uint, username string) error {
+	result := r.db.Where("playlist_id = ? AND username = ?", playlistID, username).
+		Delete(&domain.PlaylistMember{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrPlaylistMemberNotFound
+	}
+	return nil
+}
+
+func (r *playlistRepository) FindInvitations(username string) ([]*domain.PlaylistMember, error) {
+	var invitations []*domain.PlaylistMember
+	err := r.db.Where("username = ? AND accepted_at IS NULL", username).
+		Order("invited_at DESC").
+		Preload("Playlist").
+		Find(&invitations).Error
+	if err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+func (r *playlistRepository) MemberRoles(username string, playlistIDs []uint) (map[uint]domain.PlaylistRole, error) {
+	roles := make(map[uint]domain.PlaylistRole)
+	if len(playlistIDs) == 0 {
+		return roles, nil
+	}
+
+	var members []*domain.PlaylistMember
+	err := r.db.Select("playlist_id", "role").
+		Where("username = ? AND playlist_id IN ? AND accepted_at IS NOT NULL", username, playlistIDs).
+		Find(&members).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		roles[member.PlaylistID] = member.Role
+	}
+	return roles, nil
+}
+
+// lockPlaylist locks a playlist row for the rest of the transaction, so
+// concurrent changes to its order are applied one after the other
+func lockPlaylist(tx *gorm.DB, playlistID uint) error {
+	var playlist domain.Playlist
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").
+		First(&playlist, playlistID).Error
+}
+
+// lockEntries locks a playlist and returns its entries in order
+func lockEntries(tx *gorm.DB, playlistID uint) ([]*domain.PlaylistEntry, error) {
+	if err := lockPlaylist(tx, playlistID); err != nil {
+		return nil, err
+	}
+
+	var entries []*domain.PlaylistEntry
+	err := tx.Select("id", "position").
+		Where("playlist_id = ?", playlistID).
+		Order("position, id").
+		Find(&entries).Error
+	return entries, err
+}
+
+// positionAt returns a position placing an entry before entries[index], or
+// false when its neighbours leave no room in between
+func positionAt(entries []*domain.PlaylistEntry, index int) (int64, bool) {
+	switch {
+	case len(entries) == 0:
+		return domain.PlaylistPositionGap, true
+	case index == 0:
+		return entries[0].Position - domain.PlaylistPositionGap, true
+	case index == len(entries):
+		return entries[index-1].Position + domain.PlaylistPositionGap, true
+	}
+
+	prev, next := entries[index-1].Position, entries[index].Position
+	if next-prev < 2 {
+		return 0, false
+	}
+	return prev + (next-prev)/2, true
+}
+
+// renumberEntriesBatch is the number of entries updated per statement
+const renumberEntriesBatch = 1000
+
+// renumberEntries gives the entries evenly spaced positions in the given order
+func renumberEntries(tx *gorm.DB, entryIDs []uint) error {
+	for start := 0; start < len(entryIDs); start += renumberEntriesBatch {
+		end := min(start+renumberEntriesBatch, len(entryIDs))
+
+		values := make([]string, 0, end-start)
+		args := make([]interface{}, 0, 2*(end-start))
+		for i := start; i < end; i++ {
+			values = append(values, "(?::bigint, ?::bigint)")
+			args = append(args, entryIDs[i], int64(i+1)*domain.PlaylistPositionGap)
+		}
+
+		query := fmt.Sprintf(`UPDATE playlist_entries SET position = v.position
+			FROM (VALUES %s) AS v(id, position) WHERE playlist_entries.id = v.id`, strings.Join(values, ", "))
+		if err := tx.Exec(query, args...).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
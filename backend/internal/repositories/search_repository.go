@@ -0,0 +1,87 @@
+package repositories
+
+import (
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"gorm.io/gorm"
+)
+
+type searchRepository struct {
+	db *gorm.DB
+}
+
+// NewSearchRepository creates a new instance of SearchRepository
+func NewSearchRepository(db *gorm.DB) domain.SearchRepository {
+	return &searchRepository{db: db}
+}
+
+// Rows match on the full-text vector or, to tolerate typos, on trigram
+// similarity of their name. The score adds up both kinds of relevance
+const (
+	searchTracksSQL = `SELECT id, ts_rank(search_vector, to_tsquery('simple', @ts_query)) + similarity(title, @text) AS score
+		FROM musics
+		WHERE deleted_at IS NULL AND (search_vector @@ to_tsquery('simple', @ts_query) OR title % @text)
+		ORDER BY score DESC, id LIMIT @limit`
+
+	searchArtistsSQL = `SELECT id, ts_rank(search_vector, to_tsquery('simple', @ts_query)) + similarity(name, @text) AS score
+		FROM artists
+		WHERE deleted_at IS NULL AND (search_vector @@ to_tsquery('simple', @ts_query) OR name % @text)
+		ORDER BY score DESC, id LIMIT @limit`
+
+	searchAlbumsSQL = `SELECT id, ts_rank(search_vector, to_tsquery('simple', @ts_query)) + similarity(title, @text) AS score
+		FROM albums
+		WHERE deleted_at IS NULL AND (search_vector @@ to_tsquery('simple', @ts_query) OR title % @text)
+		ORDER BY score DESC, id LIMIT @limit`
+
+	searchPlaylistsSQL = `SELECT id, ts_rank(search_vector, to_tsquery('simple', @ts_query)) + similarity(name, @text) AS score
+		FROM playlists
+		WHERE (created_by = @username OR id IN (
+			SELECT playlist_id FROM playlist_members WHERE username = @username AND accepted_at IS NOT NULL
+		)) AND (search_vector @@ to_tsquery('simple', @ts_query) OR name % @text)
+		ORDER BY score DESC, id LIMIT @limit`
+)
+
+func (r *searchRepository) SearchTracks(tsQuery, text string, limit int) ([]domain.SearchHit, error) {
+	return r.search(searchTracksSQL, map[string]interface{}{"ts_query": tsQuery, "text": text, "limit": limit})
+}
+
+func (r *searchRepository) SearchArtists(tsQuery, text string, limit int) ([]domain.SearchHit, error) {
+	return r.search(searchArtistsSQL, map[string]interface{}{"ts_query": tsQuery, "text": text, "limit": limit})
+}
+
+func (r *searchRepository) SearchAlbums(tsQuery, text string, limit int) ([]domain.SearchHit, error) {
+	return r.search(searchAlbumsSQL, map[string]interface{}{"ts_query": tsQuery, "text": text, "limit": limit})
+}
+
+func (r *searchRepository) SearchPlaylists(tsQuery, text, username string, limit int) ([]domain.SearchHit, error) {
+	return r.search(searchPlaylistsSQL, map[string]interface{}{"ts_query": tsQuery, "text": text, "username": username, "limit": limit})
+}
+
+func (r *searchRepository) search(query string, args map[string]interface{}) ([]domain.SearchHit, error) {
+	var hits []domain.SearchHit
+	err := r.db.Raw(query, args).Scan(&hits).Error
+	return hits, err
+}
+
+func (r *searchRepository) FindTracks(ids []uint) ([]*domain.Music, error) {
+	var tracks []*domain.Music
+	err := preloadArtists(r.db).Where("id IN ?", ids).Find(&tracks).Error
+	return tracks, err
+}
+
+func (r *searchRepository) FindArtists(ids []uint) ([]*domain.Artist, error) {
+	var artists []*domain.Artist
+	err := r.db.Where("id IN ?", ids).Find(&artists).Error
+	return artists, err
+}
+
+func (r *searchRepository) FindAlbums(ids []uint) ([]*domain.Album, error) {
+	var albums []*domain.Album
+	err := r.db.Preload("Artist").Where("id IN ?", ids).Find(&albums).Error
+	return albums, err
+}
+
+func (r *searchRepository) FindPlaylists(ids []uint) ([]*domain.Playlist, error) {
+	var playlists []*domain.Playlist
+	err := r.db.Where("id IN ?", ids).Find(&playlists).Error
+	return playlists, err
+}
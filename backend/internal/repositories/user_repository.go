@@ -34,3 +34,38 @@ func (r *userRepository) Delete(username string) error {
 func (r *userRepository) Update(user *domain.User) error {
 	return r.db.Save(user).Error
 }
+
+func (r *userRepository) FindAll() ([]*domain.User, error) {
+	var users []*domain.User
+	err := r.db.Order("created_at").Find(&users).Error
+	return users, err
+}
+
+func (r *userRepository) Count() (int64, error) {
+	var count int64
+	err := r.db.Model(&domain.User{}).Count(&count).Error
+	return count, err
+}
+
+func (r *userRepository) CountByRole() (map[domain.Role]int64, error) {
+	var rows []struct {
+		Role  domain.Role
+		Count int64
+	}
+	err := r.db.Model(&domain.User{}).Select("role, COUNT(*) AS count").Group("role").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[domain.Role]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Role] = row.Count
+	}
+	return counts, nil
+}
+
+func (r *userRepository) CountDisabled() (int64, error) {
+	var count int64
+	err := r.db.Model(&domain.User{}).Where("disabled_at IS NOT NULL").Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+)
+
+type adminService struct {
+	userRepo       domain.UserRepository
+	musicRepo      domain.MusicRepository
+	artistRepo     domain.ArtistRepository
+	albumRepo      domain.AlbumRepository
+	playlistRepo   domain.PlaylistRepository
+	sessionService domain.SessionService
+}
+
+// NewAdminService creates a new instance of AdminService
+func NewAdminService(
+	userRepo domain.UserRepository,
+	musicRepo domain.MusicRepository,
+	artistRepo domain.ArtistRepository,
+	albumRepo domain.AlbumRepository,
+	playlistRepo domain.PlaylistRepository,
+	sessionService domain.SessionService,
+) domain.AdminService {
+	return &adminService{
+		userRepo:       userRepo,
+		musicRepo:      musicRepo,
+		artistRepo:     artistRepo,
+		albumRepo:      albumRepo,
+		playlistRepo:   playlistRepo,
+		sessionService: sessionService,
+	}
+}
+
+func (s *adminService) ListUsers() ([]*domain.User, error) {
+	return s.userRepo.FindAll()
+}
+
+// SetUserRole changes the role of a user. Their sessions are revoked so
+// access tokens carrying the old role stop working immediately
+func (s *adminService) SetUserRole(actor domain.Actor, username string, role domain.Role) error {
+	if !role.IsValid() {
+		return errors.New("invalid role")
+	}
+
+	if actor.Username == username {
+		return errors.New("you cannot change your own role")
+	}
+
+	user, err := s.userRepo.FindByUsername(username)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	if user.Role == role {
+		return nil
+	}
+
+	user.Role = role
+	user.UpdatedAt = time.Now()
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+	return s.sessionService.RevokeAllSessions(username)
+}
+
+// SetUserDisabled disables or re-enables a user. Disabling a user revokes all
+// of their sessions so they are logged out immediately
+func (s *adminService) SetUserDisabled(actor domain.Actor, username string, disabled bool) error {
+	if actor.Username == username {
+		return errors.New("you cannot disable your own account")
+	}
+
+	user, err := s.userRepo.FindByUsername(username)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	if disabled {
+		now := time.Now()
+		user.DisabledAt = &now
+	} else {
+		user.DisabledAt = nil
+	}
+	user.UpdatedAt = time.Now()
+
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+
+	if disabled {
+		return s.sessionService.RevokeAllSessions(username)
+	}
+	return nil
+}
+
+func (s *adminService) GetSystemStats() (*domain.SystemStats, error) {
+	var (
+		stats domain.SystemStats
+		err   error
+	)
+
+	if stats.Users, err = s.userRepo.Count(); err != nil {
+		return nil, err
+	}
+	if stats.UsersByRole, err = s.userRepo.CountByRole(); err != nil {
+		return nil, err
+	}
+	if stats.DisabledUsers, err = s.userRepo.CountDisabled(); err != nil {
+		return nil, err
+	}
+	if stats.Tracks, err = s.musicRepo.Count(); err != nil {
+		return nil, err
+	}
+	if stats.TotalDuration, err = s.musicRepo.TotalDuration(); err != nil {
+		return nil, err
+	}
+	if stats.Artists, err = s.artistRepo.Count(); err != nil {
+		return nil, err
+	}
+	if stats.Albums, err = s.albumRepo.Count(); err != nil {
+		return nil, err
+	}
+	if stats.Playlists, err = s.playlistRepo.Count(); err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
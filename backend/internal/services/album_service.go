@@ -0,0 +1,89 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+)
+
+type albumService struct {
+	repo domain.AlbumRepository
+}
+
+// NewAlbumService creates a new instance of AlbumService
+func NewAlbumService(repo domain.AlbumRepository) domain.AlbumService {
+	return &albumService{repo: repo}
+}
+
+func (s *albumService) GetAlbum(id uint) (*domain.Album, error) {
+	album, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if album.Tracks, err = s.repo.FindTracks(album.ID); err != nil {
+		return nil, err
+	}
+	return album, nil
+}
+
+func (s *albumService) ListAlbums(query string, page domain.PageRequest) (*domain.Page[*domain.Album], error) {
+	return s.repo.List(query, page)
+}
+
+func (s *albumService) GetArtistAlbums(artistID uint) ([]*domain.Album, error) {
+	return s.repo.FindByArtist(artistID)
+}
+
+func (s *albumService) GetOrCreateAlbum(title string, artistID uint, year int, artworkID *uint) (*domain.Album, error) {
+	normalized := domain.NormalizeAlbumTitle(title)
+	if normalized == "" {
+		return nil, errors.New("album title is required")
+	}
+
+	// Try to find existing album
+	album, err := s.repo.FindByArtistAndTitle(artistID, normalized)
+	if err == nil {
+		return s.fillMissingDetails(album, year, artworkID)
+	}
+
+	// Create new album if not found
+	album = &domain.Album{
+		Title:           strings.Join(strings.Fields(title), " "),
+		NormalizedTitle: normalized,
+		ArtistID:        artistID,
+		Year:            year,
+		ArtworkID:       artworkID,
+	}
+	if err := s.repo.Create(album); err != nil {
+		// Another upload may have created the same album concurrently
+		if existing, findErr := s.repo.FindByArtistAndTitle(artistID, normalized); findErr == nil {
+			return s.fillMissingDetails(existing, year, artworkID)
+		}
+		return nil, err
+	}
+
+	return album, nil
+}
+
+// fillMissingDetails sets the year and artwork of an album that was created
+// from a track without them
+func (s *albumService) fillMissingDetails(album *domain.Album, year int, artworkID *uint) (*domain.Album, error) {
+	changed := false
+	if album.Year == 0 && year != 0 {
+		album.Year = year
+		changed = true
+	}
+	if album.ArtworkID == nil && artworkID != nil {
+		album.ArtworkID = artworkID
+		changed = true
+	}
+
+	if changed {
+		if err := s.repo.Update(album); err != nil {
+			return nil, err
+		}
+	}
+	return album, nil
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+)
+
+// artistCredit is an artist name parsed from an artist or title tag
+type artistCredit struct {
+	Name string
+	Role domain.ArtistRole
+}
+
+var (
+	// featuringPattern matches "feat. B", "ft. B", "featuring B", optionally in brackets
+	featuringPattern = regexp.MustCompile(`(?i)\s*[(\[]?\s*\b(?:feat\.?|ft\.?|featuring)\s+`)
+	// artistSeparatorPattern matches the separators between several artist names
+	artistSeparatorPattern = regexp.MustCompile(`\s*,\s*|\s+&\s+`)
+	// bracketPattern matches the bracketed parts of a title, e.g. "(X Remix)"
+	bracketPattern = regexp.MustCompile(`[(\[]([^)\]]+)[)\]]`)
+
+	titleFeaturingPattern = regexp.MustCompile(`(?i)^(?:feat\.?|ft\.?|featuring)\s+(.+)$`)
+	titleProducerPattern  = regexp.MustCompile(`(?i)^(?:prod\.?|produced)\s+(?:by\s+)?(.+)$`)
+	titleRemixPattern     = regexp.MustCompile(`(?i)^(.+?)\s+(?:remix|rmx)$`)
+)
+
+// parseArtistCredits splits an artist tag like "A & B feat. C" into credits.
+// exists reports whether a name belongs to a known artist; known names are
+// never split, so "Simon & Garfunkel" stays a single artist
+func parseArtistCredits(artists string, exists func(name string) bool) []artistCredit {
+	artists = strings.TrimSpace(artists)
+	if artists == "" {
+		return nil
+	}
+	if exists(artists) {
+		return []artistCredit{{Name: artists, Role: domain.ArtistRolePrimary}}
+	}
+
+	main, featured := artists, ""
+	if loc := featuringPattern.FindStringIndex(artists); loc != nil && loc[0] > 0 {
+		main = artists[:loc[0]]
+		featured = strings.TrimRight(strings.TrimSpace(artists[loc[1]:]), ")]")
+	}
+
+	credits := splitArtistNames(main, domain.ArtistRolePrimary, exists)
+	return append(credits, splitArtistNames(featured, domain.ArtistRoleFeatured, exists)...)
+}
+
+// parseTitleCredits finds featured artists, remixers and producers in the
+// bracketed parts of a title, e.g. "Song (feat. B) [C Remix]"
+func parseTitleCredits(title string, exists func(name string) bool) []artistCredit {
+	var credits []artistCredit
+	for _, match := range bracketPattern.FindAllStringSubmatch(title, -1) {
+		part := strings.TrimSpace(match[1])
+
+		if m := titleFeaturingPattern.FindStringSubmatch(part); m != nil {
+			credits = append(credits, splitArtistNames(m[1], domain.ArtistRoleFeatured, exists)...)
+		} else if m := titleProducerPattern.FindStringSubmatch(part); m != nil {
+			credits = append(credits, splitArtistNames(m[1], domain.ArtistRoleProducer, exists)...)
+		} else if m := titleRemixPattern.FindStringSubmatch(part); m != nil {
+			credits = append(credits, splitArtistNames(m[1], domain.ArtistRoleRemixer, exists)...)
+		}
+	}
+	return credits
+}
+
+func splitArtistNames(names string, role domain.ArtistRole, exists func(name string) bool) []artistCredit {
+	names = strings.TrimSpace(names)
+	if names == "" {
+		return nil
+	}
+
+	// Bounds of the names between the separators
+	var starts, ends []int
+	start := 0
+	for _, sep := range artistSeparatorPattern.FindAllStringIndex(names, -1) {
+		starts, ends = append(starts, start), append(ends, sep[0])
+		start = sep[1]
+	}
+	starts, ends = append(starts, start), append(ends, len(names))
+
+	// Join neighbouring parts back together when they form a known name, so
+	// "Earth, Wind & Fire, B" yields two artists rather than four
+	var credits []artistCredit
+	for i := 0; i < len(starts); i++ {
+		j := len(starts) - 1
+		for ; j > i; j-- {
+			if exists(names[starts[i]:ends[j]]) {
+				break
+			}
+		}
+
+		if name := strings.TrimSpace(names[starts[i]:ends[j]]); name != "" {
+			credits = append(credits, artistCredit{Name: name, Role: role})
+		}
+		i = j
+	}
+	return credits
+}
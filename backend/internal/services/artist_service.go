@@ -1,15 +1,24 @@
 package services
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
 	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
 )
 
 type artistService struct {
-	repo domain.ArtistRepository
+	repo           domain.ArtistRepository
+	artworkService domain.ArtworkService
 }
 
-func NewArtistService(repo domain.ArtistRepository) domain.ArtistService {
-	return &artistService{repo: repo}
+func NewArtistService(repo domain.ArtistRepository, artworkService domain.ArtworkService) domain.ArtistService {
+	return &artistService{
+		repo:           repo,
+		artworkService: artworkService,
+	}
 }
 
 func (s *artistService) CreateArtist(name string) (*domain.Artist, error) {
@@ -25,8 +34,8 @@ func (s *artistService) GetArtist(id uint) (*domain.Artist, error) {
 	return s.repo.FindByID(id)
 }
 
-func (s *artistService) SearchArtists(query string) ([]*domain.Artist, error) {
-	return s.repo.Search(query)
+func (s *artistService) SearchArtists(query string, page domain.PageRequest) (*domain.Page[*domain.Artist], error) {
+	return s.repo.Search(query, page)
 }
 
 func (s *artistService) GetOrCreateArtist(name string) (*domain.Artist, error) {
@@ -36,6 +45,154 @@ func (s *artistService) GetOrCreateArtist(name string) (*domain.Artist, error) {
 		return artist, nil
 	}
 
+	// Only keep the primary artist of names like "A feat. B"
+	if credits := parseArtistCredits(name, s.artistExists); len(credits) > 0 && credits[0].Name != name {
+		return s.findOrCreate(credits[0].Name)
+	}
+
 	// Create new artist if not found
 	return s.CreateArtist(name)
 }
+
+func (s *artistService) ResolveCredits(artists, title string) ([]*domain.TrackArtist, error) {
+	credits := parseArtistCredits(artists, s.artistExists)
+	if len(credits) == 0 {
+		return nil, errors.New("track has no artist")
+	}
+	credits = append(credits, parseTitleCredits(title, s.artistExists)...)
+
+	type creditKey struct {
+		artistID uint
+		role     domain.ArtistRole
+	}
+	seen := make(map[creditKey]bool)
+	primary := make(map[uint]bool)
+
+	var trackArtists []*domain.TrackArtist
+	for _, credit := range credits {
+		artist, err := s.findOrCreate(credit.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		// An artist credited twice, e.g. "A feat. B" titled "Song (feat. B)",
+		// is only listed once; primary artists are not also listed as featured
+		key := creditKey{artist.ID, credit.Role}
+		if seen[key] || (credit.Role == domain.ArtistRoleFeatured && primary[artist.ID]) {
+			continue
+		}
+		seen[key] = true
+		if credit.Role == domain.ArtistRolePrimary {
+			primary[artist.ID] = true
+		}
+
+		trackArtists = append(trackArtists, &domain.TrackArtist{
+			ArtistID: artist.ID,
+			Role:     credit.Role,
+			Position: len(trackArtists),
+			Artist:   artist,
+		})
+	}
+
+	return trackArtists, nil
+}
+
+func (s *artistService) findOrCreate(name string) (*domain.Artist, error) {
+	if artist, err := s.repo.FindByName(name); err == nil {
+		return artist, nil
+	}
+	return s.CreateArtist(name)
+}
+
+func (s *artistService) artistExists(name string) bool {
+	_, err := s.repo.FindByName(name)
+	return err == nil
+}
+
+func (s *artistService) UpdateArtist(id uint, update domain.ArtistUpdate) (*domain.Artist, error) {
+	artist, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, errors.New("artist not found")
+	}
+
+	if update.Name != nil {
+		name := strings.TrimSpace(*update.Name)
+		if name == "" {
+			return nil, errors.New("artist name cannot be empty")
+		}
+		if existing, err := s.repo.FindByName(name); err == nil && existing.ID != artist.ID {
+			return nil, domain.ErrArtistNameTaken
+		}
+		artist.Name = name
+	}
+
+	if update.Bio != nil {
+		artist.Bio = strings.TrimSpace(*update.Bio)
+	}
+
+	if update.Image != nil {
+		if *update.Image == "" {
+			artist.ImageID = nil
+		} else {
+			imageID, err := s.saveImage(*update.Image)
+			if err != nil {
+				return nil, err
+			}
+			artist.ImageID = imageID
+		}
+	}
+
+	if err := s.repo.Update(artist); err != nil {
+		return nil, err
+	}
+	return artist, nil
+}
+
+// saveImage stores a base64 encoded image, optionally given as a data URL
+func (s *artistService) saveImage(base64Image string) (*uint, error) {
+	// Strip the "data:image/png;base64," prefix of data URLs
+	if strings.HasPrefix(base64Image, "data:") {
+		if i := strings.Index(base64Image, ","); i >= 0 {
+			base64Image = base64Image[i+1:]
+		}
+	}
+
+	data, err := base64.StdEncoding.DecodeString(base64Image)
+	if err != nil {
+		return nil, errors.New("invalid image encoding")
+	}
+
+	artwork, err := s.artworkService.SaveArtwork(&domain.Picture{Data: data})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save image: %w", err)
+	}
+	return &artwork.ID, nil
+}
+
+func (s *artistService) MergeArtists(canonicalID uint, duplicateIDs []uint) (*domain.Artist, error) {
+	canonical, err := s.repo.FindByID(canonicalID)
+	if err != nil {
+		return nil, errors.New("canonical artist not found")
+	}
+
+	ids := make([]uint, 0, len(duplicateIDs))
+	for _, id := range duplicateIDs {
+		if id == canonicalID {
+			continue
+		}
+		if _, err := s.repo.FindByID(id); err != nil {
+			return nil, fmt.Errorf("artist %d not found", id)
+		}
+		ids = append(ids, id)
+	}
+
+	if len(ids) == 0 {
+		return nil, errors.New("no duplicate artists to merge")
+	}
+
+	if err := s.repo.Merge(canonical.ID, ids); err != nil {
+		return nil, err
+	}
+
+	return canonical, nil
+}
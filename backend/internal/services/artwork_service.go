@@ -0,0 +1,295 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"path"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	thumbnailQuality = 85
+	artworkPrefix    = "artwork"
+	// maxArtworkPixels caps the size of decoded images, a small file can
+	// declare dimensions that take gigabytes to decode
+	maxArtworkPixels = 40_000_000
+)
+
+type artworkService struct {
+	artworkRepo domain.ArtworkRepository
+	musicRepo   domain.MusicRepository
+	albumRepo   domain.AlbumRepository
+	artistRepo  domain.ArtistRepository
+	storage     domain.Storage
+}
+
+// NewArtworkService creates a new instance of ArtworkService
+func NewArtworkService(artworkRepo domain.ArtworkRepository, musicRepo domain.MusicRepository, albumRepo domain.AlbumRepository, artistRepo domain.ArtistRepository, storage domain.Storage) domain.ArtworkService {
+	return &artworkService{
+		artworkRepo: artworkRepo,
+		musicRepo:   musicRepo,
+		albumRepo:   albumRepo,
+		artistRepo:  artistRepo,
+		storage:     storage,
+	}
+}
+
+func (s *artworkService) SaveArtwork(picture *domain.Picture) (*domain.Artwork, error) {
+	sum := sha256.Sum256(picture.Data)
+	hash := hex.EncodeToString(sum[:])
+
+	// The same cover is usually embedded in every track of an album
+	if artwork, err := s.artworkRepo.FindByHash(hash); err == nil {
+		return artwork, nil
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(picture.Data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode artwork: %w", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || int64(config.Width)*int64(config.Height) > maxArtworkPixels {
+		return nil, fmt.Errorf("%w: %dx%d", domain.ErrArtworkTooLarge, config.Width, config.Height)
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(picture.Data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode artwork: %w", err)
+	}
+
+	key := path.Join(artworkPrefix, hash+"."+format)
+	if err := s.storage.Put(key, bytes.NewReader(picture.Data), int64(len(picture.Data)), "image/"+format); err != nil {
+		return nil, fmt.Errorf("failed to save artwork: %w", err)
+	}
+
+	for _, size := range domain.ArtworkSizes {
+		thumbnail, err := encodeThumbnail(img, size)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.storage.Put(thumbnailKey(hash, size), bytes.NewReader(thumbnail), int64(len(thumbnail)), "image/jpeg"); err != nil {
+			return nil, fmt.Errorf("failed to save thumbnail: %w", err)
+		}
+	}
+
+	artwork := &domain.Artwork{
+		Hash:     hash,
+		MimeType: "image/" + format,
+		Width:    img.Bounds().Dx(),
+		Height:   img.Bounds().Dy(),
+		FilePath: key,
+	}
+	if err := s.artworkRepo.Create(artwork); err != nil {
+		// Another upload may have stored the same artwork concurrently
+		if existing, findErr := s.artworkRepo.FindByHash(hash); findErr == nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+
+	return artwork, nil
+}
+
+func (s *artworkService) GetArtworkImage(id uint, size int) (*domain.ArtworkImage, error) {
+	artwork, err := s.artworkRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	size = nearestArtworkSize(size)
+	thumbnail, _, err := s.storage.Get(thumbnailKey(artwork.Hash, size))
+	if err != nil {
+		return nil, err
+	}
+	defer thumbnail.Close()
+
+	data, err := io.ReadAll(thumbnail)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.ArtworkImage{
+		Data:     data,
+		MimeType: "image/jpeg",
+		ETag:     fmt.Sprintf(`"%s-%d"`, artwork.Hash, size),
+	}, nil
+}
+
+func (s *artworkService) GetMusicCover(musicID uint, size int) (*domain.ArtworkImage, error) {
+	music, err := s.musicRepo.FindByID(musicID)
+	if err != nil {
+		return nil, err
+	}
+
+	if music.ArtworkID != nil {
+		if cover, err := s.GetArtworkImage(*music.ArtworkID, size); err == nil {
+			return cover, nil
+		}
+	}
+
+	// Tracks without embedded artwork share the cover of their album
+	if music.AlbumID != nil {
+		if album, err := s.albumRepo.FindByID(*music.AlbumID); err == nil && album.ArtworkID != nil {
+			if cover, err := s.GetArtworkImage(*album.ArtworkID, size); err == nil {
+				return cover, nil
+			}
+		}
+	}
+
+	return generatePlaceholder(fmt.Sprintf("music:%d:%s", music.ID, music.Title), nearestArtworkSize(size))
+}
+
+func (s *artworkService) GetAlbumCover(albumID uint, size int) (*domain.ArtworkImage, error) {
+	album, err := s.albumRepo.FindByID(albumID)
+	if err != nil {
+		return nil, err
+	}
+
+	if album.ArtworkID != nil {
+		if cover, err := s.GetArtworkImage(*album.ArtworkID, size); err == nil {
+			return cover, nil
+		}
+	}
+
+	return generatePlaceholder(fmt.Sprintf("album:%d:%s", album.ID, album.Title), nearestArtworkSize(size))
+}
+
+func (s *artworkService) GetArtistImage(artistID uint, size int) (*domain.ArtworkImage, error) {
+	artist, err := s.artistRepo.FindByID(artistID)
+	if err != nil {
+		return nil, err
+	}
+
+	if artist.ImageID != nil {
+		if picture, err := s.GetArtworkImage(*artist.ImageID, size); err == nil {
+			return picture, nil
+		}
+	}
+
+	return generatePlaceholder(fmt.Sprintf("artist:%d:%s", artist.ID, artist.Name), nearestArtworkSize(size))
+}
+
+func thumbnailKey(hash string, size int) string {
+	return path.Join(artworkPrefix, fmt.Sprintf("%s_%d.jpg", hash, size))
+}
+
+// nearestArtworkSize returns the smallest generated size that is at least the
+// requested size, or the largest one
+func nearestArtworkSize(size int) int {
+	for _, s := range domain.ArtworkSizes {
+		if size <= s {
+			return s
+		}
+	}
+	return domain.ArtworkSizes[len(domain.ArtworkSizes)-1]
+}
+
+// encodeThumbnail scales an image to fit in a size x size box and encodes it
+// as JPEG. Images smaller than the box are not upscaled
+func encodeThumbnail(img image.Image, size int) ([]byte, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > size || height > size {
+		scale := float64(size) / math.Max(float64(width), float64(height))
+		width = int(math.Max(1, math.Round(float64(width)*scale)))
+		height = int(math.Max(1, math.Round(float64(height)*scale)))
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	// JPEG has no alpha channel, so flatten transparent images onto white
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// generatePlaceholder draws a deterministic record-like image whose colors are
+// derived from the seed, so the same track always gets the same placeholder
+func generatePlaceholder(seed string, size int) (*domain.ArtworkImage, error) {
+	sum := sha256.Sum256([]byte(seed))
+	from := hslToRGB(float64(sum[0])/255*360, 0.55, 0.50)
+	to := hslToRGB(float64(sum[1])/255*360, 0.60, 0.25)
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	center := float64(size-1) / 2
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			// Diagonal gradient between the two colors
+			c := lerpColor(from, to, float64(x+y)/float64(2*(size-1)))
+
+			// Darken a disc with a light label in the middle
+			d := math.Hypot(float64(x)-center, float64(y)-center) / (float64(size) / 2)
+			switch {
+			case d < 0.12:
+				c = lerpColor(c, color.RGBA{255, 255, 255, 255}, 0.6)
+			case d < 0.7:
+				c = lerpColor(c, color.RGBA{0, 0, 0, 255}, 0.35)
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode placeholder: %w", err)
+	}
+
+	return &domain.ArtworkImage{
+		Data:        buf.Bytes(),
+		MimeType:    "image/png",
+		ETag:        fmt.Sprintf(`"placeholder-%s-%d"`, hex.EncodeToString(sum[:8]), size),
+		Placeholder: true,
+	}, nil
+}
+
+func lerpColor(a, b color.RGBA, t float64) color.RGBA {
+	lerp := func(x, y uint8) uint8 {
+		return uint8(math.Round(float64(x) + (float64(y)-float64(x))*t))
+	}
+	return color.RGBA{lerp(a.R, b.R), lerp(a.G, b.G), lerp(a.B, b.B), 255}
+}
+
+// hslToRGB converts a color with hue in degrees and saturation/lightness in [0, 1]
+func hslToRGB(h, s, l float64) color.RGBA {
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := l - c/2
+
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+
+	return color.RGBA{
+		R: uint8(math.Round((r + m) * 255)),
+		G: uint8(math.Round((g + m) * 255)),
+		B: uint8(math.Round((b + m) * 255)),
+		A: 255,
+	}
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+)
+
+// similarDurationTolerance is how far apart, in seconds, the durations of two
+// encodings of the same audio may be
+const similarDurationTolerance = 1.5
+
+type audioBlobService struct {
+	repo    domain.AudioBlobRepository
+	storage domain.Storage
+}
+
+// NewAudioBlobService creates a new instance of AudioBlobService
+func NewAudioBlobService(repo domain.AudioBlobRepository, storage domain.Storage) domain.AudioBlobService {
+	return &audioBlobService{
+		repo:    repo,
+		storage: storage,
+	}
+}
+
+func (s *audioBlobService) Store(filePath string, format domain.AudioFormat, duration float64) (*domain.AudioBlob, bool, error) {
+	hash, size, err := hashFile(filePath)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// The content is already stored
+	blob, err := s.repo.AcquireByHash(hash)
+	if err == nil {
+		return blob, true, nil
+	}
+	if !errors.Is(err, domain.ErrAudioBlobNotFound) {
+		return nil, false, err
+	}
+
+	// Fingerprinting is best effort, exact duplicates are still detected without it
+	fingerprint, err := computeFingerprint(filePath)
+	if err != nil {
+		log.Printf("Failed to fingerprint %s: %v", filePath, err)
+	}
+
+	// Blobs are spread over prefixes named after the first hash bytes
+	key := path.Join("audio", hash[:2], hash+format.Extension)
+	if err := putFile(s.storage, key, filePath, format.MimeType); err != nil {
+		return nil, false, fmt.Errorf("failed to store file: %w", err)
+	}
+
+	blob = &domain.AudioBlob{
+		Hash:        hash,
+		FilePath:    key,
+		Size:        size,
+		Duration:    duration,
+		Fingerprint: fingerprint,
+		RefCount:    1,
+	}
+	if err := s.repo.Create(blob); err != nil {
+		// Another upload may have stored the same content concurrently, the
+		// object then has the same content and must be kept
+		if existing, acquireErr := s.repo.AcquireByHash(hash); acquireErr == nil {
+			return existing, true, nil
+		}
+		s.storage.Delete(key)
+		return nil, false, err
+	}
+
+	return blob, false, nil
+}
+
+func (s *audioBlobService) FindSimilar(blob *domain.AudioBlob) ([]*domain.AudioBlob, error) {
+	if len(blob.Fingerprint) == 0 {
+		return nil, nil
+	}
+
+	candidates, err := s.repo.FindByDuration(blob.Duration-similarDurationTolerance, blob.Duration+similarDurationTolerance)
+	if err != nil {
+		return nil, err
+	}
+
+	var similar []*domain.AudioBlob
+	for _, candidate := range candidates {
+		if candidate.ID != blob.ID && fingerprintsMatch(blob.Fingerprint, candidate.Fingerprint) {
+			similar = append(similar, candidate)
+		}
+	}
+	return similar, nil
+}
+
+func (s *audioBlobService) Release(id uint) error {
+	// Files are removed while the blob is locked, so an upload of the same
+	// content waits and stores them again rather than reusing the blob
+	return s.repo.Release(id, func(blob *domain.AudioBlob) error {
+		if err := deleteHLSCache(s.storage, blob.FilePath); err != nil {
+			return err
+		}
+		if err := s.storage.Delete(waveformKey(blob.FilePath)); err != nil {
+			return err
+		}
+		return s.storage.Delete(blob.FilePath)
+	})
+}
+
+// hashFile returns the SHA-256 hash and size of a file
+func hashFile(filePath string) (string, int64, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// putFile uploads a local file to storage
+func putFile(storage domain.Storage, key, filePath, contentType string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return storage.Put(key, f, stat.Size(), contentType)
+}
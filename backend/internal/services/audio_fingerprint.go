@@ -0,0 +1,117 @@
+package services
+
+import "io"
+
+const (
+	// fingerprintWindow is the length of the audio windows compared, in seconds
+	fingerprintWindow = 0.1
+	// fingerprintLength is the number of windows fingerprinted, i.e. 30 seconds
+	fingerprintLength = 300
+	// minFingerprintBits is the shortest fingerprint overlap worth comparing
+	minFingerprintBits = 64
+	// maxFingerprintShift is the largest offset, in windows, fingerprints are
+	// aligned by when comparing them
+	maxFingerprintShift = 8
+	// fingerprintMaxDistance is the share of differing bits up to which two
+	// fingerprints are considered the same audio
+	fingerprintMaxDistance = 0.15
+	// silenceThreshold is the window energy below which audio counts as silent
+	silenceThreshold = 1e-6
+)
+
+// computeFingerprint derives an acoustic fingerprint from the decoded audio
+// of a file. The audio is cut into short windows and every bit tells whether
+// the energy rises from one window to the next. This survives re-encoding,
+// resampling and volume changes, which all keep the energy contour, so
+// re-encodes of a track can be matched while their bytes differ
+func computeFingerprint(filePath string) ([]byte, error) {
+	streamer, format, err := decodeAudio(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer streamer.Close()
+
+	windowSize := int(float64(format.SampleRate) * fingerprintWindow)
+	if windowSize <= 0 {
+		windowSize = 1
+	}
+
+	energies := make([]float64, 0, fingerprintLength+1)
+	buf := make([][2]float64, 4096)
+	var energy float64
+	filled := 0
+	leadingSilence := true
+
+	for len(energies) <= fingerprintLength {
+		n, ok := streamer.Stream(buf)
+		for _, sample := range buf[:n] {
+			mono := (sample[0] + sample[1]) / 2
+			energy += mono * mono
+			filled++
+			if filled < windowSize {
+				continue
+			}
+
+			// Encoders add different amounts of silence at the start, so
+			// fingerprints begin with the first audible window
+			energy /= float64(windowSize)
+			if !leadingSilence || energy > silenceThreshold {
+				leadingSilence = false
+				energies = append(energies, energy)
+			}
+			energy, filled = 0, 0
+		}
+		if !ok {
+			break
+		}
+	}
+	// The FLAC decoder reports the end of the stream as an error
+	if err := streamer.Err(); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	fingerprint := make([]byte, (len(energies)+6)/8)
+	for i := 1; i < len(energies); i++ {
+		if energies[i] > energies[i-1] {
+			fingerprint[(i-1)/8] |= 1 << ((i - 1) % 8)
+		}
+	}
+	return fingerprint, nil
+}
+
+// fingerprintDistance returns the share of differing bits of two
+// fingerprints. Encoders shift the audio slightly, so the fingerprints are
+// compared at several offsets and the best alignment is used. Fingerprints
+// too short to compare have a distance of 1
+func fingerprintDistance(a, b []byte) float64 {
+	best := 1.0
+	for shift := -maxFingerprintShift; shift <= maxFingerprintShift; shift++ {
+		differing, compared := 0, 0
+		for i := 0; i < len(a)*8; i++ {
+			j := i + shift
+			if j < 0 || j >= len(b)*8 {
+				continue
+			}
+			compared++
+			if fingerprintBit(a, i) != fingerprintBit(b, j) {
+				differing++
+			}
+		}
+
+		if compared >= minFingerprintBits {
+			if distance := float64(differing) / float64(compared); distance < best {
+				best = distance
+			}
+		}
+	}
+	return best
+}
+
+func fingerprintBit(fingerprint []byte, i int) byte {
+	return fingerprint[i/8] >> (i % 8) & 1
+}
+
+// fingerprintsMatch reports whether two fingerprints belong to the same audio
+func fingerprintsMatch(a, b []byte) bool {
+	return fingerprintDistance(a, b) <= fingerprintMaxDistance
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+)
+
+// sniffLength is how many bytes are inspected to detect a format
+const sniffLength = 64
+
+// detectAudioFormat detects the format of an audio file from its magic bytes
+func detectAudioFormat(filePath string) (domain.AudioFormat, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return domain.AudioFormat{}, err
+	}
+	defer f.Close()
+
+	return sniffAudioFormat(f)
+}
+
+// sniffAudioFormat detects the format of audio from its magic bytes. Only
+// the start of the data and the bytes following an ID3 tag are read
+func sniffAudioFormat(r io.ReaderAt) (domain.AudioFormat, error) {
+	header, err := readHeader(r, 0)
+	if err != nil {
+		return domain.AudioFormat{}, err
+	}
+
+	// ID3v2 tags are mostly found in MP3 files but some FLAC files carry
+	// one as well, so look at the data following the tag
+	if len(header) >= 10 && string(header[0:3]) == "ID3" {
+		tagSize := int64(header[6])<<21 | int64(header[7])<<14 | int64(header[8])<<7 | int64(header[9])
+		offset := 10 + tagSize
+		if header[5]&0x10 != 0 {
+			offset += 10 // Footer
+		}
+		if header, err = readHeader(r, offset); err != nil {
+			return domain.AudioFormat{}, err
+		}
+		// Encoders may pad the tag with zeros beyond its declared size
+		header = bytes.TrimLeft(header, "\x00")
+
+		switch {
+		case bytes.HasPrefix(header, []byte("fLaC")):
+			return domain.AudioFormatFLAC, nil
+		case len(header) == 0 || isMP3Frame(header):
+			return domain.AudioFormatMP3, nil
+		}
+		return domain.AudioFormat{}, domain.ErrUnsupportedAudioFormat
+	}
+
+	switch {
+	case len(header) >= 12 && string(header[0:4]) == "RIFF" && string(header[8:12]) == "WAVE":
+		return domain.AudioFormatWAV, nil
+	case bytes.HasPrefix(header, []byte("fLaC")):
+		return domain.AudioFormatFLAC, nil
+	case bytes.HasPrefix(header, []byte("OggS")):
+		// The first page of an Ogg stream holds the codec identification header,
+		// only Vorbis can be decoded
+		if bytes.Contains(header, []byte("\x01vorbis")) {
+			return domain.AudioFormatVorbis, nil
+		}
+	case isMP3Frame(header):
+		return domain.AudioFormatMP3, nil
+	}
+	return domain.AudioFormat{}, domain.ErrUnsupportedAudioFormat
+}
+
+// readHeader reads up to sniffLength bytes at offset
+func readHeader(r io.ReaderAt, offset int64) ([]byte, error) {
+	header := make([]byte, sniffLength)
+	n, err := r.ReadAt(header, offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return header[:n], nil
+}
+
+// isMP3Frame reports whether data starts with a valid MPEG audio frame header
+func isMP3Frame(data []byte) bool {
+	if len(data) < 4 || data[0] != 0xFF || data[1]&0xE0 != 0xE0 {
+		return false
+	}
+	version := data[1] >> 3 & 0x03
+	layer := data[1] >> 1 & 0x03
+	bitrate := data[2] >> 4
+	sampleRate := data[2] >> 2 & 0x03
+	// Layer 0 is reserved, which also rules out AAC in ADTS frames
+	return version != 1 && layer != 0 && bitrate != 0x0F && sampleRate != 0x03
+}
@@ -1,16 +1,17 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
 	"github.com/faiface/beep"
+	"github.com/faiface/beep/flac"
 	"github.com/faiface/beep/mp3"
 	"github.com/faiface/beep/vorbis"
 	"github.com/faiface/beep/wav"
@@ -18,9 +19,18 @@ import (
 
 // FileService handles file system operations
 type FileService interface {
-	DownloadFile(url string, filePath string, linkValidator domain.LinkValidator) (string, error)
+	// DownloadFile downloads a URL to a local file in chunks, reporting the
+	// bytes written after every chunk. Requests go through the fetcher and
+	// its policy. It stops when the context is canceled
+	DownloadFile(ctx context.Context, url string, filePath string, fetcher domain.RemoteFetcher, progress func(written, total int64)) (string, error)
 	SaveFile(filePath string, content []byte) error
 	CalculateAudioDuration(filePath string) (float64, error)
+	// DetectAudioFormat detects the format of an audio file from its content,
+	// returning domain.ErrUnsupportedAudioFormat for anything that cannot be streamed
+	DetectAudioFormat(filePath string) (domain.AudioFormat, error)
+	// AnalyzeLoudness measures the integrated loudness and true peak of an
+	// audio file per EBU R128
+	AnalyzeLoudness(filePath string) (*domain.LoudnessAnalysis, error)
 	ValidateAudioFile(extension string) error
 	EnsureDirectoryExists(dir string) error
 	DeleteFile(filePath string) error
@@ -28,20 +38,17 @@ type FileService interface {
 }
 
 type fileService struct {
-	client            *http.Client
 	allowedExtensions map[string]bool
 }
 
 // NewFileService creates a new instance of FileService
 func NewFileService() FileService {
 	return &fileService{
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
 		allowedExtensions: map[string]bool{
-			".mp3": true,
-			".wav": true,
-			".ogg": true,
+			".mp3":  true,
+			".wav":  true,
+			".ogg":  true,
+			".flac": true,
 		},
 	}
 }
@@ -51,39 +58,74 @@ func (s *fileService) SaveFile(filePath string, content []byte) error {
 }
 
 func (s *fileService) CalculateAudioDuration(filename string) (float64, error) {
-	f, err := os.Open(filename)
+	streamer, format, err := decodeAudio(filename)
 	if err != nil {
 		return 0, err
 	}
-	defer f.Close()
+	defer streamer.Close()
+
+	duration := float64(streamer.Len()) / float64(format.SampleRate)
+	return duration, nil
+}
+
+func (s *fileService) DetectAudioFormat(filePath string) (domain.AudioFormat, error) {
+	return detectAudioFormat(filePath)
+}
+
+func (s *fileService) AnalyzeLoudness(filePath string) (*domain.LoudnessAnalysis, error) {
+	return analyzeLoudness(filePath)
+}
+
+// decodeAudio opens an audio file for decoding. The decoder is picked by the
+// content of the file rather than its extension. Closing the streamer also
+// closes the file
+func decodeAudio(filename string) (beep.StreamSeekCloser, beep.Format, error) {
+	audioFormat, err := detectAudioFormat(filename)
+	if err != nil {
+		return nil, beep.Format{}, err
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, beep.Format{}, err
+	}
 
 	var streamer beep.StreamSeekCloser
 	var format beep.Format
 
-	ext := strings.ToLower(filepath.Ext(filename))
-	switch ext {
-	case ".mp3":
+	switch audioFormat.Container {
+	case domain.AudioFormatMP3.Container:
 		streamer, format, err = mp3.Decode(f)
-	case ".wav":
+	case domain.AudioFormatWAV.Container:
 		streamer, format, err = wav.Decode(f)
-	case ".ogg":
+	case domain.AudioFormatVorbis.Container:
 		streamer, format, err = vorbis.Decode(f)
+	case domain.AudioFormatFLAC.Container:
+		streamer, format, err = flac.Decode(f)
 	default:
-		return 0, fmt.Errorf("unsupported file format: %s", ext)
+		err = domain.ErrUnsupportedAudioFormat
 	}
 
 	if err != nil {
-		return 0, err
+		f.Close()
+		return nil, beep.Format{}, err
 	}
-	defer streamer.Close()
+	return streamer, format, nil
+}
 
-	duration := float64(streamer.Len()) / float64(format.SampleRate)
-	return duration, nil
+// decodedLevelScale returns the factor decoded samples must be multiplied by
+// to get their true level. The beep WAV decoder divides 16 and 24 bit samples
+// by 2^16-1 and 2^24-1 instead of 2^15 and 2^23, halving their level
+func decodedLevelScale(audioFormat domain.AudioFormat, format beep.Format) float64 {
+	if audioFormat == domain.AudioFormatWAV && format.Precision > 1 {
+		return 2
+	}
+	return 1
 }
 
 func (s *fileService) ValidateAudioFile(extension string) error {
 	if !s.allowedExtensions[strings.ToLower(extension)] {
-		return fmt.Errorf("invalid file type. Only MP3, WAV, and OGG files are allowed")
+		return fmt.Errorf("invalid file type. Only MP3, WAV, OGG and FLAC files are allowed")
 	}
 	return nil
 }
@@ -100,62 +142,71 @@ func (s *fileService) DeleteFile(filePath string) error {
 	return nil
 }
 
-// downloadChunk downloads a chunk of the file
-func (s *fileService) downloadChunk(url string, start, end int64, file *os.File) error {
-	req, err := http.NewRequest("GET", url, nil)
+// downloadChunk downloads a chunk of the file, returning the number of bytes
+// written. A server ignoring ranges sends the rest of the file up to total
+func (s *fileService) downloadChunk(ctx context.Context, url string, start, end, total int64, file *os.File, fetcher domain.RemoteFetcher) (int64, error) {
+	// 5 minutes timeout for each chunk
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return 0, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set range header for chunked download
 	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
 
-	// Create a client with a longer timeout for chunk downloads
-	client := &http.Client{
-		Timeout: 5 * time.Minute, // 5 minutes timeout for each chunk
-	}
-
-	resp, err := client.Do(req)
+	resp, err := fetcher.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to download chunk: %w", err)
+		return 0, fmt.Errorf("failed to download chunk: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+	case resp.StatusCode == http.StatusOK && start == 0:
+		// The server ignores ranges and sends the whole file at once
+		end = total - 1
+	default:
+		return 0, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
 	// Seek to the correct position in the file
 	if _, err := file.Seek(start, 0); err != nil {
-		return fmt.Errorf("failed to seek in file: %w", err)
+		return 0, fmt.Errorf("failed to seek in file: %w", err)
 	}
 
-	// Copy the chunk to the file
-	if _, err := io.Copy(file, resp.Body); err != nil {
-		return fmt.Errorf("failed to write chunk: %w", err)
+	// Copy the chunk to the file, never more than was asked for
+	written, err := io.Copy(file, io.LimitReader(resp.Body, end-start+1))
+	if err != nil {
+		return written, fmt.Errorf("failed to write chunk: %w", err)
+	}
+	if written == 0 {
+		return 0, fmt.Errorf("failed to download chunk: empty response")
 	}
 
-	return nil
+	return written, nil
 }
 
 // DownloadFile downloads a file from the provided URL
-func (s *fileService) DownloadFile(url string, filePath string, linkValidator domain.LinkValidator) (string, error) {
+func (s *fileService) DownloadFile(ctx context.Context, url string, filePath string, fetcher domain.RemoteFetcher, progress func(written, total int64)) (string, error) {
 	// Validate the URL
-	if err := linkValidator.ValidateLink(url); err != nil {
+	if err := fetcher.ValidateLink(ctx, url); err != nil {
 		return "", fmt.Errorf("invalid music URL: %w", err)
 	}
 
 	// Get file size
-	req, err := http.NewRequest("HEAD", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
 
-	resp, err := s.client.Do(req)
+	resp, err := fetcher.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to get file size: %w", err)
 	}
-	defer resp.Body.Close()
+	resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		return "", fmt.Errorf("failed to get file size: status code %d", resp.StatusCode)
@@ -165,6 +216,9 @@ func (s *fileService) DownloadFile(url string, filePath string, linkValidator do
 	if contentLength <= 0 {
 		return "", fmt.Errorf("invalid content length")
 	}
+	if contentLength > fetcher.MaxSize() {
+		return "", fmt.Errorf("%w: %d bytes, at most %d allowed", domain.ErrRemoteFileTooLarge, contentLength, fetcher.MaxSize())
+	}
 
 	// Create the file
 	file, err := os.Create(filePath)
@@ -177,8 +231,8 @@ func (s *fileService) DownloadFile(url string, filePath string, linkValidator do
 	chunkSize := int64(5 * 1024 * 1024)
 	maxRetries := 3
 
-	// Download in chunks
-	for start := int64(0); start < contentLength; start += chunkSize {
+	// Download in chunks. A chunk cut short is resumed where it ended
+	for start := int64(0); start < contentLength; {
 		end := start + chunkSize - 1
 		if end >= contentLength {
 			end = contentLength - 1
@@ -186,18 +240,27 @@ func (s *fileService) DownloadFile(url string, filePath string, linkValidator do
 
 		var lastErr error
 		for retry := 0; retry < maxRetries; retry++ {
-			err := s.downloadChunk(url, start, end, file)
-			if err == nil {
+			var written int64
+			written, lastErr = s.downloadChunk(ctx, url, start, end, contentLength, file, fetcher)
+			start += written
+			if lastErr == nil {
 				break
 			}
-			lastErr = err
-			time.Sleep(time.Second * time.Duration(retry+1)) // Exponential backoff
+
+			select {
+			case <-ctx.Done():
+				lastErr = ctx.Err()
+			case <-time.After(time.Second * time.Duration(retry+1)): // Exponential backoff
+				continue
+			}
+			break
 		}
 
 		if lastErr != nil {
 			os.Remove(filePath) // Clean up the file
 			return "", fmt.Errorf("failed to download chunk after %d retries: %w", maxRetries, lastErr)
 		}
+		progress(start, contentLength)
 	}
 
 	return filePath, nil
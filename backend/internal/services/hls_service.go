@@ -0,0 +1,227 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strings"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+)
+
+// DefaultHLSSegmentDuration is the target length of HLS segments in seconds
+const DefaultHLSSegmentDuration = 6.0
+
+// hlsPrefix is the storage prefix segments and indexes are cached under
+const hlsPrefix = "hls"
+
+// hlsIndex lists the segments a track is cut into
+type hlsIndex struct {
+	Segments []hlsSegment `json:"segments"`
+}
+
+// hlsSegment is a run of whole frames of the original file
+type hlsSegment struct {
+	Offset    int64   `json:"offset"`
+	Size      int64   `json:"size"`
+	StartTime float64 `json:"start_time"` // In seconds
+	Duration  float64 `json:"duration"`   // In seconds
+}
+
+type hlsService struct {
+	storage         domain.Storage
+	segmentDuration float64
+}
+
+// NewHLSService creates a new instance of HLSService
+func NewHLSService(storage domain.Storage, segmentDuration float64) domain.HLSService {
+	return &hlsService{
+		storage:         storage,
+		segmentDuration: segmentDuration,
+	}
+}
+
+func (s *hlsService) GetPlaylist(music *domain.Music, segmentQuery string) ([]byte, error) {
+	index, err := s.getIndex(music)
+	if err != nil {
+		return nil, err
+	}
+
+	targetDuration := 0.0
+	for _, segment := range index.Segments {
+		targetDuration = math.Max(targetDuration, segment.Duration)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("#EXTM3U\n")
+	buf.WriteString("#EXT-X-VERSION:3\n")
+	fmt.Fprintf(&buf, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(targetDuration)))
+	buf.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n")
+	buf.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+	if segmentQuery != "" {
+		segmentQuery = "?" + segmentQuery
+	}
+	for i, segment := range index.Segments {
+		fmt.Fprintf(&buf, "#EXTINF:%.3f,\nsegments/%d.mp3%s\n", segment.Duration, i, segmentQuery)
+	}
+	buf.WriteString("#EXT-X-ENDLIST\n")
+	return buf.Bytes(), nil
+}
+
+func (s *hlsService) GetSegment(music *domain.Music, i int) (io.ReadCloser, *domain.ObjectInfo, error) {
+	key := path.Join(hlsCacheDir(music.FilePath), fmt.Sprintf("%d.mp3", i))
+	if segment, info, err := s.storage.Get(key); err == nil {
+		return segment, info, nil
+	}
+
+	index, err := s.getIndex(music)
+	if err != nil {
+		return nil, nil, err
+	}
+	if i < 0 || i >= len(index.Segments) {
+		return nil, nil, domain.ErrObjectNotFound
+	}
+	segment := index.Segments[i]
+
+	frames, err := s.storage.Range(music.FilePath, segment.Offset, segment.Size)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer frames.Close()
+
+	// Packed audio segments start with a timestamp so players can place them
+	var buf bytes.Buffer
+	buf.Write(hlsTimestampTag(segment.StartTime))
+	if _, err := io.Copy(&buf, frames); err != nil {
+		return nil, nil, fmt.Errorf("failed to read segment: %w", err)
+	}
+
+	if err := s.storage.Put(key, bytes.NewReader(buf.Bytes()), int64(buf.Len()), "audio/mpeg"); err != nil {
+		return nil, nil, fmt.Errorf("failed to cache segment: %w", err)
+	}
+	return s.storage.Get(key)
+}
+
+// getIndex loads the cached segment index of a track, cutting the track into
+// segments on first use
+func (s *hlsService) getIndex(music *domain.Music) (*hlsIndex, error) {
+	if music.MimeType != "" && music.MimeType != domain.AudioFormatMP3.MimeType {
+		return nil, domain.ErrHLSUnsupported
+	}
+
+	key := path.Join(hlsCacheDir(music.FilePath), "index.json")
+	if cached, _, err := s.storage.Get(key); err == nil {
+		defer cached.Close()
+		var index hlsIndex
+		if err := json.NewDecoder(cached).Decode(&index); err == nil {
+			return &index, nil
+		}
+	}
+
+	file, _, err := s.storage.Get(music.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	frames, err := scanMP3Frames(file)
+	if err != nil {
+		return nil, domain.ErrHLSUnsupported
+	}
+	index := buildHLSIndex(frames, s.segmentDuration)
+
+	data, err := json.Marshal(index)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storage.Put(key, bytes.NewReader(data), int64(len(data)), "application/json"); err != nil {
+		return nil, fmt.Errorf("failed to cache HLS index: %w", err)
+	}
+	return index, nil
+}
+
+// buildHLSIndex groups frames into segments of about the target duration.
+// Segments always end on a frame boundary
+func buildHLSIndex(frames []mp3Frame, target float64) *hlsIndex {
+	index := &hlsIndex{}
+	var current *hlsSegment
+	elapsed := 0.0
+
+	for _, frame := range frames {
+		if current == nil || current.Duration >= target {
+			index.Segments = append(index.Segments, hlsSegment{Offset: frame.Offset, StartTime: elapsed})
+			current = &index.Segments[len(index.Segments)-1]
+		}
+
+		// Frames need not be contiguous, so the segment spans up to the end
+		// of its last frame
+		duration := float64(frame.Samples) / float64(frame.SampleRate)
+		current.Size = frame.Offset + int64(frame.Size) - current.Offset
+		current.Duration += duration
+		elapsed += duration
+	}
+	return index
+}
+
+// hlsCacheDir returns the storage prefix the segments of an audio file are
+// cached under. It is derived from the file so duplicates share segments
+func hlsCacheDir(filePath string) string {
+	return path.Join(hlsPrefix, strings.TrimSuffix(filePath, path.Ext(filePath)))
+}
+
+// deleteHLSCache removes the cached index and segments of an audio file.
+// Segments are only cached once the index is, so the index lists them all
+func deleteHLSCache(storage domain.Storage, filePath string) error {
+	dir := hlsCacheDir(filePath)
+	indexKey := path.Join(dir, "index.json")
+
+	cached, _, err := storage.Get(indexKey)
+	if errors.Is(err, domain.ErrObjectNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// Segments of an unreadable index cannot be found, only the index is
+	// removed then
+	var index hlsIndex
+	_ = json.NewDecoder(cached).Decode(&index)
+	cached.Close()
+
+	for i := range index.Segments {
+		if err := storage.Delete(path.Join(dir, fmt.Sprintf("%d.mp3", i))); err != nil {
+			return err
+		}
+	}
+	return storage.Delete(indexKey)
+}
+
+// hlsTimestampTag builds the ID3 tag HLS packed audio segments start with,
+// holding the presentation time of the first sample on the 90 kHz MPEG clock
+func hlsTimestampTag(startTime float64) []byte {
+	const owner = "com.apple.streaming.transportStreamTimestamp"
+
+	var pts [8]byte
+	binary.BigEndian.PutUint64(pts[:], uint64(math.Round(startTime*90000))&(1<<33-1))
+
+	frameSize := len(owner) + 1 + len(pts)
+	tag := make([]byte, 0, 20+frameSize)
+	tag = append(tag, 'I', 'D', '3', 4, 0, 0)
+	tag = append(tag, syncsafe(10+frameSize)...)
+	tag = append(tag, 'P', 'R', 'I', 'V')
+	tag = append(tag, syncsafe(frameSize)...)
+	tag = append(tag, 0, 0)
+	tag = append(tag, owner...)
+	tag = append(tag, 0)
+	return append(tag, pts[:]...)
+}
+
+// syncsafe encodes a size as an ID3v2 synchsafe integer
+func syncsafe(n int) []byte {
+	return []byte{byte(n >> 21 & 0x7F), byte(n >> 14 & 0x7F), byte(n >> 7 & 0x7F), byte(n & 0x7F)}
+}
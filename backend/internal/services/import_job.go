@@ -0,0 +1,317 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// importJobType is the type of jobs ingesting the tracks of a ZIP archive
+// and recreating the playlists found in it
+const importJobType = "import"
+
+// Stages of import jobs, ingesting each track goes through the ingest stages
+const (
+	importStageReading   = "reading"
+	importStagePlaylists = "playlists"
+)
+
+const (
+	// DefaultMaxImportSize caps the request body of an archive upload
+	DefaultMaxImportSize int64 = 4 << 30
+	// maxImportEntries is the number of files an archive may hold
+	maxImportEntries = 5000
+	// maxPlaylistFileSize caps playlist files, which are read into memory
+	maxPlaylistFileSize = 1 << 20
+)
+
+// Outcomes of the files of an import
+const (
+	importFileImported  = "imported"
+	importFileDuplicate = "duplicate"
+	importFileFailed    = "failed"
+	importFileSkipped   = "skipped"
+)
+
+// importPayload is the input of an import job
+type importPayload struct {
+	StagedFile   string `json:"staged_file"`
+	OriginalName string `json:"original_name"`
+}
+
+// importFileResult is the outcome of one file of an archive
+type importFileResult struct {
+	Path    string `json:"path"`
+	Status  string `json:"status"`
+	MusicID *uint  `json:"music_id,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// importPlaylistResult is a playlist recreated from an archive
+type importPlaylistResult struct {
+	Path       string   `json:"path"`
+	PlaylistID *uint    `json:"playlist_id,omitempty"`
+	Name       string   `json:"name"`
+	Tracks     int      `json:"tracks"`
+	Missing    []string `json:"missing,omitempty"` // Entries not matching an imported track
+	Error      string   `json:"error,omitempty"`
+}
+
+// importResult is the result of an import job
+type importResult struct {
+	Files     []*importFileResult     `json:"files"`
+	Playlists []*importPlaylistResult `json:"playlists"`
+}
+
+// importJobHandler runs import jobs. A file that fails does not fail the
+// job, its error is reported in the result instead
+type importJobHandler struct {
+	uploads         *uploadService
+	fileService     FileService
+	musicService    domain.MusicService
+	playlistService domain.PlaylistService
+}
+
+// HandleImport stages an uploaded ZIP archive and queues a job importing it
+func (s *uploadService) HandleImport(ctx *gin.Context, fileService FileService) (*domain.Job, error) {
+	file, err := ctx.FormFile("archive")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get uploaded file: %w", err)
+	}
+	if strings.ToLower(filepath.Ext(file.Filename)) != ".zip" {
+		return nil, fmt.Errorf("invalid file type. Only ZIP archives can be imported")
+	}
+
+	// Every track is checked on its own as well, this only turns away users
+	// who are out of quota already
+	if err := s.quotaService.CheckUpload(ctx.GetString("username"), 0, 0); err != nil {
+		return nil, err
+	}
+
+	if err := fileService.EnsureDirectoryExists(s.stagingDir); err != nil {
+		return nil, err
+	}
+	filePath := filepath.Join(s.stagingDir, fmt.Sprintf("%d_%s", time.Now().UnixNano(), file.Filename))
+	if err := ctx.SaveUploadedFile(file, filePath); err != nil {
+		return nil, fmt.Errorf("failed to save file: %v", err)
+	}
+
+	job, err := s.jobService.Enqueue(importJobType, ctx.GetString("username"), importPayload{
+		StagedFile:   filePath,
+		OriginalName: file.Filename,
+	})
+	if err != nil {
+		os.Remove(filePath)
+		return nil, fmt.Errorf("failed to queue import: %w", err)
+	}
+	return job, nil
+}
+
+func (h *importJobHandler) Run(ctx context.Context, job *domain.Job, progress domain.JobProgress) (interface{}, error) {
+	var payload importPayload
+	if err := decodeJobPayload(job, &payload); err != nil {
+		return nil, err
+	}
+
+	progress(importStageReading, 0)
+	if err := h.fileService.EnsureDirectoryExists(h.uploads.stagingDir); err != nil {
+		return nil, err
+	}
+	archive, err := zip.OpenReader(payload.StagedFile)
+	if err != nil {
+		return nil, &domain.PermanentError{Err: fmt.Errorf("invalid ZIP archive: %w", err)}
+	}
+	defer archive.Close()
+
+	if len(archive.File) > maxImportEntries {
+		return nil, &domain.PermanentError{Err: fmt.Errorf("archive holds %d files, at most %d allowed", len(archive.File), maxImportEntries)}
+	}
+
+	var tracks, playlists []*zip.File
+	result := &importResult{}
+	for _, entry := range archive.File {
+		name := strings.ReplaceAll(entry.Name, `\`, "/")
+		switch {
+		case entry.FileInfo().IsDir() || isJunkArchiveEntry(name):
+		case isPlaylistFile(name):
+			playlists = append(playlists, entry)
+		case h.fileService.ValidateAudioFile(path.Ext(name)) == nil:
+			tracks = append(tracks, entry)
+		default:
+			result.Files = append(result.Files, &importFileResult{Path: name, Status: importFileSkipped, Error: "not a supported audio or playlist file"})
+		}
+	}
+
+	// Tracks are matched to playlist entries by their path in the archive
+	imported := make(map[string]uint)
+	for i, entry := range tracks {
+		name := strings.ReplaceAll(entry.Name, `\`, "/")
+		fileResult := h.importTrack(ctx, job.Owner, entry, func(stage string, value float64) {
+			progress(stage, 0.95*(float64(i)+value)/float64(len(tracks)))
+		})
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		fileResult.Path = name
+		if fileResult.MusicID != nil {
+			imported[strings.ToLower(path.Clean(name))] = *fileResult.MusicID
+		}
+		result.Files = append(result.Files, fileResult)
+	}
+
+	progress(importStagePlaylists, 0.95)
+	actor := domain.Actor{Username: job.Owner}
+	for _, entry := range playlists {
+		result.Playlists = append(result.Playlists, h.importPlaylist(entry, imported, actor))
+	}
+	return result, nil
+}
+
+func (h *importJobHandler) Cleanup(job *domain.Job) {
+	var payload importPayload
+	if err := decodeJobPayload(job, &payload); err == nil && payload.StagedFile != "" {
+		os.Remove(payload.StagedFile)
+	}
+}
+
+// importTrack extracts one audio file of an archive and ingests it like a
+// regular upload
+func (h *importJobHandler) importTrack(ctx context.Context, owner string, entry *zip.File, progress domain.JobProgress) *importFileResult {
+	fail := func(err error) *importFileResult {
+		return &importFileResult{Status: importFileFailed, Error: err.Error()}
+	}
+
+	// Sizes declared by the archive are checked before anything is extracted,
+	// and enforced while extracting in case they lie
+	size := int64(entry.UncompressedSize64)
+	if err := h.uploads.quotaService.CheckUpload(owner, size, 0); err != nil {
+		return fail(err)
+	}
+
+	originalName := path.Base(strings.ReplaceAll(entry.Name, `\`, "/"))
+	filePath := filepath.Join(h.uploads.stagingDir, fmt.Sprintf("%d_%s", time.Now().UnixNano(), originalName))
+	defer os.Remove(filePath)
+	if err := extractArchiveFile(entry, filePath, size); err != nil {
+		return fail(err)
+	}
+
+	music, err := h.uploads.ingestFile(ctx, filePath, musicInput{
+		Username:     owner,
+		OriginalName: originalName,
+	}, h.fileService, h.musicService, progress)
+	if err != nil {
+		return fail(err)
+	}
+
+	status := importFileImported
+	if music.Duplicate {
+		status = importFileDuplicate
+	}
+	return &importFileResult{Status: status, MusicID: &music.ID}
+}
+
+// importPlaylist creates a playlist from a playlist file of an archive with
+// the imported tracks it lists, in order
+func (h *importJobHandler) importPlaylist(entry *zip.File, imported map[string]uint, actor domain.Actor) *importPlaylistResult {
+	name := strings.ReplaceAll(entry.Name, `\`, "/")
+	result := &importPlaylistResult{Path: name}
+
+	reader, err := entry.Open()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer reader.Close()
+
+	parsed, err := parsePlaylistFile(name, io.LimitReader(reader, maxPlaylistFileSize))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Name = parsed.Name
+
+	// Entries are matched by their path relative to the playlist, falling back
+	// to the file name for absolute paths of another machine
+	byName := make(map[string][]uint)
+	for trackPath, musicID := range imported {
+		byName[path.Base(trackPath)] = append(byName[path.Base(trackPath)], musicID)
+	}
+	var musicIDs []uint
+	for _, location := range parsed.Entries {
+		entryPath, ok := playlistEntryPath(path.Dir(name), location)
+		if !ok {
+			result.Missing = append(result.Missing, location)
+			continue
+		}
+		entryPath = strings.ToLower(path.Clean(entryPath))
+		if musicID, ok := imported[strings.TrimPrefix(entryPath, "/")]; ok {
+			musicIDs = append(musicIDs, musicID)
+		} else if candidates := byName[path.Base(entryPath)]; len(candidates) == 1 {
+			musicIDs = append(musicIDs, candidates[0])
+		} else {
+			result.Missing = append(result.Missing, location)
+		}
+	}
+
+	playlist, err := h.playlistService.CreatePlaylist(parsed.Name, actor.Username)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to create playlist: %v", err)
+		return result
+	}
+	result.PlaylistID = &playlist.ID
+
+	for _, musicID := range musicIDs {
+		if _, err := h.playlistService.AddSongToPlaylist(playlist.ID, musicID, actor); err != nil {
+			log.Printf("Failed to add music %d to imported playlist %d: %v", musicID, playlist.ID, err)
+			continue
+		}
+		result.Tracks++
+	}
+	return result
+}
+
+// extractArchiveFile writes a file of an archive to filePath, failing if it
+// holds more than the size it declares
+func extractArchiveFile(entry *zip.File, filePath string, size int64) error {
+	reader, err := entry.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer reader.Close()
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer file.Close()
+
+	written, err := io.Copy(file, io.LimitReader(reader, size+1))
+	if err != nil {
+		return fmt.Errorf("failed to extract file: %w", err)
+	}
+	if written > size {
+		return errors.New("file is larger than the archive declares")
+	}
+	return nil
+}
+
+// isJunkArchiveEntry reports whether an archive entry is metadata added by
+// the tool that made the archive, e.g. by macOS
+func isJunkArchiveEntry(name string) bool {
+	if strings.HasPrefix(name, "__MACOSX/") {
+		return true
+	}
+	base := path.Base(name)
+	return strings.HasPrefix(base, ".") || strings.EqualFold(base, "Thumbs.db") || strings.EqualFold(base, "desktop.ini")
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+)
+
+// ingestJobType is the type of jobs turning an uploaded or downloaded file
+// into a track
+const ingestJobType = "ingest"
+
+// Stages of ingest jobs
+const (
+	ingestStageDownloading = "downloading"
+	ingestStageAnalyzing   = "analyzing"
+	ingestStageStoring     = "storing"
+	ingestStageSaving      = "saving"
+)
+
+// ingestDownloadShare is the part of the progress of a download job spent
+// downloading
+const ingestDownloadShare = 0.6
+
+// ingestPayload is the input of an ingest job. Either a staged upload or a
+// URL to download is set
+type ingestPayload struct {
+	StagedFile   string `json:"staged_file,omitempty"`
+	URL          string `json:"url,omitempty"`
+	Title        string `json:"title"`
+	Artist       string `json:"artist"`
+	Album        string `json:"album"`
+	OriginalName string `json:"original_name"`
+}
+
+// ingestJobHandler runs ingest jobs. The result is the created track, or the
+// existing one flagged as duplicate
+type ingestJobHandler struct {
+	uploads      *uploadService
+	fileService  FileService
+	musicService domain.MusicService
+}
+
+func (s *uploadService) RegisterJobHandlers(fileService FileService, musicService domain.MusicService, playlistService domain.PlaylistService) {
+	s.jobService.RegisterHandler(ingestJobType, &ingestJobHandler{
+		uploads:      s,
+		fileService:  fileService,
+		musicService: musicService,
+	})
+	s.jobService.RegisterHandler(importJobType, &importJobHandler{
+		uploads:         s,
+		fileService:     fileService,
+		musicService:    musicService,
+		playlistService: playlistService,
+	})
+}
+
+func (h *ingestJobHandler) Run(ctx context.Context, job *domain.Job, progress domain.JobProgress) (interface{}, error) {
+	payload, err := decodeIngestPayload(job)
+	if err != nil {
+		return nil, err
+	}
+
+	input := musicInput{
+		Title:        payload.Title,
+		Artist:       payload.Artist,
+		Album:        payload.Album,
+		Username:     job.Owner,
+		OriginalName: payload.OriginalName,
+	}
+	if payload.URL == "" {
+		return h.uploads.ingestFile(ctx, payload.StagedFile, input, h.fileService, h.musicService, progress)
+	}
+
+	// Every attempt downloads the file again
+	if err := h.fileService.EnsureDirectoryExists(h.uploads.stagingDir); err != nil {
+		return nil, err
+	}
+	filePath := filepath.Join(h.uploads.stagingDir, fmt.Sprintf("%d_%s", time.Now().UnixNano(), payload.OriginalName))
+	defer os.Remove(filePath)
+
+	progress(ingestStageDownloading, 0)
+	_, err = h.fileService.DownloadFile(ctx, payload.URL, filePath, h.uploads.fetcher, func(written, total int64) {
+		progress(ingestStageDownloading, ingestDownloadShare*float64(written)/float64(total))
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to download music: %w", err)
+		// Retrying cannot change what the policy forbids or what the URL serves
+		if errors.Is(err, domain.ErrURLNotAllowed) || errors.Is(err, domain.ErrRemoteFileTooLarge) || errors.Is(err, domain.ErrUnsupportedAudioFormat) {
+			return nil, &domain.PermanentError{Err: err}
+		}
+		return nil, err
+	}
+
+	return h.uploads.ingestFile(ctx, filePath, input, h.fileService, h.musicService, func(stage string, value float64) {
+		progress(stage, ingestDownloadShare+(1-ingestDownloadShare)*value)
+	})
+}
+
+func (h *ingestJobHandler) Cleanup(job *domain.Job) {
+	if payload, err := decodeIngestPayload(job); err == nil && payload.StagedFile != "" {
+		os.Remove(payload.StagedFile)
+	}
+}
+
+func decodeIngestPayload(job *domain.Job) (*ingestPayload, error) {
+	var payload ingestPayload
+	if err := decodeJobPayload(job, &payload); err != nil {
+		return nil, err
+	}
+	return &payload, nil
+}
+
+// decodeJobPayload decodes the payload of a job, failing it for good when the
+// payload is broken
+func decodeJobPayload(job *domain.Job, payload interface{}) error {
+	if err := json.Unmarshal([]byte(job.Payload), payload); err != nil {
+		return &domain.PermanentError{Err: fmt.Errorf("invalid job payload: %w", err)}
+	}
+	return nil
+}
@@ -0,0 +1,322 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+)
+
+const (
+	// DefaultJobWorkers is the number of jobs run at once per instance
+	DefaultJobWorkers = 2
+	// DefaultJobAttempts is how often a failing job is tried
+	DefaultJobAttempts = 3
+
+	jobPollInterval      = time.Second
+	jobHeartbeatInterval = 30 * time.Second
+	// jobLease is how long a running job may go untouched before its worker
+	// is considered dead and the job is requeued
+	jobLease            = 2 * time.Minute
+	jobRetryBaseDelay   = 5 * time.Second
+	jobRetryMaxDelay    = 5 * time.Minute
+	jobProgressInterval = 500 * time.Millisecond
+)
+
+type jobService struct {
+	repo        domain.JobRepository
+	notifier    domain.JobNotifier
+	maxAttempts int
+	handlers    map[string]domain.JobHandler
+	wake        chan struct{}
+
+	mu      sync.Mutex
+	running map[uint]context.CancelFunc // Jobs running in this instance
+}
+
+// NewJobService creates a new instance of JobService. Job updates are sent
+// to the notifier
+func NewJobService(repo domain.JobRepository, notifier domain.JobNotifier, maxAttempts int) domain.JobService {
+	return &jobService{
+		repo:        repo,
+		notifier:    notifier,
+		maxAttempts: maxAttempts,
+		handlers:    make(map[string]domain.JobHandler),
+		wake:        make(chan struct{}, 1),
+		running:     make(map[uint]context.CancelFunc),
+	}
+}
+
+func (s *jobService) RegisterHandler(jobType string, handler domain.JobHandler) {
+	s.handlers[jobType] = handler
+}
+
+func (s *jobService) Enqueue(jobType, owner string, payload interface{}) (*domain.Job, error) {
+	if _, ok := s.handlers[jobType]; !ok {
+		return nil, domain.ErrUnknownJobType
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job payload: %w", err)
+	}
+
+	job := &domain.Job{
+		Type:        jobType,
+		Status:      domain.JobQueued,
+		Owner:       owner,
+		Payload:     string(data),
+		MaxAttempts: s.maxAttempts,
+		RunAt:       time.Now(),
+	}
+	if err := s.repo.Create(job); err != nil {
+		return nil, err
+	}
+
+	// Wake an idle worker instead of waiting for the next poll
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+func (s *jobService) GetJob(id uint, actor domain.Actor) (*domain.Job, error) {
+	job, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, domain.ErrJobNotFound
+	}
+	// Jobs of other users are not revealed
+	if job.Owner != actor.Username && !actor.Can(domain.PermManageAnyJob) {
+		return nil, domain.ErrJobNotFound
+	}
+	return job, nil
+}
+
+func (s *jobService) CancelJob(id uint, actor domain.Actor) (*domain.Job, error) {
+	job, err := s.GetJob(id, actor)
+	if err != nil {
+		return nil, err
+	}
+	if job.IsFinished() {
+		return nil, domain.ErrJobFinished
+	}
+
+	wasQueued := job.Status == domain.JobQueued
+	now := time.Now()
+	job.Status = domain.JobCanceled
+	job.FinishedAt = &now
+	saved, err := s.repo.Update(job, domain.JobQueued, domain.JobRunning)
+	if err != nil {
+		return nil, err
+	}
+	if !saved {
+		return nil, domain.ErrJobFinished
+	}
+
+	// Running jobs are cleaned up by their worker once the handler returns.
+	// Workers of other instances notice the cancellation on their next
+	// progress update
+	if wasQueued {
+		if handler, ok := s.handlers[job.Type]; ok {
+			handler.Cleanup(job)
+		}
+	} else {
+		s.mu.Lock()
+		if cancel, ok := s.running[job.ID]; ok {
+			cancel()
+		}
+		s.mu.Unlock()
+	}
+
+	s.notify(job)
+	return job, nil
+}
+
+func (s *jobService) Start(workers int) {
+	for i := 0; i < workers; i++ {
+		go s.work()
+	}
+	go s.heartbeat()
+}
+
+// work claims and runs jobs until the process exits
+func (s *jobService) work() {
+	for {
+		job, err := s.repo.Claim()
+		if err != nil {
+			log.Printf("Failed to claim job: %v", err)
+		}
+		if job == nil {
+			select {
+			case <-s.wake:
+			case <-time.After(jobPollInterval):
+			}
+			continue
+		}
+		s.run(job)
+	}
+}
+
+// heartbeat keeps the jobs of this instance alive and requeues the jobs of
+// instances that died
+func (s *jobService) heartbeat() {
+	ticker := time.NewTicker(jobHeartbeatInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.mu.Lock()
+		ids := make([]uint, 0, len(s.running))
+		for id := range s.running {
+			ids = append(ids, id)
+		}
+		s.mu.Unlock()
+
+		if err := s.repo.Touch(ids); err != nil {
+			log.Printf("Failed to touch running jobs: %v", err)
+		}
+		count, failed, err := s.repo.RequeueStale(time.Now().Add(-jobLease))
+		if err != nil {
+			log.Printf("Failed to requeue stale jobs: %v", err)
+		} else if count > 0 {
+			log.Printf("Requeued %d stale jobs", count)
+		}
+
+		// Their workers are gone and will not clean up after them
+		for _, job := range failed {
+			if handler, ok := s.handlers[job.Type]; ok {
+				handler.Cleanup(job)
+			}
+			s.notify(job)
+		}
+	}
+}
+
+// run runs a claimed job and records its outcome
+func (s *jobService) run(job *domain.Job) {
+	handler, ok := s.handlers[job.Type]
+	if !ok {
+		s.finish(job, nil, nil, &domain.PermanentError{Err: domain.ErrUnknownJobType})
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.running[job.ID] = cancel
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, job.ID)
+		s.mu.Unlock()
+		cancel()
+	}()
+
+	s.notify(job)
+
+	var lastSaved time.Time
+	progress := func(stage string, value float64) {
+		stageChanged := stage != job.Stage
+		job.Stage, job.Progress = stage, value
+		if !stageChanged && time.Since(lastSaved) < jobProgressInterval {
+			return
+		}
+		lastSaved = time.Now()
+
+		saved, err := s.repo.Update(job, domain.JobRunning)
+		if err != nil {
+			log.Printf("Failed to save progress of job %d: %v", job.ID, err)
+			return
+		}
+		if !saved {
+			cancel() // Canceled from another instance
+			return
+		}
+		s.notify(job)
+	}
+
+	result, err := runHandler(ctx, handler, job, progress)
+	s.finish(job, handler, result, err)
+}
+
+// runHandler runs a job handler, turning a panic into a permanent failure
+func runHandler(ctx context.Context, handler domain.JobHandler, job *domain.Job, progress domain.JobProgress) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &domain.PermanentError{Err: fmt.Errorf("job panicked: %v", r)}
+		}
+	}()
+	return handler.Run(ctx, job, progress)
+}
+
+// finish records the outcome of a run: success, a retry or a failure. The
+// handler cleans up once the job will not run again
+func (s *jobService) finish(job *domain.Job, handler domain.JobHandler, result interface{}, runErr error) {
+	now := time.Now()
+	var permanent *domain.PermanentError
+	var saved bool
+	var err error
+
+	switch {
+	case runErr == nil:
+		data, marshalErr := json.Marshal(result)
+		if marshalErr != nil {
+			s.finish(job, handler, nil, &domain.PermanentError{Err: marshalErr})
+			return
+		}
+		job.Status, job.Result, job.Error = domain.JobSucceeded, string(data), ""
+		job.Progress, job.FinishedAt = 1, &now
+		// The work is done, so success wins over a late cancellation
+		saved, err = s.repo.Update(job, domain.JobRunning, domain.JobCanceled)
+
+	case !errors.As(runErr, &permanent) && job.Attempts < job.MaxAttempts:
+		job.Status, job.Error = domain.JobQueued, runErr.Error()
+		job.Stage, job.Progress = "", 0
+		job.RunAt = now.Add(retryDelay(job.Attempts))
+		saved, err = s.repo.Update(job, domain.JobRunning)
+
+	default:
+		job.Status, job.Error, job.FinishedAt = domain.JobFailed, runErr.Error(), &now
+		saved, err = s.repo.Update(job, domain.JobRunning)
+	}
+
+	if err != nil {
+		log.Printf("Failed to save job %d: %v", job.ID, err)
+		return
+	}
+	if !saved {
+		// The job was canceled while it ran
+		current, err := s.repo.FindByID(job.ID)
+		if err != nil {
+			log.Printf("Failed to load job %d: %v", job.ID, err)
+			return
+		}
+		*job = *current
+	}
+
+	if job.IsFinished() && handler != nil {
+		handler.Cleanup(job)
+	}
+	s.notify(job)
+}
+
+// retryDelay returns the exponential backoff before the next attempt, with
+// jitter so failed jobs do not retry in lockstep
+func retryDelay(attempts int) time.Duration {
+	delay := jobRetryBaseDelay << max(attempts-1, 0)
+	if delay <= 0 || delay > jobRetryMaxDelay {
+		delay = jobRetryMaxDelay
+	}
+	return delay + rand.N(delay/5)
+}
+
+func (s *jobService) notify(job *domain.Job) {
+	if s.notifier != nil {
+		s.notifier.NotifyJob(job)
+	}
+}
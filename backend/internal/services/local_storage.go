@@ -0,0 +1,167 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+)
+
+type localStorage struct {
+	root string
+}
+
+// NewLocalStorage creates a Storage that keeps objects as files below root
+func NewLocalStorage(root string) domain.Storage {
+	return &localStorage{root: root}
+}
+
+func (s *localStorage) Put(key string, r io.Reader, size int64, contentType string) error {
+	filePath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see a partial object
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
+
+func (s *localStorage) Get(key string) (io.ReadCloser, *domain.ObjectInfo, error) {
+	filePath, err := s.path(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, localStorageError(err)
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, localObjectInfo(key, stat), nil
+}
+
+func (s *localStorage) Range(key string, offset, length int64) (io.ReadCloser, error) {
+	filePath, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, localStorageError(err)
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, length), f}, nil
+}
+
+func (s *localStorage) Delete(key string) error {
+	filePath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *localStorage) Stat(key string) (*domain.ObjectInfo, error) {
+	filePath, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return nil, localStorageError(err)
+	}
+	return localObjectInfo(key, stat), nil
+}
+
+// SignedURL is not supported, local objects are served by the API itself
+func (s *localStorage) SignedURL(key string, expiry time.Duration) (string, error) {
+	return "", domain.ErrSignedURLNotSupported
+}
+
+// path maps a key to a file below the root, rejecting keys that would
+// escape it
+func (s *localStorage) path(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if key == "" || cleaned == "/" || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(cleaned[1:])), nil
+}
+
+func localStorageError(err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return domain.ErrObjectNotFound
+	}
+	return err
+}
+
+func localObjectInfo(key string, stat os.FileInfo) *domain.ObjectInfo {
+	return &domain.ObjectInfo{
+		Key:         key,
+		Size:        stat.Size(),
+		ModTime:     stat.ModTime(),
+		ContentType: contentTypeByKey(key),
+		ETag:        fmt.Sprintf(`"%x-%x"`, stat.ModTime().UnixNano(), stat.Size()),
+	}
+}
+
+// contentTypeByKey guesses the content type of an object from its extension.
+// Audio types are listed explicitly as they are missing from minimal systems
+func contentTypeByKey(key string) string {
+	ext := strings.ToLower(path.Ext(key))
+	switch ext {
+	case ".mp3":
+		return "audio/mpeg"
+	case ".wav":
+		return "audio/wav"
+	case ".ogg":
+		return "audio/ogg"
+	case ".flac":
+		return "audio/flac"
+	}
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
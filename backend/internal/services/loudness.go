@@ -0,0 +1,233 @@
+package services
+
+import (
+	"io"
+	"math"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+)
+
+const (
+	// loudnessBlock and loudnessStep are the length of the gating blocks and
+	// the distance between them, in seconds. Blocks overlap by 75%
+	loudnessBlock = 0.4
+	loudnessStep  = 0.1
+	// absoluteGate drops blocks of silence, in LUFS
+	absoluteGate = domain.AbsoluteGate
+	// relativeGate drops blocks this many LU below the ungated loudness
+	relativeGate = -10.0
+	// truePeakOversampling is the factor samples are upsampled by to find
+	// peaks between samples
+	truePeakOversampling = 4
+	truePeakTaps         = 12 // Filter taps per phase
+)
+
+// biquad is a second order IIR filter in direct form I
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// kWeightingFilters returns the two stages of the K-weighting filter of
+// ITU-R BS.1770 for a sample rate: a high shelf modelling the head followed by
+// a high pass. The coefficients are derived as in libebur128 so every sample
+// rate is supported, not only the 48 kHz the standard lists
+func kWeightingFilters(sampleRate float64) (biquad, biquad) {
+	// High shelf
+	f0, gain, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / sampleRate)
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	// High pass
+	f0, q = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / sampleRate)
+	a0 = 1 + k/q + k*k
+	highPass := biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return shelf, highPass
+}
+
+// truePeakFilter returns the polyphase coefficients of a windowed sinc
+// interpolation filter, one row per phase
+func truePeakFilter() [truePeakOversampling][truePeakTaps]float64 {
+	var phases [truePeakOversampling][truePeakTaps]float64
+	length := truePeakOversampling * truePeakTaps
+	center := float64(length-1) / 2
+	for i := 0; i < length; i++ {
+		t := (float64(i) - center) / truePeakOversampling
+		sinc := 1.0
+		if t != 0 {
+			sinc = math.Sin(math.Pi*t) / (math.Pi * t)
+		}
+		window := 0.5 - 0.5*math.Cos(2*math.Pi*(float64(i)+0.5)/float64(length)) // Hann
+		phases[i%truePeakOversampling][i/truePeakOversampling] = sinc * window
+	}
+
+	// Normalize every phase to unity gain so no peaks are invented
+	for p := range phases {
+		sum := 0.0
+		for _, c := range phases[p] {
+			sum += c
+		}
+		for i := range phases[p] {
+			phases[p][i] /= sum
+		}
+	}
+	return phases
+}
+
+// loudnessMeter accumulates the measurements of one audio channel
+type loudnessMeter struct {
+	shelf, highPass biquad
+	history         [truePeakTaps]float64 // Most recent samples, newest first
+	peak            float64
+}
+
+// analyzeLoudness measures the integrated loudness and true peak of an audio
+// file per EBU R128
+func analyzeLoudness(filePath string) (*domain.LoudnessAnalysis, error) {
+	audioFormat, err := detectAudioFormat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	streamer, format, err := decodeAudio(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer streamer.Close()
+
+	scale := decodedLevelScale(audioFormat, format)
+
+	// Mono files are decoded to two identical channels but must be measured once
+	channels := format.NumChannels
+	if channels < 1 || channels > 2 {
+		channels = 2
+	}
+
+	sampleRate := float64(format.SampleRate)
+	meters := make([]loudnessMeter, channels)
+	for i := range meters {
+		meters[i].shelf, meters[i].highPass = kWeightingFilters(sampleRate)
+	}
+	phases := truePeakFilter()
+
+	// Energy is summed per step, blocks are made of consecutive steps
+	stepSize := int(math.Round(sampleRate * loudnessStep))
+	stepsPerBlock := int(math.Round(loudnessBlock / loudnessStep))
+	var steps []float64
+	energy := 0.0
+	filled := 0
+
+	buf := make([][2]float64, 4096)
+	for {
+		n, ok := streamer.Stream(buf)
+		for _, sample := range buf[:n] {
+			for c := range meters {
+				m := &meters[c]
+				x := sample[c] * scale
+
+				y := m.highPass.process(m.shelf.process(x))
+				energy += y * y
+
+				copy(m.history[1:], m.history[:truePeakTaps-1])
+				m.history[0] = x
+				for p := range phases {
+					v := 0.0
+					for k, coefficient := range phases[p] {
+						v += coefficient * m.history[k]
+					}
+					m.peak = math.Max(m.peak, math.Abs(v))
+				}
+				m.peak = math.Max(m.peak, math.Abs(x))
+			}
+
+			filled++
+			if filled == stepSize {
+				steps = append(steps, energy/float64(stepSize))
+				energy, filled = 0, 0
+			}
+		}
+		if !ok {
+			break
+		}
+	}
+	// The FLAC decoder reports the end of the stream as an error
+	if err := streamer.Err(); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	var blocks []float64
+	for i := 0; i+stepsPerBlock <= len(steps); i++ {
+		sum := 0.0
+		for _, e := range steps[i : i+stepsPerBlock] {
+			sum += e
+		}
+		blocks = append(blocks, sum/float64(stepsPerBlock))
+	}
+
+	peak := 0.0
+	for _, m := range meters {
+		peak = math.Max(peak, m.peak)
+	}
+
+	return &domain.LoudnessAnalysis{
+		Integrated: gatedLoudness(blocks),
+		TruePeak:   math.Max(20*math.Log10(peak), absoluteGate),
+	}, nil
+}
+
+// gatedLoudness applies the absolute and relative gates of EBU R128 to the
+// mean square energies of the blocks. Silence measures as the absolute gate
+func gatedLoudness(blocks []float64) float64 {
+	mean := func(threshold float64) (float64, bool) {
+		sum, count := 0.0, 0
+		for _, e := range blocks {
+			if blockLoudness(e) > threshold {
+				sum += e
+				count++
+			}
+		}
+		if count == 0 {
+			return 0, false
+		}
+		return sum / float64(count), true
+	}
+
+	ungated, ok := mean(absoluteGate)
+	if !ok {
+		return absoluteGate
+	}
+	gated, ok := mean(math.Max(absoluteGate, blockLoudness(ungated)+relativeGate))
+	if !ok {
+		return absoluteGate
+	}
+	return blockLoudness(gated)
+}
+
+func blockLoudness(energy float64) float64 {
+	if energy <= 0 {
+		return math.Inf(-1)
+	}
+	return -0.691 + 10*math.Log10(energy)
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"github.com/dhowden/tag"
+)
+
+// MetadataExtractor reads the tags embedded in audio files
+type MetadataExtractor interface {
+	// ExtractMetadata returns the tags of an audio file. Files without any
+	// tags yield empty metadata rather than an error
+	ExtractMetadata(filePath string) (*domain.AudioMetadata, error)
+}
+
+type metadataExtractor struct{}
+
+// NewMetadataExtractor creates a new instance of MetadataExtractor
+func NewMetadataExtractor() MetadataExtractor {
+	return &metadataExtractor{}
+}
+
+func (e *metadataExtractor) ExtractMetadata(filePath string) (*domain.AudioMetadata, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return &domain.AudioMetadata{}, nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	// WAV files carry RIFF INFO chunks which the tag library does not understand
+	if string(header[0:4]) == "RIFF" && string(header[8:12]) == "WAVE" {
+		return readRIFFMetadata(f)
+	}
+
+	m, err := tag.ReadFrom(f)
+	if errors.Is(err, tag.ErrNoTagsFound) {
+		return &domain.AudioMetadata{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tags: %w", err)
+	}
+	metadata := metadataFromTags(m)
+
+	// MP3 files may carry both ID3v2 and ID3v1 tags; fill the gaps from ID3v1
+	if m.Format() != tag.ID3v1 && string(header[0:3]) == "ID3" {
+		if v1, err := tag.ReadID3v1Tags(f); err == nil {
+			mergeMetadata(metadata, metadataFromTags(v1))
+		}
+	}
+
+	return metadata, nil
+}
+
+// metadataFromTags converts the tags read by the tag library to our model
+func metadataFromTags(m tag.Metadata) *domain.AudioMetadata {
+	metadata := &domain.AudioMetadata{
+		Title:       cleanTagValue(m.Title()),
+		Artist:      cleanTagValue(m.Artist()),
+		AlbumArtist: cleanTagValue(m.AlbumArtist()),
+		Album:       cleanTagValue(m.Album()),
+		Year:        m.Year(),
+		Genre:       cleanTagValue(m.Genre()),
+		Composer:    cleanTagValue(m.Composer()),
+	}
+	metadata.TrackNumber, metadata.TrackTotal = m.Track()
+	metadata.DiscNumber, metadata.DiscTotal = m.Disc()
+
+	if picture := m.Picture(); picture != nil && len(picture.Data) > 0 {
+		metadata.Picture = &domain.Picture{MimeType: picture.MIMEType, Data: picture.Data}
+	}
+	return metadata
+}
+
+// mergeMetadata copies every field that is missing in dst from src
+func mergeMetadata(dst, src *domain.AudioMetadata) {
+	if dst.Title == "" {
+		dst.Title = src.Title
+	}
+	if dst.Artist == "" {
+		dst.Artist = src.Artist
+	}
+	if dst.AlbumArtist == "" {
+		dst.AlbumArtist = src.AlbumArtist
+	}
+	if dst.Album == "" {
+		dst.Album = src.Album
+	}
+	if dst.TrackNumber == 0 {
+		dst.TrackNumber = src.TrackNumber
+	}
+	if dst.TrackTotal == 0 {
+		dst.TrackTotal = src.TrackTotal
+	}
+	if dst.DiscNumber == 0 {
+		dst.DiscNumber = src.DiscNumber
+	}
+	if dst.DiscTotal == 0 {
+		dst.DiscTotal = src.DiscTotal
+	}
+	if dst.Year == 0 {
+		dst.Year = src.Year
+	}
+	if dst.Genre == "" {
+		dst.Genre = src.Genre
+	}
+	if dst.Composer == "" {
+		dst.Composer = src.Composer
+	}
+	if dst.Picture == nil {
+		dst.Picture = src.Picture
+	}
+}
+
+// readRIFFMetadata walks the chunks of a WAV file and reads the LIST/INFO
+// chunk as well as an embedded "id3 " chunk if present
+func readRIFFMetadata(r io.ReadSeeker) (*domain.AudioMetadata, error) {
+	metadata := &domain.AudioMetadata{}
+
+	if _, err := r.Seek(12, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	chunkHeader := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, chunkHeader); err != nil {
+			break // End of file
+		}
+		id := string(chunkHeader[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunkHeader[4:8]))
+		// Chunks are padded to an even size
+		next := size + size%2
+
+		switch {
+		case id == "LIST":
+			data, err := readChunk(r, size)
+			if err != nil {
+				return metadata, nil
+			}
+			if len(data) >= 4 && string(data[0:4]) == "INFO" {
+				parseRIFFInfo(data[4:], metadata)
+			}
+			next -= size
+
+		case strings.EqualFold(id, "id3 "):
+			data, err := readChunk(r, size)
+			if err != nil {
+				return metadata, nil
+			}
+			if m, err := tag.ReadID3v2Tags(bytes.NewReader(data)); err == nil {
+				// ID3 tags are usually more complete than RIFF INFO
+				id3 := metadataFromTags(m)
+				mergeMetadata(id3, metadata)
+				metadata = id3
+			}
+			next -= size
+		}
+
+		if _, err := r.Seek(next, io.SeekCurrent); err != nil {
+			break
+		}
+	}
+
+	return metadata, nil
+}
+
+// parseRIFFInfo parses the sub-chunks of a LIST/INFO chunk
+func parseRIFFInfo(data []byte, metadata *domain.AudioMetadata) {
+	for len(data) >= 8 {
+		id := string(data[0:4])
+		size := int(binary.LittleEndian.Uint32(data[4:8]))
+		data = data[8:]
+		if size > len(data) {
+			return
+		}
+		value := cleanTagValue(string(data[:size]))
+
+		switch id {
+		case "INAM":
+			metadata.Title = value
+		case "IART":
+			metadata.Artist = value
+		case "IPRD":
+			metadata.Album = value
+		case "IGNR":
+			metadata.Genre = value
+		case "IMUS", "ICMP":
+			metadata.Composer = value
+		case "ICRD":
+			metadata.Year = parseLeadingInt(value)
+		case "ITRK", "IPRT":
+			metadata.TrackNumber = parseLeadingInt(value)
+		}
+
+		data = data[size+size%2:]
+	}
+}
+
+func readChunk(r io.Reader, size int64) ([]byte, error) {
+	const maxChunkSize = 16 * 1024 * 1024
+	if size > maxChunkSize {
+		return nil, fmt.Errorf("chunk too large: %d bytes", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// parseLeadingInt parses values like "2004", "2004-05-01" or "3/12"
+func parseLeadingInt(value string) int {
+	end := 0
+	for end < len(value) && value[end] >= '0' && value[end] <= '9' {
+		end++
+	}
+	n, _ := strconv.Atoi(value[:end])
+	return n
+}
+
+func cleanTagValue(value string) string {
+	return strings.TrimSpace(strings.Trim(value, "\x00"))
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// mp3Frame is the position and length of an MPEG audio frame in a file
+type mp3Frame struct {
+	Offset     int64
+	Size       int
+	Samples    int
+	SampleRate int
+}
+
+// Bitrates in kbit/s by version and layer, indexed by the bitrate bits
+var (
+	mpeg1Bitrates = [3][15]int{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448}, // Layer I
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},    // Layer II
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},     // Layer III
+	}
+	mpeg2Bitrates = [3][15]int{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256}, // Layer I
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},      // Layer II
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},      // Layer III
+	}
+	mpeg1SampleRates = [3]int{44100, 48000, 32000}
+)
+
+// parseMP3FrameHeader returns the frame described by a 4 byte header, or
+// false if the bytes are not a valid header
+func parseMP3FrameHeader(header []byte) (mp3Frame, bool) {
+	if !isMP3Frame(header) {
+		return mp3Frame{}, false
+	}
+
+	version := header[1] >> 3 & 0x03 // 0: MPEG 2.5, 2: MPEG 2, 3: MPEG 1
+	layer := 4 - int(header[1]>>1&0x03)
+	bitrateIndex := header[2] >> 4
+	padding := int(header[2] >> 1 & 0x01)
+	if bitrateIndex == 0 {
+		return mp3Frame{}, false // Free format is not supported
+	}
+
+	var bitrate int
+	sampleRate := mpeg1SampleRates[header[2]>>2&0x03]
+	if version == 3 {
+		bitrate = mpeg1Bitrates[layer-1][bitrateIndex] * 1000
+	} else {
+		bitrate = mpeg2Bitrates[layer-1][bitrateIndex] * 1000
+		sampleRate /= 2
+		if version == 0 {
+			sampleRate /= 2
+		}
+	}
+
+	frame := mp3Frame{SampleRate: sampleRate}
+	switch {
+	case layer == 1:
+		frame.Samples = 384
+		frame.Size = (12*bitrate/sampleRate + padding) * 4
+	case layer == 3 && version != 3:
+		frame.Samples = 576
+		frame.Size = 72*bitrate/sampleRate + padding
+	default:
+		frame.Samples = 1152
+		frame.Size = 144*bitrate/sampleRate + padding
+	}
+	return frame, true
+}
+
+// scanMP3Frames lists the audio frames of an MP3 file. Tags and garbage
+// between frames are skipped, as is the Xing/Info frame some encoders put
+// first which carries no audio
+func scanMP3Frames(r io.Reader) ([]mp3Frame, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	var (
+		frames   []mp3Frame
+		offset   int64
+		resynced = true
+	)
+
+	skip := func(n int) error {
+		discarded, err := br.Discard(n)
+		offset += int64(discarded)
+		return err
+	}
+
+	for {
+		header, _ := br.Peek(10)
+		if len(header) < 4 {
+			break
+		}
+
+		// ID3v2 tags may appear at the start and, rarely, between frames
+		if len(header) == 10 && string(header[0:3]) == "ID3" {
+			size := int(header[6])<<21 | int(header[7])<<14 | int(header[8])<<7 | int(header[9])
+			if header[5]&0x10 != 0 {
+				size += 10 // Footer
+			}
+			if err := skip(10 + size); err != nil {
+				break
+			}
+			continue
+		}
+
+		frame, ok := parseMP3FrameHeader(header)
+		if ok && resynced {
+			// Sync words also occur by chance in garbage, so after losing
+			// sync a frame only counts when another one follows it
+			if next, _ := br.Peek(frame.Size + 4); len(next) == frame.Size+4 {
+				_, ok = parseMP3FrameHeader(next[frame.Size:])
+			}
+		}
+		if !ok {
+			resynced = true
+			if err := skip(1); err != nil {
+				break
+			}
+			continue
+		}
+		resynced = false
+		frame.Offset = offset
+
+		if len(frames) == 0 {
+			data, _ := br.Peek(frame.Size)
+			if isXingFrame(data) {
+				if err := skip(frame.Size); err != nil {
+					break
+				}
+				continue
+			}
+		}
+
+		if err := skip(frame.Size); err != nil {
+			// A truncated last frame is dropped
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		frames = append(frames, frame)
+	}
+
+	if len(frames) == 0 {
+		return nil, errors.New("no MPEG audio frames found")
+	}
+	return frames, nil
+}
+
+// isXingFrame reports whether a frame holds a Xing, Info or VBRI header
+// instead of audio
+func isXingFrame(data []byte) bool {
+	if len(data) > 64 {
+		data = data[:64]
+	}
+	return bytes.Contains(data, []byte("Xing")) || bytes.Contains(data, []byte("Info")) || bytes.Contains(data, []byte("VBRI"))
+}
@@ -1,7 +1,7 @@
 package services
 
 import (
-	"errors"
+	"io"
 	"time"
 
 	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
@@ -10,36 +10,30 @@ import (
 type musicService struct {
 	musicRepo   domain.MusicRepository
 	artistRepo  domain.ArtistRepository
-	fileService FileService
+	storage     domain.Storage
+	blobService domain.AudioBlobService
 }
 
 // NewMusicService creates a new instance of MusicService
-func NewMusicService(musicRepo domain.MusicRepository, artistRepo domain.ArtistRepository, fileService FileService) domain.MusicService {
+func NewMusicService(musicRepo domain.MusicRepository, artistRepo domain.ArtistRepository, storage domain.Storage, blobService domain.AudioBlobService) domain.MusicService {
 	return &musicService{
 		musicRepo:   musicRepo,
 		artistRepo:  artistRepo,
-		fileService: fileService,
+		storage:     storage,
+		blobService: blobService,
 	}
 }
 
-func (s *musicService) UploadMusic(title string, artistID uint, album, filePath, username string, duration float64) (*domain.Music, error) {
+func (s *musicService) UploadMusic(music *domain.Music) (*domain.Music, error) {
 	// Verify artist exists
-	artist, err := s.artistRepo.FindByID(artistID)
+	artist, err := s.artistRepo.FindByID(music.ArtistID)
 	if err != nil {
 		return nil, err
 	}
 
-	music := &domain.Music{
-		Title:      title,
-		ArtistID:   artistID,
-		Artist:     artist,
-		Album:      album,
-		FilePath:   filePath,
-		UploadedBy: username,
-		Duration:   duration,
-		CreatedAt:  time.Now(),
-		UpdatedAt:  time.Now(),
-	}
+	music.Artist = artist
+	music.CreatedAt = time.Now()
+	music.UpdatedAt = time.Now()
 
 	if err := s.musicRepo.Create(music); err != nil {
 		return nil, err
@@ -52,38 +46,80 @@ func (s *musicService) GetMusic(id uint) (*domain.Music, error) {
 	return s.musicRepo.FindByID(id)
 }
 
-func (s *musicService) ListAllMusic() ([]*domain.Music, error) {
-	return s.musicRepo.FindAll()
+func (s *musicService) ListMusic(filter domain.MusicFilter, page domain.PageRequest) (*domain.Page[*domain.Music], error) {
+	return s.musicRepo.List(filter, page)
+}
+
+func (s *musicService) RecordPlay(id uint) error {
+	return s.musicRepo.IncrementPlayCount(id)
 }
 
-func (s *musicService) DeleteMusic(id uint, username string) error {
+func (s *musicService) DeleteMusic(id uint, actor domain.Actor) error {
 	// Get the file path before deleting the record
 	music, err := s.musicRepo.FindByID(id)
 	if err != nil {
 		return err
 	}
 
-	if music.UploadedBy != username {
-		return errors.New("unauthorized")
+	if music.UploadedBy != actor.Username && !actor.Can(domain.PermDeleteAnyMusic) {
+		return domain.ErrForbidden
 	}
 
-	// Delete the file
-	if err := s.fileService.DeleteFile(music.FilePath); err != nil {
+	// Files are released before the deletion is committed, so a failed
+	// release keeps the track and its reference to the files
+	err = s.musicRepo.Delete(id, func() error {
+		// Shared files are only deleted once the last track using them is gone
+		if music.BlobID != nil {
+			return s.blobService.Release(*music.BlobID)
+		}
+		if err := deleteHLSCache(s.storage, music.FilePath); err != nil {
+			return err
+		}
+		if err := s.storage.Delete(waveformKey(music.FilePath)); err != nil {
+			return err
+		}
+		return s.storage.Delete(music.FilePath)
+	})
+	if err != nil {
 		return err
 	}
 
-	// Delete from database
-	return s.musicRepo.Delete(id)
+	// The album is louder or quieter without the track
+	if music.AlbumID != nil && music.Loudness != nil {
+		return s.musicRepo.UpdateAlbumGain(*music.AlbumID)
+	}
+	return nil
 }
 
-func (s *musicService) GetUserMusic(username string) ([]*domain.Music, error) {
-	return s.musicRepo.FindByUploader(username)
+func (s *musicService) GetMusicByBlob(blobID uint) (*domain.Music, error) {
+	return s.musicRepo.FindByBlobID(blobID)
 }
 
 func (s *musicService) GetMusicByArtist(artistID uint) ([]*domain.Music, error) {
 	return s.musicRepo.FindByArtist(artistID)
 }
 
-func (s *musicService) SearchMusic(query string) ([]*domain.Music, error) {
-	return s.musicRepo.FindByTitle(query)
+func (s *musicService) OpenAudio(music *domain.Music) (io.ReadSeekCloser, *domain.ObjectInfo, error) {
+	info, err := s.storage.Stat(music.FilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewStorageReader(s.storage, info), info, nil
+}
+
+func (s *musicService) SetLoudness(music *domain.Music, analysis *domain.LoudnessAnalysis) error {
+	if err := s.musicRepo.UpdateLoudness(music.ID, analysis); err != nil {
+		return err
+	}
+	integrated, truePeak := analysis.Integrated, analysis.TruePeak
+	music.Loudness, music.TruePeak, music.TrackGain = &integrated, &truePeak, analysis.TrackGain()
+
+	if music.AlbumID != nil {
+		return s.UpdateAlbumGain(*music.AlbumID)
+	}
+	return nil
+}
+
+func (s *musicService) UpdateAlbumGain(albumID uint) error {
+	return s.musicRepo.UpdateAlbumGain(albumID)
 }
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	HashAlgorithmArgon2id = "argon2id"
+	HashAlgorithmBcrypt   = "bcrypt"
+)
+
+// Argon2idParams holds the cost parameters for argon2id hashing
+type Argon2idParams struct {
+	Memory      uint32 // in KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams follows the OWASP recommendation for argon2id
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// algorithmHasher is implemented by every concrete password hashing algorithm
+type algorithmHasher interface {
+	domain.PasswordHasher
+	// Recognizes reports whether the encoded hash was produced by this algorithm
+	Recognizes(encodedHash string) bool
+}
+
+type bcryptHasher struct {
+	cost int
+}
+
+// NewBcryptHasher creates a password hasher using bcrypt with the given cost
+func NewBcryptHasher(cost int) domain.PasswordHasher {
+	return &bcryptHasher{cost: cost}
+}
+
+func (h *bcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h *bcryptHasher) Verify(password, encodedHash string) (bool, bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encodedHash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+
+	cost, err := bcrypt.Cost([]byte(encodedHash))
+	if err != nil {
+		return false, false, err
+	}
+	return true, cost < h.cost, nil
+}
+
+func (h *bcryptHasher) Recognizes(encodedHash string) bool {
+	return strings.HasPrefix(encodedHash, "$2a$") ||
+		strings.HasPrefix(encodedHash, "$2b$") ||
+		strings.HasPrefix(encodedHash, "$2y$")
+}
+
+type argon2idHasher struct {
+	params Argon2idParams
+}
+
+// NewArgon2idHasher creates a password hasher using argon2id with the given parameters
+func NewArgon2idHasher(params Argon2idParams) domain.PasswordHasher {
+	return &argon2idHasher{params: params}
+}
+
+func (h *argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+
+	// Encode in the PHC string format used by the reference implementation
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.params.Memory,
+		h.params.Iterations,
+		h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *argon2idHasher) Verify(password, encodedHash string) (bool, bool, error) {
+	params, salt, key, err := decodeArgon2idHash(encodedHash)
+	if err != nil {
+		return false, false, err
+	}
+
+	otherKey := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+		return false, false, nil
+	}
+
+	needsRehash := params.Memory != h.params.Memory ||
+		params.Iterations != h.params.Iterations ||
+		params.Parallelism != h.params.Parallelism ||
+		params.KeyLength != h.params.KeyLength
+	return true, needsRehash, nil
+}
+
+func (h *argon2idHasher) Recognizes(encodedHash string) bool {
+	return strings.HasPrefix(encodedHash, "$argon2id$")
+}
+
+// decodeArgon2idHash parses a hash in the $argon2id$v=..$m=..,t=..,p=..$salt$key format
+func decodeArgon2idHash(encodedHash string) (*Argon2idParams, []byte, []byte, error) {
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 6 || parts[1] != HashAlgorithmArgon2id {
+		return nil, nil, nil, domain.ErrInvalidPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, nil, nil, domain.ErrInvalidPasswordHash
+	}
+
+	params := &Argon2idParams{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return nil, nil, nil, domain.ErrInvalidPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, domain.ErrInvalidPasswordHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, nil, nil, domain.ErrInvalidPasswordHash
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
+
+// passwordHasher hashes new passwords with the preferred algorithm while
+// still verifying hashes produced by the other supported algorithms and
+// legacy plaintext passwords stored before hashing was introduced
+type passwordHasher struct {
+	preferred algorithmHasher
+	hashers   []algorithmHasher
+}
+
+// NewPasswordHasher creates a password hasher that hashes with the given
+// algorithm ("argon2id" or "bcrypt", defaults to argon2id)
+func NewPasswordHasher(algorithm string) domain.PasswordHasher {
+	argon := &argon2idHasher{params: DefaultArgon2idParams}
+	bc := &bcryptHasher{cost: bcrypt.DefaultCost}
+
+	preferred := algorithmHasher(argon)
+	if strings.EqualFold(algorithm, HashAlgorithmBcrypt) {
+		preferred = bc
+	}
+
+	return &passwordHasher{
+		preferred: preferred,
+		hashers:   []algorithmHasher{argon, bc},
+	}
+}
+
+func (h *passwordHasher) Hash(password string) (string, error) {
+	return h.preferred.Hash(password)
+}
+
+func (h *passwordHasher) Verify(password, encodedHash string) (bool, bool, error) {
+	for _, hasher := range h.hashers {
+		if !hasher.Recognizes(encodedHash) {
+			continue
+		}
+
+		match, needsRehash, err := hasher.Verify(password, encodedHash)
+		if err != nil || !match {
+			return false, false, err
+		}
+		return true, needsRehash || hasher != h.preferred, nil
+	}
+
+	// Rows created before hashing was introduced hold the plaintext password
+	if subtle.ConstantTimeCompare([]byte(password), []byte(encodedHash)) == 1 {
+		return true, true, nil
+	}
+	return false, false, nil
+}
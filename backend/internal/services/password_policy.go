@@ -0,0 +1,55 @@
+package services
+
+import (
+	_ "embed"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+)
+
+const (
+	minPasswordLength = 8
+	// bcrypt ignores everything past 72 bytes, so longer passwords are rejected
+	maxPasswordBytes = 72
+)
+
+//go:embed common_passwords.txt
+var commonPasswordsList string
+
+type passwordPolicy struct {
+	commonPasswords map[string]struct{}
+}
+
+// NewPasswordPolicy creates a password policy that enforces length limits
+// and rejects passwords from the embedded list of commonly breached passwords
+func NewPasswordPolicy() domain.PasswordPolicy {
+	common := make(map[string]struct{})
+	for _, line := range strings.Split(commonPasswordsList, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			common[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	return &passwordPolicy{commonPasswords: common}
+}
+
+func (p *passwordPolicy) Validate(username, password string) error {
+	if utf8.RuneCountInString(password) < minPasswordLength {
+		return domain.ErrPasswordTooShort
+	}
+
+	if len(password) > maxPasswordBytes {
+		return domain.ErrPasswordTooLong
+	}
+
+	if strings.EqualFold(password, username) {
+		return domain.ErrPasswordIsUsername
+	}
+
+	if _, ok := p.commonPasswords[strings.ToLower(password)]; ok {
+		return domain.ErrPasswordTooCommon
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+)
+
+// DefaultExportURLTTL is how long the stream URLs in exported playlists work
+const DefaultExportURLTTL = 24 * time.Hour
+
+type playlistExporter struct{}
+
+// NewPlaylistExporter creates a new instance of PlaylistExporter writing
+// extended M3U, XSPF (https://xspf.org/spec) and JSPF
+func NewPlaylistExporter() domain.PlaylistExporter {
+	return &playlistExporter{}
+}
+
+func (e *playlistExporter) ContentType(format string) (string, string, error) {
+	switch format {
+	case domain.PlaylistFormatM3U8:
+		return "audio/x-mpegurl; charset=utf-8", ".m3u8", nil
+	case domain.PlaylistFormatXSPF:
+		return "application/xspf+xml; charset=utf-8", ".xspf", nil
+	case domain.PlaylistFormatJSPF:
+		return "application/json; charset=utf-8", ".jspf", nil
+	}
+	return "", "", domain.ErrUnsupportedPlaylistFormat
+}
+
+func (e *playlistExporter) Export(w io.Writer, format string, playlist *domain.Playlist, songs []*domain.Music, locate func(*domain.Music) string) error {
+	switch format {
+	case domain.PlaylistFormatM3U8:
+		return writeM3U8(w, playlist, songs, locate)
+	case domain.PlaylistFormatXSPF:
+		return writeXSPF(w, playlist, songs, locate)
+	case domain.PlaylistFormatJSPF:
+		return writeJSPF(w, playlist, songs, locate)
+	}
+	return domain.ErrUnsupportedPlaylistFormat
+}
+
+// writeM3U8 writes an extended M3U playlist in UTF-8
+func writeM3U8(w io.Writer, playlist *domain.Playlist, songs []*domain.Music, locate func(*domain.Music) string) error {
+	buf := bufio.NewWriter(w)
+	fmt.Fprintln(buf, "#EXTM3U")
+	fmt.Fprintf(buf, "#PLAYLIST:%s\n", m3uText(playlist.Name))
+	for _, song := range songs {
+		// Players read unknown durations as -1
+		duration := -1
+		if song.Duration > 0 {
+			duration = int(math.Round(song.Duration))
+		}
+		title := song.Title
+		if artist := songArtistName(song); artist != "" {
+			title = artist + " - " + title
+		}
+		fmt.Fprintf(buf, "#EXTINF:%d,%s\n", duration, m3uText(title))
+		fmt.Fprintln(buf, locate(song))
+	}
+	return buf.Flush()
+}
+
+// m3uText keeps text on the single line M3U directives allow
+func m3uText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// xspfPlaylist is the XML form of an XSPF playlist
+type xspfPlaylist struct {
+	XMLName   xml.Name    `xml:"http://xspf.org/ns/0/ playlist"`
+	Version   string      `xml:"version,attr"`
+	Title     string      `xml:"title,omitempty"`
+	Creator   string      `xml:"creator,omitempty"`
+	Date      string      `xml:"date,omitempty"`
+	TrackList []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location string `xml:"location"`
+	Title    string `xml:"title,omitempty"`
+	Creator  string `xml:"creator,omitempty"`
+	Album    string `xml:"album,omitempty"`
+	TrackNum int    `xml:"trackNum,omitempty"`
+	Duration int64  `xml:"duration,omitempty"` // In milliseconds
+}
+
+// writeXSPF writes an XSPF version 1 playlist
+func writeXSPF(w io.Writer, playlist *domain.Playlist, songs []*domain.Music, locate func(*domain.Music) string) error {
+	document := xspfPlaylist{
+		Version:   "1",
+		Title:     playlist.Name,
+		Creator:   playlist.CreatedBy,
+		Date:      playlistDate(playlist),
+		TrackList: make([]xspfTrack, len(songs)),
+	}
+	for i, song := range songs {
+		document.TrackList[i] = xspfTrack{
+			Location: locate(song),
+			Title:    song.Title,
+			Creator:  songArtistName(song),
+			Album:    song.Album,
+			TrackNum: song.TrackNumber,
+			Duration: durationMillis(song.Duration),
+		}
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// jspfPlaylist is the JSON form of an XSPF playlist
+type jspfPlaylist struct {
+	Playlist struct {
+		Title   string      `json:"title,omitempty"`
+		Creator string      `json:"creator,omitempty"`
+		Date    string      `json:"date,omitempty"`
+		Track   []jspfTrack `json:"track"`
+	} `json:"playlist"`
+}
+
+type jspfTrack struct {
+	Location []string `json:"location"`
+	Title    string   `json:"title,omitempty"`
+	Creator  string   `json:"creator,omitempty"`
+	Album    string   `json:"album,omitempty"`
+	TrackNum int      `json:"trackNum,omitempty"`
+	Duration int64    `json:"duration,omitempty"` // In milliseconds
+}
+
+// writeJSPF writes a JSPF playlist
+func writeJSPF(w io.Writer, playlist *domain.Playlist, songs []*domain.Music, locate func(*domain.Music) string) error {
+	var document jspfPlaylist
+	document.Playlist.Title = playlist.Name
+	document.Playlist.Creator = playlist.CreatedBy
+	document.Playlist.Date = playlistDate(playlist)
+	document.Playlist.Track = make([]jspfTrack, len(songs))
+	for i, song := range songs {
+		document.Playlist.Track[i] = jspfTrack{
+			Location: []string{locate(song)},
+			Title:    song.Title,
+			Creator:  songArtistName(song),
+			Album:    song.Album,
+			TrackNum: song.TrackNumber,
+			Duration: durationMillis(song.Duration),
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(document)
+}
+
+func songArtistName(song *domain.Music) string {
+	if song.Artist == nil {
+		return ""
+	}
+	return song.Artist.Name
+}
+
+func playlistDate(playlist *domain.Playlist) string {
+	if playlist.CreatedAt.IsZero() {
+		return ""
+	}
+	return playlist.CreatedAt.UTC().Format(time.RFC3339)
+}
+
+func durationMillis(seconds float64) int64 {
+	return int64(math.Round(seconds * 1000))
+}
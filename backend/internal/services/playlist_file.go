@@ -0,0 +1,130 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// playlistFile is a playlist read from an M3U or PLS file
+type playlistFile struct {
+	Name    string
+	Entries []string // Locations of the tracks in order, as written in the file
+}
+
+// isPlaylistFile reports whether a file name has a playlist extension
+func isPlaylistFile(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".m3u", ".m3u8", ".pls":
+		return true
+	}
+	return false
+}
+
+// parsePlaylistFile reads an M3U, M3U8 or PLS playlist. The name defaults to
+// the file name without its extension
+func parsePlaylistFile(name string, r io.Reader) (*playlistFile, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	text := decodePlaylistText(data)
+
+	playlist := &playlistFile{Name: strings.TrimSuffix(path.Base(name), path.Ext(name))}
+	if strings.ToLower(path.Ext(name)) == ".pls" {
+		err = parsePLS(text, playlist)
+	} else {
+		parseM3U(text, playlist)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return playlist, nil
+}
+
+// parseM3U reads the entries of an M3U playlist, extended or not. Comments
+// and directives other than the playlist title are ignored
+func parseM3U(text string, playlist *playlistFile) {
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#PLAYLIST:"):
+			if title := strings.TrimSpace(strings.TrimPrefix(line, "#PLAYLIST:")); title != "" {
+				playlist.Name = title
+			}
+		case strings.HasPrefix(line, "#"):
+		default:
+			playlist.Entries = append(playlist.Entries, line)
+		}
+	}
+}
+
+// parsePLS reads the entries of a PLS playlist in the order of their numbers
+func parsePLS(text string, playlist *playlistFile) error {
+	files := make(map[int]string)
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok || len(key) <= 4 || !strings.EqualFold(key[:4], "file") {
+			continue
+		}
+		n, err := strconv.Atoi(key[4:])
+		if err != nil {
+			return fmt.Errorf("invalid PLS entry %q", key)
+		}
+		files[n] = strings.TrimSpace(value)
+	}
+
+	numbers := make([]int, 0, len(files))
+	for n := range files {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	for _, n := range numbers {
+		playlist.Entries = append(playlist.Entries, files[n])
+	}
+	return nil
+}
+
+// decodePlaylistText returns the text of a playlist file. M3U8 is UTF-8, but
+// plain M3U and PLS files are often written in Latin-1
+func decodePlaylistText(data []byte) string {
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	if utf8.ValidString(text) {
+		return text
+	}
+
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// playlistEntryPath turns a playlist entry into a slash separated path
+// relative to the playlist's directory, or returns false for remote URLs
+func playlistEntryPath(playlistDir, entry string) (string, bool) {
+	if strings.Contains(entry, "://") {
+		u, err := url.Parse(entry)
+		if err != nil || u.Scheme != "file" {
+			return "", false
+		}
+		entry = u.Path
+	}
+
+	entry = strings.ReplaceAll(entry, `\`, "/")
+	if path.IsAbs(entry) || (len(entry) > 1 && entry[1] == ':') {
+		// Absolute paths of the machine the playlist was made on, only the file
+		// name can be matched
+		return entry, true
+	}
+	return path.Join(playlistDir, entry), true
+}
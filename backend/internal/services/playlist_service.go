@@ -2,6 +2,8 @@ package services
 
 import (
 	"errors"
+	"fmt"
+	"log"
 	"time"
 
 	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
@@ -10,13 +12,18 @@ import (
 type playlistService struct {
 	playlistRepo domain.PlaylistRepository
 	musicRepo    domain.MusicRepository
+	userRepo     domain.UserRepository
+	notifier     domain.PlaylistNotifier
 }
 
-// NewPlaylistService creates a new instance of PlaylistService
-func NewPlaylistService(playlistRepo domain.PlaylistRepository, musicRepo domain.MusicRepository) domain.PlaylistService {
+// NewPlaylistService creates a new instance of PlaylistService. Changes to
+// shared playlists are sent to their members through the notifier
+func NewPlaylistService(playlistRepo domain.PlaylistRepository, musicRepo domain.MusicRepository, userRepo domain.UserRepository, notifier domain.PlaylistNotifier) domain.PlaylistService {
 	return &playlistService{
 		playlistRepo: playlistRepo,
 		musicRepo:    musicRepo,
+		userRepo:     userRepo,
+		notifier:     notifier,
 	}
 }
 
@@ -26,6 +33,7 @@ func (s *playlistService) CreatePlaylist(name, username string) (*domain.Playlis
 		CreatedBy: username,
 		CreatedAt: time.Now(),
 		IsOwner:   true, // Creator is always the owner
+		Role:      domain.PlaylistRoleOwner,
 	}
 
 	if err := s.playlistRepo.Create(playlist); err != nil {
@@ -35,8 +43,8 @@ func (s *playlistService) CreatePlaylist(name, username string) (*domain.Playlis
 	return playlist, nil
 }
 
-func (s *playlistService) GetPlaylist(id uint, username string) (*domain.Playlist, error) {
-	playlist, err := s.playlistRepo.FindByID(id)
+func (s *playlistService) GetPlaylist(id uint, actor domain.Actor) (*domain.Playlist, error) {
+	playlist, err := s.authorize(id, actor, domain.PlaylistRoleViewer, "view the playlist")
 	if err != nil {
 		return nil, err
 	}
@@ -47,85 +55,409 @@ func (s *playlistService) GetPlaylist(id uint, username string) (*domain.Playlis
 	}
 
 	playlist.Songs = songs
-	playlist.IsOwner = playlist.CreatedBy == username
 	return playlist, nil
 }
 
-func (s *playlistService) ListUserPlaylists(username string) ([]*domain.Playlist, error) {
-	playlists, err := s.playlistRepo.FindByCreator(username)
+func (s *playlistService) ListUserPlaylists(username string, page domain.PageRequest) (*domain.Page[*domain.Playlist], error) {
+	playlists, err := s.playlistRepo.FindByMember(username, page)
 	if err != nil {
 		return nil, err
 	}
 
-	// Set IsOwner to true for all playlists in the user's list
-	for _, playlist := range playlists {
-		playlist.IsOwner = true
+	var shared []uint
+	for _, playlist := range playlists.Items {
+		if playlist.CreatedBy != username {
+			shared = append(shared, playlist.ID)
+		}
+	}
+	roles, err := s.playlistRepo.MemberRoles(username, shared)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, playlist := range playlists.Items {
+		playlist.IsOwner = playlist.CreatedBy == username
+		if playlist.IsOwner {
+			playlist.Role = domain.PlaylistRoleOwner
+		} else {
+			playlist.Role = roles[playlist.ID]
+		}
 	}
 
 	return playlists, nil
 }
 
-func (s *playlistService) DeletePlaylist(id uint, username string) error {
-	playlist, err := s.playlistRepo.FindByID(id)
+func (s *playlistService) DeletePlaylist(id uint, actor domain.Actor) error {
+	playlist, err := s.authorize(id, actor, domain.PlaylistRoleOwner, "delete the playlist")
 	if err != nil {
 		return err
 	}
 
-	// Check if the user is the owner of the playlist
-	if playlist.CreatedBy != username {
-		return errors.New("unauthorized: only playlist owner can delete the playlist")
+	// Members are gone along with the playlist, find them first
+	recipients := s.recipients(playlist, actor.Username)
+	if err := s.playlistRepo.Delete(id); err != nil {
+		return err
 	}
 
-	return s.playlistRepo.Delete(id)
+	s.notify(recipients, &domain.PlaylistEvent{
+		Kind:       domain.PlaylistEventDeleted,
+		PlaylistID: id,
+		Actor:      actor.Username,
+	})
+	return nil
 }
 
-func (s *playlistService) AddSongToPlaylist(playlistID, musicID uint, username string) error {
-	// Get playlist to check ownership
-	playlist, err := s.playlistRepo.FindByID(playlistID)
+func (s *playlistService) AddSongToPlaylist(playlistID, musicID uint, actor domain.Actor) (*domain.PlaylistEntry, error) {
+	playlist, err := s.authorize(playlistID, actor, domain.PlaylistRoleContributor, "add songs")
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify music exists
+	music, err := s.musicRepo.FindByID(musicID)
+	if err != nil {
+		return nil, errors.New("music not found")
+	}
+
+	entry := &domain.PlaylistEntry{
+		PlaylistID: playlistID,
+		MusicID:    musicID,
+		AddedBy:    actor.Username,
+		AddedAt:    time.Now(),
+	}
+	if err := s.playlistRepo.AddEntry(entry); err != nil {
+		return nil, err
+	}
+
+	entry.Music = music
+	s.notify(s.recipients(playlist, actor.Username), &domain.PlaylistEvent{
+		Kind:       domain.PlaylistEventEntryAdded,
+		PlaylistID: playlistID,
+		Actor:      actor.Username,
+		Entry:      entry,
+	})
+	return entry, nil
+}
+
+func (s *playlistService) RemoveSongFromPlaylist(playlistID, musicID uint, actor domain.Actor) error {
+	playlist, err := s.authorize(playlistID, actor, domain.PlaylistRoleEditor, "remove songs")
 	if err != nil {
 		return err
 	}
 
-	// Check if the user is the owner of the playlist
-	if playlist.CreatedBy != username {
-		return errors.New("unauthorized: only playlist owner can add songs")
+	removed, err := s.playlistRepo.RemoveSong(playlistID, musicID)
+	if err != nil {
+		return err
 	}
 
-	// Verify music exists
-	_, err = s.musicRepo.FindByID(musicID)
+	if len(removed) > 0 {
+		s.notify(s.recipients(playlist, actor.Username), &domain.PlaylistEvent{
+			Kind:       domain.PlaylistEventEntriesRemoved,
+			PlaylistID: playlistID,
+			Actor:      actor.Username,
+			EntryIDs:   removed,
+		})
+	}
+	return nil
+}
+
+func (s *playlistService) GetPlaylistSongs(playlistID uint, page domain.PageRequest, actor domain.Actor) (*domain.Page[*domain.Music], error) {
+	if _, err := s.authorize(playlistID, actor, domain.PlaylistRoleViewer, "view songs"); err != nil {
+		return nil, err
+	}
+
+	return s.playlistRepo.ListSongs(playlistID, page)
+}
+
+func (s *playlistService) RemovePlaylistEntry(playlistID, entryID uint, actor domain.Actor) error {
+	playlist, err := s.authorize(playlistID, actor, domain.PlaylistRoleContributor, "remove songs")
+	if err != nil {
+		return err
+	}
+
+	// Contributors may only take back the songs they added
+	if !playlist.Role.Allows(domain.PlaylistRoleEditor) {
+		entry, err := s.playlistRepo.FindEntry(playlistID, entryID)
+		if err != nil {
+			return err
+		}
+		if entry.AddedBy != actor.Username {
+			return fmt.Errorf("%w: contributors can only remove songs they added", domain.ErrForbidden)
+		}
+	}
+
+	if err := s.playlistRepo.RemoveEntry(playlistID, entryID); err != nil {
+		return err
+	}
+
+	s.notify(s.recipients(playlist, actor.Username), &domain.PlaylistEvent{
+		Kind:       domain.PlaylistEventEntriesRemoved,
+		PlaylistID: playlistID,
+		Actor:      actor.Username,
+		EntryIDs:   []uint{entryID},
+	})
+	return nil
+}
+
+func (s *playlistService) GetPlaylistEntries(playlistID uint, actor domain.Actor) ([]*domain.PlaylistEntry, error) {
+	if _, err := s.authorize(playlistID, actor, domain.PlaylistRoleViewer, "view songs"); err != nil {
+		return nil, err
+	}
+
+	return s.playlistRepo.GetEntries(playlistID)
+}
+
+func (s *playlistService) MovePlaylistEntry(playlistID, entryID uint, index int, actor domain.Actor) ([]*domain.PlaylistEntry, error) {
+	playlist, err := s.authorize(playlistID, actor, domain.PlaylistRoleEditor, "reorder songs")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.playlistRepo.MoveEntry(playlistID, entryID, index); err != nil {
+		return nil, err
+	}
+	return s.reordered(playlist, actor)
+}
+
+func (s *playlistService) ReorderPlaylistEntries(playlistID uint, entryIDs []uint, actor domain.Actor) ([]*domain.PlaylistEntry, error) {
+	playlist, err := s.authorize(playlistID, actor, domain.PlaylistRoleEditor, "reorder songs")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.playlistRepo.ReorderEntries(playlistID, entryIDs); err != nil {
+		return nil, err
+	}
+	return s.reordered(playlist, actor)
+}
+
+// reordered returns the entries of a playlist after a change of their order
+// and sends the new order to the members
+func (s *playlistService) reordered(playlist *domain.Playlist, actor domain.Actor) ([]*domain.PlaylistEntry, error) {
+	entries, err := s.playlistRepo.GetEntries(playlist.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	order := make([]uint, len(entries))
+	for i, entry := range entries {
+		order[i] = entry.ID
+	}
+	s.notify(s.recipients(playlist, actor.Username), &domain.PlaylistEvent{
+		Kind:       domain.PlaylistEventEntriesReordered,
+		PlaylistID: playlist.ID,
+		Actor:      actor.Username,
+		EntryIDs:   order,
+	})
+	return entries, nil
+}
+
+func (s *playlistService) ListMembers(playlistID uint, actor domain.Actor) ([]*domain.PlaylistMember, error) {
+	if _, err := s.authorize(playlistID, actor, domain.PlaylistRoleViewer, "view members"); err != nil {
+		return nil, err
+	}
+
+	return s.playlistRepo.FindMembers(playlistID)
+}
+
+func (s *playlistService) InviteMember(playlistID uint, username string, role domain.PlaylistRole, actor domain.Actor) (*domain.PlaylistMember, error) {
+	playlist, err := s.authorize(playlistID, actor, domain.PlaylistRoleOwner, "invite members")
+	if err != nil {
+		return nil, err
+	}
+	if !role.IsValid() {
+		return nil, domain.ErrInvalidPlaylistRole
+	}
+	if username == playlist.CreatedBy {
+		return nil, domain.ErrInvalidPlaylistInvite
+	}
+	if _, err := s.userRepo.FindByUsername(username); err != nil {
+		return nil, domain.ErrInviteeNotFound
+	}
+
+	member := &domain.PlaylistMember{
+		PlaylistID: playlistID,
+		Username:   username,
+		Role:       role,
+		InvitedBy:  actor.Username,
+		InvitedAt:  time.Now(),
+	}
+	if err := s.playlistRepo.AddMember(member); err != nil {
+		return nil, err
+	}
+
+	// Only the invitee hears of the invitation, members see them once they join
+	member.Playlist = playlist
+	s.notify([]string{username}, &domain.PlaylistEvent{
+		Kind:       domain.PlaylistEventMemberInvited,
+		PlaylistID: playlistID,
+		Actor:      actor.Username,
+		Member:     member,
+	})
+	member.Playlist = nil
+	return member, nil
+}
+
+func (s *playlistService) UpdateMemberRole(playlistID uint, username string, role domain.PlaylistRole, actor domain.Actor) (*domain.PlaylistMember, error) {
+	playlist, err := s.authorize(playlistID, actor, domain.PlaylistRoleOwner, "change member roles")
 	if err != nil {
-		return errors.New("music not found")
+		return nil, err
+	}
+	if !role.IsValid() {
+		return nil, domain.ErrInvalidPlaylistRole
 	}
 
-	return s.playlistRepo.AddSong(playlistID, musicID)
+	member, err := s.playlistRepo.FindMember(playlistID, username)
+	if err != nil {
+		return nil, err
+	}
+	member.Role = role
+	if err := s.playlistRepo.UpdateMember(member); err != nil {
+		return nil, err
+	}
+
+	recipients := s.recipients(playlist, actor.Username)
+	if member.IsPending() {
+		recipients = []string{username}
+	}
+	s.notify(recipients, &domain.PlaylistEvent{
+		Kind:       domain.PlaylistEventMemberUpdated,
+		PlaylistID: playlistID,
+		Actor:      actor.Username,
+		Member:     member,
+	})
+	return member, nil
 }
 
-func (s *playlistService) RemoveSongFromPlaylist(playlistID, musicID uint, username string) error {
-	// Get playlist to check ownership
+func (s *playlistService) RemoveMember(playlistID uint, username string, actor domain.Actor) error {
 	playlist, err := s.playlistRepo.FindByID(playlistID)
 	if err != nil {
 		return err
 	}
+	if username != actor.Username && !canManagePlaylist(playlist, actor) {
+		return fmt.Errorf("%w: only the playlist owner can remove other members", domain.ErrForbidden)
+	}
+
+	member, err := s.playlistRepo.FindMember(playlistID, username)
+	if err != nil {
+		return err
+	}
+	if err := s.playlistRepo.RemoveMember(playlistID, username); err != nil {
+		return err
+	}
+
+	// The removed member is told as well, unless they left on their own
+	// Pending invitations concern only the owner and the invitee
+	recipients := s.recipients(playlist, actor.Username)
+	if member.IsPending() {
+		recipients = nil
+		if actor.Username != playlist.CreatedBy {
+			recipients = append(recipients, playlist.CreatedBy)
+		}
+	}
+	if username != actor.Username {
+		recipients = append(recipients, username)
+	}
+	s.notify(recipients, &domain.PlaylistEvent{
+		Kind:       domain.PlaylistEventMemberLeft,
+		PlaylistID: playlistID,
+		Actor:      actor.Username,
+		Member:     member,
+	})
+	return nil
+}
+
+func (s *playlistService) AcceptInvitation(playlistID uint, actor domain.Actor) (*domain.PlaylistMember, error) {
+	playlist, err := s.playlistRepo.FindByID(playlistID)
+	if err != nil {
+		return nil, err
+	}
+
+	member, err := s.playlistRepo.FindMember(playlistID, actor.Username)
+	if err != nil {
+		return nil, err
+	}
+	if !member.IsPending() {
+		return member, nil
+	}
 
-	// Check if the user is the owner of the playlist
-	if playlist.CreatedBy != username {
-		return errors.New("unauthorized: only playlist owner can remove songs")
+	now := time.Now()
+	member.AcceptedAt = &now
+	if err := s.playlistRepo.UpdateMember(member); err != nil {
+		return nil, err
 	}
 
-	return s.playlistRepo.RemoveSong(playlistID, musicID)
+	s.notify(s.recipients(playlist, actor.Username), &domain.PlaylistEvent{
+		Kind:       domain.PlaylistEventMemberJoined,
+		PlaylistID: playlistID,
+		Actor:      actor.Username,
+		Member:     member,
+	})
+	return member, nil
+}
+
+func (s *playlistService) ListInvitations(username string) ([]*domain.PlaylistMember, error) {
+	return s.playlistRepo.FindInvitations(username)
 }
 
-func (s *playlistService) GetPlaylistSongs(playlistID uint, username string) ([]*domain.Music, error) {
-	// Get playlist to check ownership
+// authorize finds a playlist and checks that the actor has at least the given
+// role in it. The playlist is returned with the role of the actor set
+func (s *playlistService) authorize(playlistID uint, actor domain.Actor, role domain.PlaylistRole, action string) (*domain.Playlist, error) {
 	playlist, err := s.playlistRepo.FindByID(playlistID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Check if the user is the owner of the playlist
-	if playlist.CreatedBy != username {
-		return nil, errors.New("unauthorized: only playlist owner can view songs")
+	switch {
+	case canManagePlaylist(playlist, actor):
+		playlist.Role = domain.PlaylistRoleOwner
+	default:
+		member, err := s.playlistRepo.FindMember(playlistID, actor.Username)
+		if err != nil && !errors.Is(err, domain.ErrPlaylistMemberNotFound) {
+			return nil, err
+		}
+		if member != nil && !member.IsPending() {
+			playlist.Role = member.Role
+		}
+	}
+
+	if !playlist.Role.Allows(role) {
+		return nil, fmt.Errorf("%w: %s role required to %s", domain.ErrForbidden, role, action)
+	}
+	playlist.IsOwner = playlist.CreatedBy == actor.Username
+	return playlist, nil
+}
+
+// recipients returns the owner and accepted members of a playlist other than
+// the given user
+func (s *playlistService) recipients(playlist *domain.Playlist, except string) []string {
+	var recipients []string
+	if playlist.CreatedBy != except {
+		recipients = append(recipients, playlist.CreatedBy)
 	}
 
-	return s.playlistRepo.GetSongs(playlistID)
+	members, err := s.playlistRepo.FindMembers(playlist.ID)
+	if err != nil {
+		log.Printf("Failed to find members of playlist %d: %v", playlist.ID, err)
+		return recipients
+	}
+	for _, member := range members {
+		if !member.IsPending() && member.Username != except {
+			recipients = append(recipients, member.Username)
+		}
+	}
+	return recipients
+}
+
+// notify sends a playlist event to the given users
+func (s *playlistService) notify(recipients []string, event *domain.PlaylistEvent) {
+	if s.notifier == nil || len(recipients) == 0 {
+		return
+	}
+	s.notifier.NotifyPlaylist(recipients, event)
+}
+
+// canManagePlaylist reports whether the actor owns the playlist or may manage any playlist
+func canManagePlaylist(playlist *domain.Playlist, actor domain.Actor) bool {
+	return playlist.CreatedBy == actor.Username || actor.Can(domain.PermManageAnyPlaylist)
 }
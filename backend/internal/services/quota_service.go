@@ -0,0 +1,81 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+)
+
+// DefaultQuotas are the quotas of roles not configured otherwise. Admins and
+// moderators are not limited, listeners cannot upload at all
+var DefaultQuotas = map[domain.Role]domain.Quota{
+	domain.RoleUploader: {
+		MaxBytes:    10 << 30,
+		MaxTracks:   2000,
+		MaxFileSize: 512 << 20,
+		MaxDuration: 3 * 60 * 60,
+	},
+}
+
+type quotaService struct {
+	musicRepo domain.MusicRepository
+	userRepo  domain.UserRepository
+	quotas    map[domain.Role]domain.Quota
+}
+
+// NewQuotaService creates a new instance of QuotaService enforcing the given
+// quota per role. Roles without a quota are not limited
+func NewQuotaService(musicRepo domain.MusicRepository, userRepo domain.UserRepository, quotas map[domain.Role]domain.Quota) domain.QuotaService {
+	return &quotaService{
+		musicRepo: musicRepo,
+		userRepo:  userRepo,
+		quotas:    quotas,
+	}
+}
+
+func (s *quotaService) GetQuota(role domain.Role) domain.Quota {
+	return s.quotas[role]
+}
+
+func (s *quotaService) GetUsage(username string) (*domain.Usage, error) {
+	// The role is read from the database rather than a token, since uploads
+	// are checked again by background jobs
+	user, err := s.userRepo.FindByUsername(username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+
+	bytes, tracks, err := s.musicRepo.UploaderUsage(username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage: %w", err)
+	}
+	return &domain.Usage{
+		Bytes:  bytes,
+		Tracks: tracks,
+		Quota:  s.GetQuota(user.Role),
+	}, nil
+}
+
+func (s *quotaService) CheckUpload(username string, size int64, duration float64) error {
+	usage, err := s.GetUsage(username)
+	if err != nil {
+		return err
+	}
+	quota := usage.Quota
+
+	if quota.MaxFileSize > 0 && size > quota.MaxFileSize {
+		return fmt.Errorf("%w: %d bytes, at most %d allowed", domain.ErrFileTooLarge, size, quota.MaxFileSize)
+	}
+	if quota.MaxDuration > 0 && duration > quota.MaxDuration {
+		return fmt.Errorf("%w: %.0f seconds, at most %.0f allowed", domain.ErrTrackTooLong, duration, quota.MaxDuration)
+	}
+	if quota.MaxTracks > 0 && usage.Tracks+1 > quota.MaxTracks {
+		return fmt.Errorf("%w: at most %d tracks allowed", domain.ErrQuotaExceeded, quota.MaxTracks)
+	}
+	// A file of unknown size is let through as long as some space is left,
+	// it is checked again once downloaded
+	if quota.MaxBytes > 0 && (usage.Bytes+size > quota.MaxBytes || usage.Bytes >= quota.MaxBytes) {
+		return fmt.Errorf("%w: %d of %d bytes used", domain.ErrQuotaExceeded, usage.Bytes, quota.MaxBytes)
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+)
+
+const (
+	// DefaultFetchMaxRedirects is how many redirects a fetch may follow
+	DefaultFetchMaxRedirects = 5
+	// DefaultFetchMaxSize is the largest remote file that may be fetched
+	DefaultFetchMaxSize int64 = 512 << 20
+)
+
+// blockedNetworks are the ranges remote fetches may never connect to unless
+// allowed explicitly: private, loopback, link-local (including cloud metadata
+// services), shared, reserved and multicast addresses, and IPv6 prefixes
+// that tunnel to IPv4
+var blockedNetworks = mustParsePrefixes(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"64:ff9b::/96",
+	"64:ff9b:1::/48",
+	"100::/64",
+	"2001::/32",
+	"2001:db8::/32",
+	"2002::/16",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+// FetchPolicy restricts what remote fetches may reach
+type FetchPolicy struct {
+	AllowedHosts    []string       // When set, only these hosts may be fetched. "*.example.com" matches subdomains
+	DeniedHosts     []string       // Hosts that may never be fetched, same patterns as AllowedHosts
+	AllowedNetworks []netip.Prefix // Exempt from the blocked ranges, e.g. an internal mirror
+	DeniedNetworks  []netip.Prefix // Blocked in addition to the built-in ranges
+	MaxRedirects    int
+	MaxSize         int64 // In bytes
+}
+
+type remoteFetcher struct {
+	client *http.Client
+	policy FetchPolicy
+}
+
+// NewRemoteFetcher creates a new instance of RemoteFetcher enforcing the
+// policy. Addresses are checked when connecting, after DNS resolution, so
+// hosts resolving to internal addresses are refused as well
+func NewRemoteFetcher(policy FetchPolicy) domain.RemoteFetcher {
+	f := &remoteFetcher{policy: policy}
+
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			return f.checkAddress(address)
+		},
+	}
+	f.client = &http.Client{
+		// Proxies are not used, the policy must see the real destination
+		Transport: &policyTransport{
+			fetcher: f,
+			base: &http.Transport{
+				DialContext:           dialer.DialContext,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ResponseHeaderTimeout: 30 * time.Second,
+				MaxIdleConns:          10,
+				IdleConnTimeout:       90 * time.Second,
+			},
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > policy.MaxRedirects {
+				return fmt.Errorf("%w: too many redirects", domain.ErrURLNotAllowed)
+			}
+			return nil
+		},
+	}
+	return f
+}
+
+func (f *remoteFetcher) CheckURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", domain.ErrURLNotAllowed, err)
+	}
+	return f.checkURL(u)
+}
+
+func (f *remoteFetcher) ValidateLink(ctx context.Context, rawURL string) error {
+	if err := f.CheckURL(rawURL); err != nil {
+		return err
+	}
+
+	// Only the first bytes and those following a leading tag are fetched
+	if _, err := sniffAudioFormat(&remoteReaderAt{ctx: ctx, fetcher: f, url: rawURL}); err != nil {
+		if errors.Is(err, domain.ErrUnsupportedAudioFormat) {
+			return fmt.Errorf("URL does not point to a supported audio file: %w", err)
+		}
+		return fmt.Errorf("failed to validate URL: %w", err)
+	}
+	return nil
+}
+
+func (f *remoteFetcher) Do(req *http.Request) (*http.Response, error) {
+	return f.client.Do(req)
+}
+
+func (f *remoteFetcher) MaxSize() int64 {
+	return f.policy.MaxSize
+}
+
+// checkURL checks the scheme and host of a URL
+func (f *remoteFetcher) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme must be http or https", domain.ErrURLNotAllowed)
+	}
+	if u.User != nil {
+		return fmt.Errorf("%w: credentials in URLs are not supported", domain.ErrURLNotAllowed)
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return fmt.Errorf("%w: missing host", domain.ErrURLNotAllowed)
+	}
+	if matchHost(f.policy.DeniedHosts, host) {
+		return fmt.Errorf("%w: host %s is denied", domain.ErrURLNotAllowed, host)
+	}
+	if len(f.policy.AllowedHosts) > 0 && !matchHost(f.policy.AllowedHosts, host) {
+		return fmt.Errorf("%w: host %s is not allowed", domain.ErrURLNotAllowed, host)
+	}
+	return nil
+}
+
+// checkAddress checks the IP address a connection is about to be made to
+func (f *remoteFetcher) checkAddress(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %v", domain.ErrURLNotAllowed, err)
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("%w: %v", domain.ErrURLNotAllowed, err)
+	}
+	ip = ip.Unmap().WithZone("")
+
+	if containsAddr(f.policy.DeniedNetworks, ip) ||
+		(containsAddr(blockedNetworks, ip) && !containsAddr(f.policy.AllowedNetworks, ip)) {
+		return fmt.Errorf("%w: address %s is not allowed", domain.ErrURLNotAllowed, ip)
+	}
+	return nil
+}
+
+// policyTransport checks every request, including those following
+// redirects, before sending it
+type policyTransport struct {
+	fetcher *remoteFetcher
+	base    http.RoundTripper
+}
+
+func (t *policyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.fetcher.checkURL(req.URL); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+// remoteReaderAt reads ranges of a remote file with Range requests
+type remoteReaderAt struct {
+	ctx     context.Context
+	fetcher *remoteFetcher
+	url     string
+}
+
+func (r *remoteReaderAt) ReadAt(p []byte, offset int64) (int, error) {
+	if offset+int64(len(p)) > r.fetcher.policy.MaxSize {
+		return 0, domain.ErrRemoteFileTooLarge
+	}
+
+	req, err := http.NewRequestWithContext(r.ctx, "GET", r.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+int64(len(p))-1))
+
+	resp, err := r.fetcher.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// The server ignores ranges and sends the whole file
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			return 0, io.EOF
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		return 0, io.EOF
+	default:
+		return 0, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	n, err := io.ReadFull(resp.Body, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// matchHost reports whether a host matches one of the patterns
+func matchHost(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(strings.ToLower(pattern), ".")
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAddr(prefixes []netip.Prefix, ip netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func mustParsePrefixes(cidrs ...string) []netip.Prefix {
+	prefixes := make([]netip.Prefix, len(cidrs))
+	for i, cidr := range cidrs {
+		prefixes[i] = netip.MustParsePrefix(cidr)
+	}
+	return prefixes
+}
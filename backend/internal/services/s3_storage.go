@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config holds the connection settings of an S3 compatible object store
+// such as AWS S3 or MinIO
+type S3Config struct {
+	Endpoint  string // Host and optional port, e.g. "localhost:9000"
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	Region    string
+	UseSSL    bool
+}
+
+type s3Storage struct {
+	client *minio.Client
+	core   *minio.Core
+	bucket string
+	ctx    context.Context
+}
+
+// NewS3Storage creates a Storage backed by an S3 compatible bucket. The
+// bucket is created if it does not exist yet
+func NewS3Storage(config S3Config) (domain.Storage, error) {
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.AccessKey, config.SecretKey, ""),
+		Secure: config.UseSSL,
+		Region: config.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	ctx := context.Background()
+	exists, err := client.BucketExists(ctx, config.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check bucket %s: %w", config.Bucket, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, config.Bucket, minio.MakeBucketOptions{Region: config.Region}); err != nil {
+			return nil, fmt.Errorf("failed to create bucket %s: %w", config.Bucket, err)
+		}
+	}
+
+	return &s3Storage{
+		client: client,
+		core:   &minio.Core{Client: client},
+		bucket: config.Bucket,
+		ctx:    ctx,
+	}, nil
+}
+
+func (s *s3Storage) Put(key string, r io.Reader, size int64, contentType string) error {
+	if contentType == "" {
+		contentType = contentTypeByKey(key)
+	}
+
+	_, err := s.client.PutObject(s.ctx, s.bucket, key, r, size, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *s3Storage) Get(key string) (io.ReadCloser, *domain.ObjectInfo, error) {
+	// The core client makes the request right away so missing objects are
+	// reported here rather than on the first read
+	object, stat, _, err := s.core.GetObject(s.ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, s3StorageError(err)
+	}
+	return object, s3ObjectInfo(key, stat), nil
+}
+
+func (s *s3Storage) Range(key string, offset, length int64) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(offset, offset+length-1); err != nil {
+		return nil, err
+	}
+
+	object, _, _, err := s.core.GetObject(s.ctx, s.bucket, key, opts)
+	if err != nil {
+		return nil, s3StorageError(err)
+	}
+	return object, nil
+}
+
+func (s *s3Storage) Delete(key string) error {
+	if err := s.client.RemoveObject(s.ctx, s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		if err := s3StorageError(err); err != domain.ErrObjectNotFound {
+			return fmt.Errorf("failed to delete %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func (s *s3Storage) Stat(key string) (*domain.ObjectInfo, error) {
+	stat, err := s.client.StatObject(s.ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, s3StorageError(err)
+	}
+	return s3ObjectInfo(key, stat), nil
+}
+
+func (s *s3Storage) SignedURL(key string, expiry time.Duration) (string, error) {
+	u, err := s.client.PresignedGetObject(s.ctx, s.bucket, key, expiry, nil)
+	if err != nil {
+		return "", s3StorageError(err)
+	}
+	return u.String(), nil
+}
+
+func s3StorageError(err error) error {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NotFound":
+		return domain.ErrObjectNotFound
+	}
+	return err
+}
+
+func s3ObjectInfo(key string, stat minio.ObjectInfo) *domain.ObjectInfo {
+	return &domain.ObjectInfo{
+		Key:         key,
+		Size:        stat.Size,
+		ModTime:     stat.LastModified,
+		ContentType: stat.ContentType,
+		ETag:        `"` + stat.ETag + `"`,
+	}
+}
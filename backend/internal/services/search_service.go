@@ -0,0 +1,189 @@
+package services
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+)
+
+const (
+	DefaultSearchLimit = 10
+	MaxSearchLimit     = 50
+)
+
+type searchService struct {
+	repo domain.SearchRepository
+}
+
+// NewSearchService creates a new instance of SearchService
+func NewSearchService(repo domain.SearchRepository) domain.SearchService {
+	return &searchService{repo: repo}
+}
+
+func (s *searchService) Search(query domain.SearchQuery) (*domain.SearchResults, error) {
+	results := &domain.SearchResults{
+		Tracks:    []*domain.TrackResult{},
+		Artists:   []*domain.ArtistResult{},
+		Albums:    []*domain.AlbumResult{},
+		Playlists: []*domain.PlaylistResult{},
+	}
+
+	text := strings.TrimSpace(query.Text)
+	tsQuery := prefixTSQuery(text)
+	if tsQuery == "" {
+		return results, nil
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+
+	types := query.Types
+	if len(types) == 0 {
+		types = domain.SearchTypes
+	}
+
+	for _, searchType := range types {
+		var err error
+		switch searchType {
+		case domain.SearchTypeTracks:
+			results.Tracks, err = s.searchTracks(tsQuery, text, limit)
+		case domain.SearchTypeArtists:
+			results.Artists, err = s.searchArtists(tsQuery, text, limit)
+		case domain.SearchTypeAlbums:
+			results.Albums, err = s.searchAlbums(tsQuery, text, limit)
+		case domain.SearchTypePlaylists:
+			results.Playlists, err = s.searchPlaylists(tsQuery, text, query.Username, limit)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
+
+func (s *searchService) searchTracks(tsQuery, text string, limit int) ([]*domain.TrackResult, error) {
+	hits, err := s.repo.SearchTracks(tsQuery, text, limit)
+	if err != nil || len(hits) == 0 {
+		return []*domain.TrackResult{}, err
+	}
+
+	tracks, err := s.repo.FindTracks(hitIDs(hits))
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]*domain.Music, len(tracks))
+	for _, track := range tracks {
+		byID[track.ID] = track
+	}
+
+	results := make([]*domain.TrackResult, 0, len(hits))
+	for _, hit := range hits {
+		if track, ok := byID[hit.ID]; ok {
+			results = append(results, &domain.TrackResult{Music: track, Score: hit.Score})
+		}
+	}
+	return results, nil
+}
+
+func (s *searchService) searchArtists(tsQuery, text string, limit int) ([]*domain.ArtistResult, error) {
+	hits, err := s.repo.SearchArtists(tsQuery, text, limit)
+	if err != nil || len(hits) == 0 {
+		return []*domain.ArtistResult{}, err
+	}
+
+	artists, err := s.repo.FindArtists(hitIDs(hits))
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]*domain.Artist, len(artists))
+	for _, artist := range artists {
+		byID[artist.ID] = artist
+	}
+
+	results := make([]*domain.ArtistResult, 0, len(hits))
+	for _, hit := range hits {
+		if artist, ok := byID[hit.ID]; ok {
+			results = append(results, &domain.ArtistResult{Artist: artist, Score: hit.Score})
+		}
+	}
+	return results, nil
+}
+
+func (s *searchService) searchAlbums(tsQuery, text string, limit int) ([]*domain.AlbumResult, error) {
+	hits, err := s.repo.SearchAlbums(tsQuery, text, limit)
+	if err != nil || len(hits) == 0 {
+		return []*domain.AlbumResult{}, err
+	}
+
+	albums, err := s.repo.FindAlbums(hitIDs(hits))
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]*domain.Album, len(albums))
+	for _, album := range albums {
+		byID[album.ID] = album
+	}
+
+	results := make([]*domain.AlbumResult, 0, len(hits))
+	for _, hit := range hits {
+		if album, ok := byID[hit.ID]; ok {
+			results = append(results, &domain.AlbumResult{Album: album, Score: hit.Score})
+		}
+	}
+	return results, nil
+}
+
+func (s *searchService) searchPlaylists(tsQuery, text, username string, limit int) ([]*domain.PlaylistResult, error) {
+	hits, err := s.repo.SearchPlaylists(tsQuery, text, username, limit)
+	if err != nil || len(hits) == 0 {
+		return []*domain.PlaylistResult{}, err
+	}
+
+	playlists, err := s.repo.FindPlaylists(hitIDs(hits))
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]*domain.Playlist, len(playlists))
+	for _, playlist := range playlists {
+		playlist.IsOwner = playlist.CreatedBy == username
+		byID[playlist.ID] = playlist
+	}
+
+	results := make([]*domain.PlaylistResult, 0, len(hits))
+	for _, hit := range hits {
+		if playlist, ok := byID[hit.ID]; ok {
+			results = append(results, &domain.PlaylistResult{Playlist: playlist, Score: hit.Score})
+		}
+	}
+	return results, nil
+}
+
+// prefixTSQuery turns free text into a tsquery matching every word as a
+// prefix, so "abb ro" finds "Abbey Road" while typing. Characters with a
+// meaning in tsquery syntax are dropped
+func prefixTSQuery(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		terms = append(terms, word+":*")
+	}
+	return strings.Join(terms, " & ")
+}
+
+func hitIDs(hits []domain.SearchHit) []uint {
+	ids := make([]uint, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+	}
+	return ids
+}
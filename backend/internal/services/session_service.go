@@ -0,0 +1,204 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"github.com/aliBordbar1992/musicstream-backend/internal/utils"
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+type sessionService struct {
+	sessionRepo     domain.SessionRepository
+	userRepo        domain.UserRepository
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+}
+
+// NewSessionService creates a new instance of SessionService
+func NewSessionService(sessionRepo domain.SessionRepository, userRepo domain.UserRepository, accessTokenTTL, refreshTokenTTL time.Duration) domain.SessionService {
+	return &sessionService{
+		sessionRepo:     sessionRepo,
+		userRepo:        userRepo,
+		accessTokenTTL:  accessTokenTTL,
+		refreshTokenTTL: refreshTokenTTL,
+	}
+}
+
+func (s *sessionService) CreateSession(username, userAgent, ipAddress string) (*domain.AuthTokens, error) {
+	now := time.Now()
+	session := &domain.Session{
+		ID:         uuid.New().String(),
+		Username:   username,
+		UserAgent:  userAgent,
+		IPAddress:  ipAddress,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(s.refreshTokenTTL),
+	}
+
+	if err := s.sessionRepo.Create(session); err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(session)
+}
+
+// RefreshSession rotates a refresh token. Every refresh token can only be used
+// once; presenting an already used token means it has leaked, so the whole
+// session (the token family) is revoked
+func (s *sessionService) RefreshSession(refreshToken, userAgent, ipAddress string) (*domain.AuthTokens, error) {
+	token, err := s.sessionRepo.FindRefreshTokenByHash(hashRefreshToken(refreshToken))
+	if err != nil {
+		return nil, domain.ErrInvalidRefreshToken
+	}
+
+	session, err := s.sessionRepo.FindByID(token.SessionID)
+	if err != nil {
+		return nil, domain.ErrInvalidRefreshToken
+	}
+	if !isSessionActive(session) {
+		return nil, domain.ErrSessionRevoked
+	}
+
+	if token.UsedAt != nil {
+		return nil, s.revokeReusedFamily(session)
+	}
+
+	if time.Now().After(token.ExpiresAt) {
+		return nil, domain.ErrInvalidRefreshToken
+	}
+
+	// Guard against two concurrent refreshes with the same token
+	consumed, err := s.sessionRepo.MarkRefreshTokenUsed(token.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		return nil, s.revokeReusedFamily(session)
+	}
+
+	now := time.Now()
+	session.UserAgent = userAgent
+	session.IPAddress = ipAddress
+	session.LastUsedAt = now
+	session.ExpiresAt = now.Add(s.refreshTokenTTL)
+	if err := s.sessionRepo.Update(session); err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(session)
+}
+
+func (s *sessionService) ValidateSession(sessionID string) error {
+	if sessionID == "" {
+		return domain.ErrSessionNotFound
+	}
+
+	session, err := s.sessionRepo.FindByID(sessionID)
+	if err != nil {
+		return domain.ErrSessionNotFound
+	}
+
+	if !isSessionActive(session) {
+		return domain.ErrSessionRevoked
+	}
+	return nil
+}
+
+func (s *sessionService) ListSessions(username, currentSessionID string) ([]*domain.Session, error) {
+	sessions, err := s.sessionRepo.FindActiveByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, session := range sessions {
+		session.Current = session.ID == currentSessionID
+	}
+	return sessions, nil
+}
+
+func (s *sessionService) RevokeSession(sessionID, username string) error {
+	session, err := s.sessionRepo.FindByID(sessionID)
+	if err != nil || session.Username != username {
+		return domain.ErrSessionNotFound
+	}
+
+	return s.sessionRepo.Revoke(sessionID)
+}
+
+func (s *sessionService) RevokeAllSessions(username string) error {
+	return s.sessionRepo.RevokeAllByUsername(username)
+}
+
+// issueTokens creates a new access token and refresh token for a session.
+// The user is reloaded so role changes apply on the next refresh
+func (s *sessionService) issueTokens(session *domain.Session) (*domain.AuthTokens, error) {
+	user, err := s.userRepo.FindByUsername(session.Username)
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		return nil, domain.ErrUserDisabled
+	}
+
+	refreshToken, err := generateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.sessionRepo.CreateRefreshToken(&domain.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: hashRefreshToken(refreshToken),
+		ExpiresAt: session.ExpiresAt,
+	}); err != nil {
+		return nil, err
+	}
+
+	accessToken, err := utils.GenerateAccessToken(session.Username, session.ID, string(user.Role), s.accessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.AuthTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.accessTokenTTL.Seconds()),
+	}, nil
+}
+
+func (s *sessionService) revokeReusedFamily(session *domain.Session) error {
+	log.Printf("Refresh token reuse detected for session %s of user %s, revoking session", session.ID, session.Username)
+	if err := s.sessionRepo.Revoke(session.ID); err != nil {
+		return errors.New("failed to revoke session: " + err.Error())
+	}
+	return domain.ErrRefreshTokenReused
+}
+
+func isSessionActive(session *domain.Session) bool {
+	return session.RevokedAt == nil && time.Now().Before(session.ExpiresAt)
+}
+
+func generateRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"errors"
+	"io"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+)
+
+type storageReader struct {
+	storage domain.Storage
+	key     string
+	size    int64
+	offset  int64
+	body    io.ReadCloser // Open range request starting at offset, if any
+}
+
+// NewStorageReader returns a seekable reader over a stored object, so objects
+// can be served with http.ServeContent. Reading opens a single range request
+// from the current offset which is reused until the next seek
+func NewStorageReader(storage domain.Storage, info *domain.ObjectInfo) io.ReadSeekCloser {
+	return &storageReader{
+		storage: storage,
+		key:     info.Key,
+		size:    info.Size,
+	}
+}
+
+func (r *storageReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.body == nil {
+		body, err := r.storage.Range(r.key, r.offset, r.size-r.offset)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	if err == io.EOF && r.offset < r.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (r *storageReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek before start of object")
+	}
+
+	if offset != r.offset {
+		r.closeBody()
+		r.offset = offset
+	}
+	return offset, nil
+}
+
+func (r *storageReader) Close() error {
+	return r.closeBody()
+}
+
+func (r *storageReader) closeBody() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+)
+
+// DefaultStreamURLTTL is long enough to play a long track with pauses
+const DefaultStreamURLTTL = 2 * time.Hour
+
+type streamSigner struct {
+	secret []byte
+	ttl    time.Duration
+	bindIP bool
+}
+
+// NewStreamSigner creates a new instance of StreamSigner signing URLs with
+// HMAC-SHA256
+func NewStreamSigner(secret string, ttl time.Duration, bindIP bool) domain.StreamSigner {
+	return &streamSigner{
+		secret: []byte(secret),
+		ttl:    ttl,
+		bindIP: bindIP,
+	}
+}
+
+func (s *streamSigner) Sign(musicID uint, username, ip string) *domain.StreamURL {
+	return s.SignFor(musicID, username, ip, s.ttl)
+}
+
+func (s *streamSigner) SignFor(musicID uint, username, ip string, ttl time.Duration) *domain.StreamURL {
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+
+	// The bound IP is part of the signature but not of the URL
+	query := url.Values{}
+	query.Set("user", username)
+	query.Set("expires", strconv.FormatInt(expiresAt.Unix(), 10))
+	if s.bindIP {
+		query.Set("ip", "1")
+	} else {
+		ip = ""
+	}
+	query.Set("sig", s.signature(musicID, username, expiresAt.Unix(), ip))
+
+	return &domain.StreamURL{
+		URL:       fmt.Sprintf("/music/%d/stream?%s", musicID, query.Encode()),
+		ExpiresAt: expiresAt,
+	}
+}
+
+func (s *streamSigner) Verify(musicID uint, query url.Values, ip string) (string, error) {
+	username := query.Get("user")
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if username == "" || err != nil {
+		return "", domain.ErrInvalidStreamURL
+	}
+	if query.Get("ip") == "" {
+		ip = ""
+	}
+
+	expected := s.signature(musicID, username, expires, ip)
+	if !hmac.Equal([]byte(query.Get("sig")), []byte(expected)) {
+		return "", domain.ErrInvalidStreamURL
+	}
+	if time.Now().Unix() > expires {
+		return "", domain.ErrInvalidStreamURL
+	}
+	return username, nil
+}
+
+func (s *streamSigner) signature(musicID uint, username string, expires int64, ip string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%d\n%s\n%d\n%s", musicID, username, expires, ip)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,321 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultTusUploadExpiry is how long an unfinished upload is kept after
+	// its last write
+	DefaultTusUploadExpiry = 24 * time.Hour
+	// DefaultTusMaxSize is the largest resumable upload accepted
+	DefaultTusMaxSize int64 = 2 << 30
+
+	tusCleanupInterval = 10 * time.Minute
+)
+
+type tusService struct {
+	dir           string // Holds <id> with the received bytes and <id>.info
+	stagingDir    string
+	expiry        time.Duration
+	maxSize       int64
+	uploadService UploadService
+	fileService   FileService
+	quotaService  domain.QuotaService
+
+	mu     sync.Mutex
+	locked map[string]bool // Uploads being written
+}
+
+// NewTusService creates a new instance of TusService. Partial uploads are
+// kept on disk in dir; complete ones are moved to the staging directory of
+// the upload service and queued for ingest like regular uploads
+func NewTusService(dir, stagingDir string, expiry time.Duration, maxSize int64, uploadService UploadService, fileService FileService, quotaService domain.QuotaService) domain.TusService {
+	return &tusService{
+		dir:           dir,
+		stagingDir:    stagingDir,
+		expiry:        expiry,
+		maxSize:       maxSize,
+		uploadService: uploadService,
+		fileService:   fileService,
+		quotaService:  quotaService,
+		locked:        make(map[string]bool),
+	}
+}
+
+func (s *tusService) Create(owner string, length int64, metadata map[string]string) (*domain.TusUpload, error) {
+	if length < 0 {
+		return nil, domain.ErrTusInvalidUploadSize
+	}
+	if length > s.maxSize {
+		return nil, domain.ErrTusUploadTooLarge
+	}
+
+	// Reject files that could never be ingested before any byte is sent
+	filename := filepath.Base(metadata["filename"])
+	if filename == "." || filename == string(filepath.Separator) {
+		return nil, domain.ErrTusMissingFilename
+	}
+	if err := s.fileService.ValidateAudioFile(filepath.Ext(filename)); err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrUnsupportedAudioFormat, err)
+	}
+	if err := s.quotaService.CheckUpload(owner, length, 0); err != nil {
+		return nil, err
+	}
+
+	if err := s.fileService.EnsureDirectoryExists(s.dir); err != nil {
+		return nil, err
+	}
+
+	upload := &domain.TusUpload{
+		ID:        strings.ReplaceAll(uuid.New().String(), "-", ""),
+		Owner:     owner,
+		Length:    length,
+		Metadata:  metadata,
+		ExpiresAt: time.Now().Add(s.expiry),
+	}
+	if err := s.fileService.SaveFile(s.dataPath(upload.ID), nil); err != nil {
+		return nil, fmt.Errorf("failed to create upload: %w", err)
+	}
+	if err := s.saveInfo(upload); err != nil {
+		os.Remove(s.dataPath(upload.ID))
+		return nil, err
+	}
+
+	// Empty files are complete right away
+	if length == 0 {
+		if err := s.complete(upload); err != nil {
+			return nil, err
+		}
+	}
+	return upload, nil
+}
+
+func (s *tusService) GetUpload(id, owner string) (*domain.TusUpload, error) {
+	upload, err := s.loadInfo(id)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Owner != owner {
+		return nil, domain.ErrTusUploadNotFound
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		s.remove(id)
+		return nil, domain.ErrTusUploadExpired
+	}
+	return upload, nil
+}
+
+func (s *tusService) Write(id, owner string, offset int64, r io.Reader) (*domain.TusUpload, error) {
+	if !s.lock(id) {
+		return nil, domain.ErrTusUploadLocked
+	}
+	defer s.unlock(id)
+
+	upload, err := s.GetUpload(id, owner)
+	if err != nil {
+		return nil, err
+	}
+	if offset != upload.Offset {
+		return nil, domain.ErrTusOffsetMismatch
+	}
+
+	if !upload.IsComplete() {
+		file, err := os.OpenFile(s.dataPath(id), os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open upload: %w", err)
+		}
+		// Bytes beyond the declared length are never written
+		written, copyErr := io.Copy(file, io.LimitReader(r, upload.Length-upload.Offset))
+		if err := file.Close(); err != nil && copyErr == nil {
+			copyErr = err
+		}
+
+		upload.Offset += written
+		upload.ExpiresAt = time.Now().Add(s.expiry)
+		if err := s.saveInfo(upload); err != nil {
+			return nil, err
+		}
+		if copyErr != nil {
+			return upload, fmt.Errorf("failed to write upload: %w", copyErr)
+		}
+	}
+
+	// A complete upload whose ingest could not be queued is retried by
+	// writing zero bytes at its end
+	if upload.IsComplete() && upload.JobID == nil {
+		if err := s.complete(upload); err != nil {
+			return upload, err
+		}
+	}
+	return upload, nil
+}
+
+func (s *tusService) Terminate(id, owner string) error {
+	if !s.lock(id) {
+		return domain.ErrTusUploadLocked
+	}
+	defer s.unlock(id)
+
+	if _, err := s.GetUpload(id, owner); err != nil {
+		return err
+	}
+	s.remove(id)
+	return nil
+}
+
+func (s *tusService) MaxSize() int64 {
+	return s.maxSize
+}
+
+func (s *tusService) Start() {
+	go func() {
+		ticker := time.NewTicker(tusCleanupInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if count := s.removeExpired(); count > 0 {
+				log.Printf("Removed %d expired uploads", count)
+			}
+		}
+	}()
+}
+
+// complete moves the bytes of a finished upload to the staging directory and
+// queues its ingest. The upload record is kept until it expires so clients
+// can still learn its offset and job
+func (s *tusService) complete(upload *domain.TusUpload) error {
+	if err := s.fileService.EnsureDirectoryExists(s.stagingDir); err != nil {
+		return err
+	}
+
+	filename := filepath.Base(upload.Metadata["filename"])
+	stagedPath := filepath.Join(s.stagingDir, fmt.Sprintf("%d_%s", time.Now().UnixNano(), filename))
+	if err := os.Rename(s.dataPath(upload.ID), stagedPath); err != nil {
+		return fmt.Errorf("failed to stage upload: %w", err)
+	}
+
+	job, err := s.uploadService.QueueStagedFile(upload.Owner, stagedPath, filename, upload.Metadata["title"], upload.Metadata["artist"], upload.Metadata["album"])
+	if err != nil {
+		// Keep the bytes so the client can try again
+		os.Rename(stagedPath, s.dataPath(upload.ID))
+		return err
+	}
+
+	upload.JobID = &job.ID
+	return s.saveInfo(upload)
+}
+
+// removeExpired deletes the uploads past their expiry, returning how many
+func (s *tusService) removeExpired() int {
+	infos, err := filepath.Glob(filepath.Join(s.dir, "*.info"))
+	if err != nil {
+		return 0
+	}
+
+	count := 0
+	for _, info := range infos {
+		id := strings.TrimSuffix(filepath.Base(info), ".info")
+		if !s.lock(id) {
+			continue
+		}
+		if upload, err := s.loadInfo(id); err == nil && time.Now().After(upload.ExpiresAt) {
+			s.remove(id)
+			count++
+		}
+		s.unlock(id)
+	}
+	return count
+}
+
+func (s *tusService) loadInfo(id string) (*domain.TusUpload, error) {
+	// IDs come from clients, never let them escape the upload directory
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return nil, domain.ErrTusUploadNotFound
+	}
+
+	data, err := os.ReadFile(s.infoPath(id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, domain.ErrTusUploadNotFound
+		}
+		return nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+
+	var upload domain.TusUpload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+
+	// The bytes on disk are the truth should the process have stopped between
+	// writing them and saving the record
+	if upload.JobID == nil {
+		if stat, err := os.Stat(s.dataPath(id)); err == nil {
+			upload.Offset = min(stat.Size(), upload.Length)
+		}
+	}
+	return &upload, nil
+}
+
+// saveInfo writes the record of an upload, replacing the previous one at once
+// so a crash never leaves it half written
+func (s *tusService) saveInfo(upload *domain.TusUpload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return fmt.Errorf("failed to save upload: %w", err)
+	}
+
+	tmpPath := s.infoPath(upload.ID) + ".tmp"
+	if err := s.fileService.SaveFile(tmpPath, data); err != nil {
+		return fmt.Errorf("failed to save upload: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.infoPath(upload.ID)); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to save upload: %w", err)
+	}
+	return nil
+}
+
+func (s *tusService) remove(id string) {
+	s.fileService.DeleteFile(s.dataPath(id))
+	s.fileService.DeleteFile(s.infoPath(id))
+}
+
+func (s *tusService) dataPath(id string) string {
+	return filepath.Join(s.dir, id)
+}
+
+func (s *tusService) infoPath(id string) string {
+	return filepath.Join(s.dir, id+".info")
+}
+
+// lock reserves an upload for one request, reporting false when another
+// request holds it
+func (s *tusService) lock(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.locked[id] {
+		return false
+	}
+	s.locked[id] = true
+	return true
+}
+
+func (s *tusService) unlock(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.locked, id)
+}
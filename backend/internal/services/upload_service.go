@@ -1,50 +1,97 @@
 package services
 
 import (
+	"bytes"
+	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
-	"net/http"
+	"log"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
-	"github.com/aliBordbar1992/musicstream-backend/internal/repositories"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"gorm.io/gorm"
 )
 
 type UploadService interface {
-	HandleMusicUpload(ctx *gin.Context, fileService FileService, musicService domain.MusicService) (*domain.Music, error)
-	HandleMusicDownload(ctx *gin.Context, fileService FileService, musicService domain.MusicService) (*domain.Music, error)
+	// HandleMusicUpload stages an uploaded file and queues a job ingesting it
+	HandleMusicUpload(ctx *gin.Context, fileService FileService) (*domain.Job, error)
+	// QueueStagedFile queues a job ingesting a file already staged in the
+	// staging directory. The job owns the file once queued
+	QueueStagedFile(username, filePath, originalName, title, artist, album string) (*domain.Job, error)
+	// HandleMusicDownload queues a job downloading and ingesting a URL
+	HandleMusicDownload(ctx *gin.Context) (*domain.Job, error)
+	// HandleImport stages an uploaded ZIP archive and queues a job ingesting
+	// its tracks and recreating its playlists
+	HandleImport(ctx *gin.Context, fileService FileService) (*domain.Job, error)
+	// RegisterJobHandlers registers the handlers of the jobs queued by uploads
+	RegisterJobHandlers(fileService FileService, musicService domain.MusicService, playlistService domain.PlaylistService)
 	HandleProfilePictureUpload(base64file string, fileService FileService) (string, error)
 }
 
 type uploadService struct {
-	uploadDir string
-	db        *gorm.DB
+	stagingDir        string
+	storage           domain.Storage
+	metadataExtractor MetadataExtractor
+	artistService     domain.ArtistService
+	artworkService    domain.ArtworkService
+	albumService      domain.AlbumService
+	blobService       domain.AudioBlobService
+	waveformService   domain.WaveformService
+	jobService        domain.JobService
+	fetcher           domain.RemoteFetcher
+	quotaService      domain.QuotaService
 }
 
-func NewUploadService(uploadDir string, db *gorm.DB) UploadService {
+const (
+	// DefaultMaxUploadSize caps the request body of a single file upload
+	DefaultMaxUploadSize int64 = 1 << 30
+	// unknownArtist is used when neither the user nor the file's tags name an artist
+	unknownArtist = "Unknown Artist"
+	// profilePicturePrefix is the storage prefix of profile pictures. They are
+	// served publicly under /uploads/<key>
+	profilePicturePrefix = "profile_pictures"
+)
+
+// musicInput holds the track details given by the user. Blank fields are
+// filled from the tags embedded in the file
+type musicInput struct {
+	Title        string
+	Artist       string
+	Album        string
+	Username     string
+	OriginalName string // Original file name, used as a last resort title
+}
+
+// NewUploadService creates a new instance of UploadService. Uploads are
+// processed in stagingDir before they are moved to storage
+func NewUploadService(stagingDir string, storage domain.Storage, metadataExtractor MetadataExtractor, artistService domain.ArtistService, artworkService domain.ArtworkService, albumService domain.AlbumService, blobService domain.AudioBlobService, waveformService domain.WaveformService, jobService domain.JobService, fetcher domain.RemoteFetcher, quotaService domain.QuotaService) UploadService {
 	return &uploadService{
-		uploadDir: uploadDir,
-		db:        db,
+		stagingDir:        stagingDir,
+		storage:           storage,
+		metadataExtractor: metadataExtractor,
+		artistService:     artistService,
+		artworkService:    artworkService,
+		albumService:      albumService,
+		blobService:       blobService,
+		waveformService:   waveformService,
+		jobService:        jobService,
+		fetcher:           fetcher,
+		quotaService:      quotaService,
 	}
 }
 
-func (s *uploadService) HandleMusicUpload(ctx *gin.Context, fileService FileService, musicService domain.MusicService) (*domain.Music, error) {
-	// Get form data
-	title := ctx.PostForm("title")
-	artistName := ctx.PostForm("artist")
-	album := ctx.PostForm("album")
-	username := ctx.GetString("username")
-
+func (s *uploadService) HandleMusicUpload(ctx *gin.Context, fileService FileService) (*domain.Job, error) {
 	// Get the uploaded file
 	file, err := ctx.FormFile("music")
 	if err != nil {
-		return nil, fmt.Errorf("failed to get uploaded file: %v", err)
+		return nil, fmt.Errorf("failed to get uploaded file: %w", err)
 	}
 
 	// Validate file type
@@ -53,51 +100,53 @@ func (s *uploadService) HandleMusicUpload(ctx *gin.Context, fileService FileServ
 		return nil, err
 	}
 
-	// Create upload directory if it doesn't exist
-	if err := fileService.EnsureDirectoryExists(getMusicUploadDir(s)); err != nil {
+	// Nothing is saved once the user is out of quota
+	if err := s.quotaService.CheckUpload(ctx.GetString("username"), file.Size, 0); err != nil {
+		return nil, err
+	}
+
+	// Create staging directory if it doesn't exist
+	if err := fileService.EnsureDirectoryExists(s.stagingDir); err != nil {
 		return nil, err
 	}
 
 	// Generate unique filename
 	filename := fmt.Sprintf("%d_%s", time.Now().UnixNano(), file.Filename)
-	filePath := filepath.Join(getMusicUploadDir(s), filename)
+	filePath := filepath.Join(s.stagingDir, filename)
 
 	// Save the file using Gin's built-in method
 	if err := ctx.SaveUploadedFile(file, filePath); err != nil {
 		return nil, fmt.Errorf("failed to save file: %v", err)
 	}
 
-	// Get file duration
-	duration, err := fileService.CalculateAudioDuration(filePath)
-	if err != nil {
-		os.Remove(filePath) // Clean up the file
-		return nil, fmt.Errorf("failed to get file duration: %v", err)
-	}
-
-	// Create or get artist
-	artistService := NewArtistService(repositories.NewArtistRepository(s.db))
-	artist, err := artistService.GetOrCreateArtist(artistName)
+	job, err := s.QueueStagedFile(ctx.GetString("username"), filePath, file.Filename, ctx.PostForm("title"), ctx.PostForm("artist"), ctx.PostForm("album"))
 	if err != nil {
-		os.Remove(filePath) // Clean up the file
-		return nil, fmt.Errorf("failed to process artist: %v", err)
+		os.Remove(filePath)
+		return nil, err
 	}
+	return job, nil
+}
 
-	// Create music record
-	music, err := musicService.UploadMusic(title, artist.ID, album, filePath, username, duration)
+func (s *uploadService) QueueStagedFile(username, filePath, originalName, title, artist, album string) (*domain.Job, error) {
+	job, err := s.jobService.Enqueue(ingestJobType, username, ingestPayload{
+		StagedFile:   filePath,
+		Title:        title,
+		Artist:       artist,
+		Album:        album,
+		OriginalName: originalName,
+	})
 	if err != nil {
-		os.Remove(filePath) // Clean up the file
-		return nil, fmt.Errorf("failed to save music record: %v", err)
+		return nil, fmt.Errorf("failed to queue upload: %w", err)
 	}
-
-	return music, nil
+	return job, nil
 }
 
 // HandleMusicDownload handles downloading music from a URL
-func (s *uploadService) HandleMusicDownload(ctx *gin.Context, fileService FileService, musicService domain.MusicService) (*domain.Music, error) {
+func (s *uploadService) HandleMusicDownload(ctx *gin.Context) (*domain.Job, error) {
 	var req struct {
 		URL    string `json:"url" binding:"required"`
-		Title  string `json:"title" binding:"required"`
-		Artist string `json:"artist" binding:"required"`
+		Title  string `json:"title"`
+		Artist string `json:"artist"`
 		Album  string `json:"album"`
 	}
 
@@ -105,50 +154,219 @@ func (s *uploadService) HandleMusicDownload(ctx *gin.Context, fileService FileSe
 		return nil, fmt.Errorf("invalid request: %w", err)
 	}
 
-	linkValidator := domain.NewLinkValidator(&http.Client{})
+	// Links the fetch policy forbids are rejected before they are queued
+	if err := s.fetcher.CheckURL(req.URL); err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
 
-	// Generate unique filename
-	filename := fmt.Sprintf("%d_%s.%s", time.Now().UnixNano(), req.Title, filepath.Ext(req.URL))
-	filePath := filepath.Join(getMusicUploadDir(s), filename)
+	// The size is unknown until downloaded, when the quota is checked again
+	if err := s.quotaService.CheckUpload(ctx.GetString("username"), 0, 0); err != nil {
+		return nil, err
+	}
 
-	// Download the file
-	_, err := fileService.DownloadFile(req.URL, filePath, linkValidator)
+	job, err := s.jobService.Enqueue(ingestJobType, ctx.GetString("username"), ingestPayload{
+		URL:          req.URL,
+		Title:        req.Title,
+		Artist:       req.Artist,
+		Album:        req.Album,
+		OriginalName: remoteFileName(req.URL),
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to download music: %w", err)
+		return nil, fmt.Errorf("failed to queue download: %w", err)
+	}
+	return job, nil
+}
+
+// ingestFile processes a staged audio file and creates its music record.
+// Uploads of audio that is already in the library return the existing track
+// flagged as duplicate. The staged file is left for the caller to remove.
+// Errors caused by the file itself are permanent
+func (s *uploadService) ingestFile(ctx context.Context, filePath string, input musicInput, fileService FileService, musicService domain.MusicService, progress domain.JobProgress) (*domain.Music, error) {
+	progress(ingestStageAnalyzing, 0)
+
+	// Trust the content of the file rather than its name
+	format, err := fileService.DetectAudioFormat(filePath)
+	if err != nil {
+		return nil, &domain.PermanentError{Err: fmt.Errorf("invalid audio file: %w", err)}
 	}
 
 	// Get file duration
 	duration, err := fileService.CalculateAudioDuration(filePath)
 	if err != nil {
-		os.Remove(filePath) // Clean up the file
-		return nil, fmt.Errorf("failed to get file duration: %v", err)
+		return nil, &domain.PermanentError{Err: fmt.Errorf("failed to get file duration: %v", err)}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Checked again here since downloads and other uploads of the user may
+	// have finished since the upload was accepted
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if err := s.quotaService.CheckUpload(input.Username, stat.Size(), duration); err != nil {
+		if errors.Is(err, domain.ErrQuotaExceeded) || errors.Is(err, domain.ErrFileTooLarge) || errors.Is(err, domain.ErrTrackTooLong) {
+			return nil, &domain.PermanentError{Err: err}
+		}
+		return nil, err
+	}
+	progress(ingestStageAnalyzing, 0.2)
+
+	// Tracks without loudness data are played unnormalized and picked up by
+	// the backfill, so a failed analysis must not fail the upload
+	var loudness, truePeak, trackGain *float64
+	if analysis, err := fileService.AnalyzeLoudness(filePath); err != nil {
+		log.Printf("Failed to analyze loudness of %s: %v", filePath, err)
+	} else {
+		loudness, truePeak, trackGain = &analysis.Integrated, &analysis.TruePeak, analysis.TrackGain()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	progress(ingestStageStoring, 0.5)
+
+	// Copy the file into content addressed storage, the upload holds a
+	// reference until the track is created so the file cannot go away
+	blob, existed, err := s.blobService.Store(filePath, format, duration)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store file: %w", err)
+	}
+
+	if existing := s.findDuplicate(blob, existed, musicService); existing != nil {
+		s.releaseBlob(blob)
+		existing.Duplicate = true
+		return existing, nil
 	}
 
-	// Create or get artist
-	artistService := NewArtistService(repositories.NewArtistRepository(s.db))
-	artist, err := artistService.GetOrCreateArtist(req.Artist)
+	progress(ingestStageSaving, 0.8)
+
+	// Duplicates of stored content share its waveform. Waveforms that failed
+	// are generated when first requested
+	if !existed {
+		if err := s.waveformService.Generate(filePath, blob.FilePath); err != nil {
+			log.Printf("Failed to generate waveform of %s: %v", filePath, err)
+		}
+	}
+
+	// Tags are only used as defaults, so a broken tag must not fail the upload
+	metadata, err := s.metadataExtractor.ExtractMetadata(filePath)
+	if err != nil {
+		log.Printf("Failed to extract metadata from %s: %v", filePath, err)
+		metadata = &domain.AudioMetadata{}
+	}
+
+	title := firstNonEmpty(input.Title, metadata.Title, strings.TrimSuffix(input.OriginalName, filepath.Ext(input.OriginalName)))
+	artistName := firstNonEmpty(input.Artist, metadata.Artist, metadata.AlbumArtist, unknownArtist)
+	album := strings.TrimSpace(firstNonEmpty(input.Album, metadata.Album))
+
+	// Create or get the credited artists, e.g. "A & B feat. C"
+	credits, err := s.artistService.ResolveCredits(artistName, title)
 	if err != nil {
-		os.Remove(filePath) // Clean up the file
+		s.releaseBlob(blob)
 		return nil, fmt.Errorf("failed to process artist: %w", err)
 	}
+	artist := credits[0].Artist
+
+	// Missing or broken cover art falls back to a generated placeholder
+	var artworkID *uint
+	if metadata.Picture != nil {
+		artwork, err := s.artworkService.SaveArtwork(metadata.Picture)
+		if err != nil {
+			log.Printf("Failed to save artwork of %s: %v", filePath, err)
+		} else {
+			artworkID = &artwork.ID
+		}
+	}
+
+	// Albums belong to the album artist, so compilations are not split up
+	var albumID *uint
+	if album != "" {
+		albumArtist := artist
+		if metadata.AlbumArtist != "" && input.Album == "" {
+			if albumArtist, err = s.artistService.GetOrCreateArtist(metadata.AlbumArtist); err != nil {
+				s.releaseBlob(blob)
+				return nil, fmt.Errorf("failed to process album artist: %w", err)
+			}
+		}
+
+		albumEntity, err := s.albumService.GetOrCreateAlbum(album, albumArtist.ID, metadata.Year, artworkID)
+		if err != nil {
+			s.releaseBlob(blob)
+			return nil, fmt.Errorf("failed to process album: %w", err)
+		}
+		albumID = &albumEntity.ID
+	}
 
 	// Create music record
-	music, err := musicService.UploadMusic(
-		req.Title,
-		artist.ID,
-		req.Album,
-		filePath,
-		ctx.GetString("username"),
-		duration,
-	)
+	music, err := musicService.UploadMusic(&domain.Music{
+		Title:       title,
+		ArtistID:    artist.ID,
+		Credits:     credits,
+		Album:       album,
+		AlbumID:     albumID,
+		FilePath:    blob.FilePath,
+		Container:   format.Container,
+		Codec:       format.Codec,
+		MimeType:    format.MimeType,
+		FileSize:    stat.Size(),
+		UploadedBy:  input.Username,
+		Duration:    duration,
+		Loudness:    loudness,
+		TruePeak:    truePeak,
+		TrackGain:   trackGain,
+		TrackNumber: metadata.TrackNumber,
+		DiscNumber:  metadata.DiscNumber,
+		Year:        metadata.Year,
+		Genre:       metadata.Genre,
+		Composer:    metadata.Composer,
+		ArtworkID:   artworkID,
+		BlobID:      &blob.ID,
+	})
 	if err != nil {
-		os.Remove(filePath) // Clean up the file
+		s.releaseBlob(blob)
 		return nil, fmt.Errorf("failed to save music record: %w", err)
 	}
 
+	if albumID != nil && loudness != nil {
+		if err := musicService.UpdateAlbumGain(*albumID); err != nil {
+			log.Printf("Failed to update gain of album %d: %v", *albumID, err)
+		}
+	}
+
 	return music, nil
 }
 
+// findDuplicate returns the track using the same audio as a blob: either the
+// same file or, when the file is new, a re-encode of the same audio
+func (s *uploadService) findDuplicate(blob *domain.AudioBlob, existed bool, musicService domain.MusicService) *domain.Music {
+	if existed {
+		if music, err := musicService.GetMusicByBlob(blob.ID); err == nil {
+			return music
+		}
+		return nil
+	}
+
+	similar, err := s.blobService.FindSimilar(blob)
+	if err != nil {
+		log.Printf("Failed to find audio similar to blob %d: %v", blob.ID, err)
+		return nil
+	}
+	for _, candidate := range similar {
+		if music, err := musicService.GetMusicByBlob(candidate.ID); err == nil {
+			return music
+		}
+	}
+	return nil
+}
+
+// releaseBlob drops the reference an upload holds on its blob
+func (s *uploadService) releaseBlob(blob *domain.AudioBlob) {
+	if err := s.blobService.Release(blob.ID); err != nil {
+		log.Printf("Failed to release blob %d: %v", blob.ID, err)
+	}
+}
+
 func (s *uploadService) HandleProfilePictureUpload(base64file string, fileService FileService) (string, error) {
 	// decode base64 file
 	// if base64file starts with data:etc, then remove the data:etc,
@@ -168,23 +386,31 @@ func (s *uploadService) HandleProfilePictureUpload(base64file string, fileServic
 
 	filename := fmt.Sprintf("%d_%s", time.Now().UnixNano(), uuid.New().String())
 
-	// Create upload directory if it doesn't exist
-	if err := fileService.EnsureDirectoryExists(getProfilePictureUploadDir(s)); err != nil {
-		return "", fmt.Errorf("failed to create upload directory: %w", err)
-	}
-
-	filePath := filepath.Join(getProfilePictureUploadDir(s), filename+ext)
-	if err := fileService.SaveFile(filePath, decodedFile); err != nil {
+	key := path.Join(profilePicturePrefix, filename+ext)
+	if err := s.storage.Put(key, bytes.NewReader(decodedFile), int64(len(decodedFile)), contentTypeByKey(key)); err != nil {
 		return "", fmt.Errorf("failed to save file: %w", err)
 	}
 
-	return filePath, nil
+	// The picture is referenced by the path it is served under
+	return path.Join("uploads", key), nil
 }
 
-func getMusicUploadDir(s *uploadService) string {
-	return s.uploadDir
+// remoteFileName returns the file name of a URL's path, e.g. "song.mp3"
+func remoteFileName(rawURL string) string {
+	name := "download"
+	if u, err := url.Parse(rawURL); err == nil {
+		if base := path.Base(u.Path); base != "." && base != "/" {
+			name = base
+		}
+	}
+	return name
 }
 
-func getProfilePictureUploadDir(s *uploadService) string {
-	return fmt.Sprintf("%s/profile_pictures", s.uploadDir)
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+	return ""
 }
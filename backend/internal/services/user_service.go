@@ -2,20 +2,27 @@ package services
 
 import (
 	"errors"
+	"log"
 	"time"
 
 	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
-	"github.com/aliBordbar1992/musicstream-backend/internal/utils"
 )
 
 type userService struct {
-	userRepo      domain.UserRepository
-	uploadService UploadService
+	userRepo       domain.UserRepository
+	uploadService  UploadService
+	passwordHasher domain.PasswordHasher
+	sessionService domain.SessionService
 }
 
 // NewUserService creates a new instance of UserService
-func NewUserService(userRepo domain.UserRepository, uploadService UploadService) domain.UserService {
-	return &userService{userRepo: userRepo, uploadService: uploadService}
+func NewUserService(userRepo domain.UserRepository, uploadService UploadService, passwordHasher domain.PasswordHasher, sessionService domain.SessionService) domain.UserService {
+	return &userService{
+		userRepo:       userRepo,
+		uploadService:  uploadService,
+		passwordHasher: passwordHasher,
+		sessionService: sessionService,
+	}
 }
 
 func (s *userService) Register(username, password string) error {
@@ -25,9 +32,15 @@ func (s *userService) Register(username, password string) error {
 		return errors.New("user already exists")
 	}
 
+	hashedPassword, err := s.passwordHasher.Hash(password)
+	if err != nil {
+		return errors.New("failed to hash password")
+	}
+
 	user := &domain.User{
 		Username:  username,
-		Password:  password, // In a real application, this should be hashed
+		Password:  hashedPassword,
+		Role:      domain.DefaultRole,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
@@ -35,23 +48,43 @@ func (s *userService) Register(username, password string) error {
 	return s.userRepo.Create(user)
 }
 
-func (s *userService) Login(username, password string) (string, error) {
+func (s *userService) Login(username, password, userAgent, ipAddress string) (*domain.AuthTokens, error) {
 	user, err := s.userRepo.FindByUsername(username)
 	if err != nil {
-		return "", errors.New("invalid username or password")
+		return nil, errors.New("invalid username or password")
+	}
+
+	match, needsRehash, err := s.passwordHasher.Verify(password, user.Password)
+	if err != nil || !match {
+		return nil, errors.New("invalid username or password")
 	}
 
-	if user.Password != password { // In a real application, compare hashed passwords
-		return "", errors.New("invalid username or password")
+	if user.DisabledAt != nil {
+		return nil, domain.ErrUserDisabled
 	}
 
-	// Generate JWT token
-	token, err := utils.GenerateToken(username)
+	// Upgrade legacy plaintext or outdated hashes now that we know the password
+	if needsRehash {
+		s.rehashPassword(user, password)
+	}
+
+	return s.sessionService.CreateSession(username, userAgent, ipAddress)
+}
+
+// rehashPassword replaces the stored hash of a user. Failures are only logged
+// since the login itself has already succeeded
+func (s *userService) rehashPassword(user *domain.User, password string) {
+	hashedPassword, err := s.passwordHasher.Hash(password)
 	if err != nil {
-		return "", err
+		log.Printf("Failed to rehash password for user %s: %v", user.Username, err)
+		return
 	}
 
-	return token, nil
+	user.Password = hashedPassword
+	user.UpdatedAt = time.Now()
+	if err := s.userRepo.Update(user); err != nil {
+		log.Printf("Failed to store rehashed password for user %s: %v", user.Username, err)
+	}
 }
 
 func (s *userService) GetUser(username string) (*domain.User, error) {
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+)
+
+const (
+	// waveformPrefix is the storage prefix waveforms are stored under
+	waveformPrefix = "waveforms"
+	// waveformSamplesPerPixel is the finest resolution waveforms are stored
+	// at, the default of audiowaveform
+	waveformSamplesPerPixel = 256
+	// waveformMaxBuckets caps the size of stored waveforms of long tracks
+	waveformMaxBuckets = 65536
+)
+
+type waveformService struct {
+	storage domain.Storage
+}
+
+// NewWaveformService creates a new instance of WaveformService
+func NewWaveformService(storage domain.Storage) domain.WaveformService {
+	return &waveformService{storage: storage}
+}
+
+func (s *waveformService) Generate(filePath, audioKey string) error {
+	_, err := s.generate(filePath, audioKey)
+	return err
+}
+
+func (s *waveformService) GetWaveform(music *domain.Music, buckets int) (*domain.Waveform, error) {
+	waveform, err := s.load(music.FilePath)
+	if errors.Is(err, domain.ErrObjectNotFound) {
+		waveform, err = s.generateFromStorage(music.FilePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return waveform.Resample(buckets), nil
+}
+
+// load reads a stored waveform
+func (s *waveformService) load(audioKey string) (*domain.Waveform, error) {
+	object, _, err := s.storage.Get(waveformKey(audioKey))
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(object)
+	if err != nil {
+		return nil, err
+	}
+	var waveform domain.Waveform
+	if err := waveform.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return &waveform, nil
+}
+
+// generateFromStorage copies stored audio to a temporary file so it can be
+// decoded, then generates its waveform
+func (s *waveformService) generateFromStorage(audioKey string) (*domain.Waveform, error) {
+	object, _, err := s.storage.Get(audioKey)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	file, err := os.CreateTemp("", "waveform-*"+path.Ext(audioKey))
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if _, err := io.Copy(file, object); err != nil {
+		return nil, err
+	}
+	return s.generate(file.Name(), audioKey)
+}
+
+// generate computes and stores the waveform of a local audio file
+func (s *waveformService) generate(filePath, audioKey string) (*domain.Waveform, error) {
+	waveform, err := computeWaveform(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := waveform.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storage.Put(waveformKey(audioKey), bytes.NewReader(data), int64(len(data)), "application/octet-stream"); err != nil {
+		return nil, fmt.Errorf("failed to store waveform: %w", err)
+	}
+	return waveform, nil
+}
+
+// computeWaveform decodes an audio file and collects the minimum and maximum
+// of its samples, mixed down to mono, per bucket
+func computeWaveform(filePath string) (*domain.Waveform, error) {
+	audioFormat, err := detectAudioFormat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	streamer, format, err := decodeAudio(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer streamer.Close()
+
+	scale := decodedLevelScale(audioFormat, format)
+	samplesPerPixel := waveformSamplesPerPixel
+	if length := streamer.Len(); length > waveformSamplesPerPixel*waveformMaxBuckets {
+		samplesPerPixel = int(math.Ceil(float64(length) / waveformMaxBuckets))
+	}
+
+	waveform := &domain.Waveform{
+		SampleRate:      int(format.SampleRate),
+		SamplesPerPixel: samplesPerPixel,
+		Bits:            16,
+	}
+	low, high := math.Inf(1), math.Inf(-1)
+	filled := 0
+	flush := func() {
+		waveform.Data = append(waveform.Data, waveformSample(low), waveformSample(high))
+		waveform.Length++
+		low, high, filled = math.Inf(1), math.Inf(-1), 0
+	}
+
+	buf := make([][2]float64, 4096)
+	for {
+		n, ok := streamer.Stream(buf)
+		for _, sample := range buf[:n] {
+			v := (sample[0] + sample[1]) / 2 * scale
+			low, high = math.Min(low, v), math.Max(high, v)
+			filled++
+			if filled == samplesPerPixel {
+				flush()
+			}
+		}
+		if !ok {
+			break
+		}
+	}
+	// The FLAC decoder reports the end of the stream as an error
+	if err := streamer.Err(); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if filled > 0 {
+		flush()
+	}
+	return waveform, nil
+}
+
+// waveformSample converts a sample to a 16 bit waveform value
+func waveformSample(v float64) int16 {
+	return int16(math.Round(math.Max(-1, math.Min(1, v)) * math.MaxInt16))
+}
+
+// waveformKey returns the storage key of the waveform of stored audio. It is
+// derived from the audio file so duplicates share waveforms
+func waveformKey(audioKey string) string {
+	return path.Join(waveformPrefix, strings.TrimSuffix(audioKey, path.Ext(audioKey))+".dat")
+}
@@ -4,12 +4,13 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
 	"github.com/gin-gonic/gin"
 )
 
-// ValidateTokenAndGetUsername validates the token and returns the username
+// ValidateTokenAndGetClaims validates the token and returns its claims
 // It can be used with both header-based and query-based token validation
-func ValidateTokenAndGetUsername(c *gin.Context) (string, error) {
+func ValidateTokenAndGetClaims(c *gin.Context) (*Claims, error) {
 	var token string
 
 	// Try to get token from Authorization header first
@@ -22,10 +23,16 @@ func ValidateTokenAndGetUsername(c *gin.Context) (string, error) {
 	}
 
 	if token == "" {
-		return "", gin.Error{Err: nil, Type: gin.ErrorTypePrivate, Meta: "token is required"}
+		return nil, gin.Error{Err: nil, Type: gin.ErrorTypePrivate, Meta: "token is required"}
 	}
 
-	claims, err := ValidateToken(token)
+	return ValidateToken(token)
+}
+
+// ValidateTokenAndGetUsername validates the token and returns the username
+// It can be used with both header-based and query-based token validation
+func ValidateTokenAndGetUsername(c *gin.Context) (string, error) {
+	claims, err := ValidateTokenAndGetClaims(c)
 	if err != nil {
 		return "", err
 	}
@@ -33,17 +40,40 @@ func ValidateTokenAndGetUsername(c *gin.Context) (string, error) {
 	return claims.Username, nil
 }
 
-// AuthMiddleware handles authentication using the reusable function
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware handles authentication using the reusable function and
+// rejects tokens whose session has been revoked
+func AuthMiddleware(sessionService domain.SessionService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		username, err := ValidateTokenAndGetUsername(c)
+		claims, err := ValidateTokenAndGetClaims(c)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 			c.Abort()
 			return
 		}
 
-		c.Set("username", username)
+		if err := sessionService.ValidateSession(claims.SessionID); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.Abort()
+			return
+		}
+
+		c.Set("username", claims.Username)
+		c.Set("session_id", claims.SessionID)
+		c.Set("role", claims.Role)
+		c.Next()
+	}
+}
+
+// RequirePermission rejects requests whose user role lacks the given permission.
+// It must be used after AuthMiddleware
+func RequirePermission(permission domain.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !domain.Role(c.GetString("role")).Can(permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+			c.Abort()
+			return
+		}
+
 		c.Next()
 	}
 }
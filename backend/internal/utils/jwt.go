@@ -10,24 +10,27 @@ import (
 
 // Claims represents the JWT claims structure
 type Claims struct {
-	Username string `json:"username"`
+	Username  string `json:"username"`
+	SessionID string `json:"sid"`
+	Role      string `json:"role"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken creates a new JWT token for the given username
-func GenerateToken(username string) (string, error) {
+// GenerateAccessToken creates a new short-lived JWT token for the given username, session and role
+func GenerateAccessToken(username, sessionID, role string, ttl time.Duration) (string, error) {
 	// Get JWT secret from environment
 	jwtSecret := os.Getenv("JWT_SECRET")
 	if jwtSecret == "" {
 		return "", errors.New("JWT_SECRET environment variable is not set")
 	}
 
-	// Set expiration time to 24 hours
-	expirationTime := time.Now().Add(24 * time.Hour)
+	expirationTime := time.Now().Add(ttl)
 
-	// Create claims with username and expiration time
+	// Create claims with username, session, role and expiration time
 	claims := &Claims{
-		Username: username,
+		Username:  username,
+		SessionID: sessionID,
+		Role:      role,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -4,8 +4,11 @@ import (
 	"context"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/aliBordbar1992/musicstream-backend/internal/domain"
+	"github.com/aliBordbar1992/musicstream-backend/internal/repositories"
+	"github.com/aliBordbar1992/musicstream-backend/internal/services"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -41,19 +44,148 @@ func init() {
 }
 
 func migrateSchema(db *gorm.DB) error {
+	// The legacy sessions table was keyed by the raw JWT and never written to,
+	// drop it so it gets recreated with the new schema
+	if db.Migrator().HasTable("sessions") && db.Migrator().HasColumn("sessions", "token") {
+		if err := db.Migrator().DropTable("sessions"); err != nil {
+			return err
+		}
+	}
+
 	// Auto migrate all models
 	return db.AutoMigrate(
 		&domain.User{},
 		&domain.Session{},
+		&domain.RefreshToken{},
 		&domain.Artist{},
+		&domain.Artwork{},
+		&domain.Album{},
+		&domain.AudioBlob{},
 		&domain.Music{},
+		&domain.TrackArtist{},
 		&domain.Playlist{},
-		&domain.PlaylistMusic{},
+		&domain.PlaylistEntry{},
+		&domain.PlaylistMember{},
 		&domain.Queue{},
 		&domain.QueueItem{},
+		&domain.Job{},
 	)
 }
 
+// migratePlaylistEntries moves the songs of playlists made before playlists
+// were ordered into playlist entries. The old table had no order, its rows
+// are numbered in the order they are stored, which is how they were listed
+func migratePlaylistEntries(db *gorm.DB) error {
+	if !db.Migrator().HasTable("playlist_musics") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`INSERT INTO playlist_entries (playlist_id, music_id, position, added_by, added_at)
+			SELECT pm.playlist_id, pm.music_id, ROW_NUMBER() OVER (PARTITION BY pm.playlist_id ORDER BY pm.ctid) * ?,
+				p.created_by, p.created_at
+			FROM playlist_musics pm JOIN playlists p ON p.id = pm.playlist_id`,
+			domain.PlaylistPositionGap).Error; err != nil {
+			return err
+		}
+		return tx.Migrator().DropTable("playlist_musics")
+	})
+}
+
+// backfillAlbums creates album rows for tracks that only carry a free-text
+// album name, so albums uploaded before the album entity existed are matched
+// the same way as new uploads
+func backfillAlbums(db *gorm.DB) error {
+	albumService := services.NewAlbumService(repositories.NewAlbumRepository(db))
+
+	var tracks []*domain.Music
+	return db.Where("album_id IS NULL AND TRIM(album) <> ''").
+		FindInBatches(&tracks, 200, func(tx *gorm.DB, batch int) error {
+			for _, track := range tracks {
+				album, err := albumService.GetOrCreateAlbum(track.Album, track.ArtistID, track.Year, track.ArtworkID)
+				if err != nil {
+					return err
+				}
+				if err := db.Model(track).UpdateColumn("album_id", album.ID).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
+
+// backfillTrackArtists credits the artist of tracks uploaded before tracks
+// could have several artists as their primary artist
+func backfillTrackArtists(db *gorm.DB) error {
+	return db.Exec(`INSERT INTO track_artists (music_id, artist_id, role, position)
+		SELECT m.id, m.artist_id, ?, 0 FROM musics m
+		WHERE NOT EXISTS (SELECT 1 FROM track_artists ta WHERE ta.music_id = m.id)`,
+		domain.ArtistRolePrimary).Error
+}
+
+// migrateStoragePaths turns the file paths stored before files went through
+// the storage abstraction, e.g. "uploads\artwork\x.jpg", into storage keys
+// relative to the uploads directory such as "artwork/x.jpg"
+func migrateStoragePaths(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, table := range []string{"musics", "audio_blobs", "artworks"} {
+			if err := tx.Exec(`UPDATE ` + table + ` SET file_path = regexp_replace(replace(file_path, '\', '/'), '^(\./)?uploads/', '')
+				WHERE strpos(file_path, '\') > 0 OR file_path ~ '^(\./)?uploads/'`).Error; err != nil {
+				return err
+			}
+		}
+
+		// Profile pictures keep the path they are served under
+		return tx.Exec(`UPDATE users SET profile_picture = replace(profile_picture, '\', '/')
+			WHERE strpos(profile_picture, '\') > 0`).Error
+	})
+}
+
+// backfillAudioFormats sets the format of tracks uploaded before formats were
+// detected. Those files were only accepted by their extension
+func backfillAudioFormats(db *gorm.DB) error {
+	for _, format := range domain.AudioFormats {
+		if err := db.Model(&domain.Music{}).
+			Where("COALESCE(mime_type, '') = '' AND LOWER(file_path) LIKE ?", "%"+format.Extension).
+			Updates(map[string]interface{}{
+				"container": format.Container,
+				"codec":     format.Codec,
+				"mime_type": format.MimeType,
+			}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillFileSizes sets the size of tracks uploaded before sizes were
+// counted against quotas from their audio file. Tracks older than shared
+// audio files are measured by the backfill-file-sizes command
+func backfillFileSizes(db *gorm.DB) error {
+	return db.Exec(`UPDATE musics SET file_size = audio_blobs.size
+		FROM audio_blobs
+		WHERE musics.blob_id = audio_blobs.id AND musics.file_size = 0`).Error
+}
+
+// promoteAdmins grants the admin role to the users listed in ADMIN_USERNAMES
+// (comma separated) so a fresh installation can bootstrap its first admin
+func promoteAdmins(db *gorm.DB) error {
+	var usernames []string
+	for _, username := range strings.Split(os.Getenv("ADMIN_USERNAMES"), ",") {
+		if username = strings.TrimSpace(username); username != "" {
+			usernames = append(usernames, username)
+		}
+	}
+
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	return db.Model(&domain.User{}).
+		Where("username IN ?", usernames).
+		Update("role", domain.RoleAdmin).Error
+}
+
 func main() {
 	if err := godotenv.Load(); err != nil {
 		log.Fatal("Error loading .env file")
@@ -68,20 +200,70 @@ func main() {
 		log.Fatal("Failed to migrate schema:", err)
 	}
 
+	if err := migrateSearch(DB); err != nil {
+		log.Fatal("Failed to migrate search:", err)
+	}
+
+	if err := migratePlaylistEntries(DB); err != nil {
+		log.Fatal("Failed to migrate playlist entries:", err)
+	}
+
+	if err := backfillAlbums(DB); err != nil {
+		log.Fatal("Failed to backfill albums:", err)
+	}
+
+	if err := backfillTrackArtists(DB); err != nil {
+		log.Fatal("Failed to backfill track artists:", err)
+	}
+
+	if err := backfillAudioFormats(DB); err != nil {
+		log.Fatal("Failed to backfill audio formats:", err)
+	}
+
+	if err := backfillFileSizes(DB); err != nil {
+		log.Fatal("Failed to backfill file sizes:", err)
+	}
+
+	if err := promoteAdmins(DB); err != nil {
+		log.Fatal("Failed to promote admins:", err)
+	}
+
+	if err := migrateStoragePaths(DB); err != nil {
+		log.Fatal("Failed to migrate storage paths:", err)
+	}
+
+	storage, err := openStorage()
+	if err != nil {
+		log.Fatal("Failed to open storage:", err)
+	}
+
+	fetcher, err := openRemoteFetcher()
+	if err != nil {
+		log.Fatal("Failed to configure remote fetches:", err)
+	}
+
+	// Maintenance commands run instead of the server
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], DB, storage); err != nil {
+			log.Fatalf("Failed to run %s: %v", os.Args[1], err)
+		}
+		return
+	}
+
 	r := gin.Default()
 
 	// Configure CORS
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000", "https://localhost:3000"}, // Your frontend URL
-		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods:     []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "Tus-Resumable", "Upload-Length", "Upload-Metadata", "Upload-Offset"},
+		ExposeHeaders:    []string{"Content-Length", "Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Upload-Length", "Upload-Metadata", "Upload-Offset", "Upload-Expires"},
 		AllowCredentials: true,
 		MaxAge:           12 * 60 * 60, // 12 hours
 	}))
 
 	// Initialize services
 
-	RegisterRoutes(r)
+	RegisterRoutes(r, storage, fetcher)
 	r.RunTLS(":8080", "./certs/server.crt", "./certs/server.key")
 }
@@ -1,7 +1,8 @@
 package main
 
 import (
-	"net/http"
+	"os"
+	"path/filepath"
 
 	"github.com/aliBordbar1992/musicstream-backend/internal/controllers"
 	"github.com/aliBordbar1992/musicstream-backend/internal/controllers/websocket"
@@ -13,39 +14,107 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// maxJSONBodySize caps the body of requests carrying JSON rather than files
+const maxJSONBodySize = 1 << 20
+
 // RegisterRoutes sets up all the routes for the application
-func RegisterRoutes(r *gin.Engine) {
+func RegisterRoutes(r *gin.Engine, storage domain.Storage, fetcher domain.RemoteFetcher) {
 	// Initialize repositories
 	userRepo := repositories.NewUserRepository(DB)
 	musicRepo := repositories.NewMusicRepository(DB)
 	playlistRepo := repositories.NewPlaylistRepository(DB)
 	artistRepo := repositories.NewArtistRepository(DB)
 	queueRepo := repositories.NewQueueRepository(DB)
+	sessionRepo := repositories.NewSessionRepository(DB)
+	artworkRepo := repositories.NewArtworkRepository(DB)
+	albumRepo := repositories.NewAlbumRepository(DB)
+	searchRepo := repositories.NewSearchRepository(DB)
+	audioBlobRepo := repositories.NewAudioBlobRepository(DB)
+	jobRepo := repositories.NewJobRepository(DB)
 
 	// Initialize services
-	uploadService := services.NewUploadService("uploads", DB)
-	userService := services.NewUserService(userRepo, uploadService)
-	fileService := services.NewFileService()
-	musicService := services.NewMusicService(musicRepo, artistRepo, fileService)
-	playlistService := services.NewPlaylistService(playlistRepo, musicRepo)
-	artistService := services.NewArtistService(artistRepo)
-	queueService := services.NewQueueService(queueRepo, musicRepo)
+	metadataExtractor := services.NewMetadataExtractor()
+	artworkService := services.NewArtworkService(artworkRepo, musicRepo, albumRepo, artistRepo, storage)
+	artistService := services.NewArtistService(artistRepo, artworkService)
+	albumService := services.NewAlbumService(albumRepo)
+	audioBlobService := services.NewAudioBlobService(audioBlobRepo, storage)
+	searchService := services.NewSearchService(searchRepo)
+	waveformService := services.NewWaveformService(storage)
 	cacheService := services.NewRedisCacheService(redisClient)
 	listenerService := services.NewListenerService(cacheService, userRepo)
+	// Job updates are pushed to uploaders over their WebSocket
+	websocketController := websocket.NewWebSocketController(listenerService, userRepo)
+	jobService := services.NewJobService(jobRepo, websocketController, getEnvInt("JOB_MAX_ATTEMPTS", services.DefaultJobAttempts))
+	// Jobs run on whichever instance claims them, so instances sharing the
+	// database must share the staging directory too, e.g. on a network volume
+	stagingDir := getEnvString("STAGING_DIR", filepath.Join(os.TempDir(), "musicstream"))
+	quotaService := services.NewQuotaService(musicRepo, userRepo, loadQuotas())
+	uploadService := services.NewUploadService(stagingDir, storage, metadataExtractor, artistService, artworkService, albumService, audioBlobService, waveformService, jobService, fetcher, quotaService)
+	tusService := services.NewTusService(
+		getEnvString("TUS_UPLOAD_DIR", filepath.Join(stagingDir, "tus")),
+		stagingDir,
+		getEnvDuration("TUS_UPLOAD_EXPIRY", services.DefaultTusUploadExpiry),
+		int64(getEnvInt("TUS_MAX_SIZE", int(services.DefaultTusMaxSize))),
+		uploadService,
+		services.NewFileService(),
+		quotaService,
+	)
+	passwordHasher := services.NewPasswordHasher(os.Getenv("PASSWORD_HASH_ALGORITHM"))
+	passwordPolicy := services.NewPasswordPolicy()
+	sessionService := services.NewSessionService(
+		sessionRepo,
+		userRepo,
+		getEnvDuration("ACCESS_TOKEN_TTL", services.DefaultAccessTokenTTL),
+		getEnvDuration("REFRESH_TOKEN_TTL", services.DefaultRefreshTokenTTL),
+	)
+	userService := services.NewUserService(userRepo, uploadService, passwordHasher, sessionService)
+	musicService := services.NewMusicService(musicRepo, artistRepo, storage, audioBlobService)
+	// Playlist edits are pushed to the members of shared playlists as well
+	playlistService := services.NewPlaylistService(playlistRepo, musicRepo, userRepo, websocketController)
+	queueService := services.NewQueueService(queueRepo, musicRepo)
+	streamSigner := services.NewStreamSigner(
+		streamURLSecret(),
+		getEnvDuration("STREAM_URL_TTL", services.DefaultStreamURLTTL),
+		getEnvBool("STREAM_URL_BIND_IP", false),
+	)
+	hlsService := services.NewHLSService(storage, services.DefaultHLSSegmentDuration)
+	adminService := services.NewAdminService(userRepo, musicRepo, artistRepo, albumRepo, playlistRepo, sessionService)
 
-	// Initialize link validator
-	linkValidator := domain.NewLinkValidator(&http.Client{})
+	// Start processing uploads in the background
+	uploadService.RegisterJobHandlers(services.NewFileService(), musicService, playlistService)
+	jobService.Start(getEnvInt("JOB_WORKERS", services.DefaultJobWorkers))
+	tusService.Start()
 
 	// Initialize controllers
-	userController := controllers.NewUserController(userService)
-	musicController := controllers.NewMusicController(musicService, uploadService, linkValidator)
-	playlistController := controllers.NewPlaylistController(playlistService)
-	artistController := controllers.NewArtistController(artistService)
+	userController := controllers.NewUserController(userService, passwordPolicy)
+	sessionController := controllers.NewSessionController(sessionService)
+	musicController := controllers.NewMusicController(musicService, uploadService, streamSigner)
+	playlistController := controllers.NewPlaylistController(
+		playlistService,
+		services.NewPlaylistExporter(),
+		streamSigner,
+		os.Getenv("PUBLIC_BASE_URL"),
+		getEnvDuration("PLAYLIST_EXPORT_URL_TTL", services.DefaultExportURLTTL),
+	)
+	artistController := controllers.NewArtistController(artistService, musicService, albumService, listenerService)
+	albumController := controllers.NewAlbumController(albumService)
+	searchController := controllers.NewSearchController(searchService)
 	queueController := controllers.NewQueueController(queueService)
-	websocketController := websocket.NewWebSocketController(listenerService, userRepo)
+	adminController := controllers.NewAdminController(adminService, artistService)
+	artworkController := controllers.NewArtworkController(artworkService)
+	storageController := controllers.NewStorageController(storage)
+	hlsController := controllers.NewHLSController(musicService, hlsService, streamSigner)
+	waveformController := controllers.NewWaveformController(musicService, waveformService)
+	jobController := controllers.NewJobController(jobService)
+	tusController := controllers.NewTusController(tusService)
+	quotaController := controllers.NewQuotaController(quotaService)
+
+	authMiddleware := utils.AuthMiddleware(sessionService)
+	maxUploadSize := int64(getEnvInt("MAX_UPLOAD_SIZE", int(services.DefaultMaxUploadSize)))
+	maxImportSize := int64(getEnvInt("MAX_IMPORT_SIZE", int(services.DefaultMaxImportSize)))
 
-	// Serve static files from uploads directory
-	r.Static("/uploads", "./uploads")
+	// Serve public uploads such as profile pictures from storage
+	r.GET("/uploads/*key", storageController.ServeUpload)
 
 	// Health check
 	r.GET("/health", func(c *gin.Context) {
@@ -55,40 +124,104 @@ func RegisterRoutes(r *gin.Engine) {
 	// User routes
 	r.POST("/register", userController.Register)
 	r.POST("/login", userController.Login)
-	r.GET("/me", utils.AuthMiddleware(), userController.GetUser)
-	r.GET("/me/music", utils.AuthMiddleware(), musicController.GetUserMusic)
-	r.PUT("/me/profile", utils.AuthMiddleware(), userController.UpdateProfile)
+	r.GET("/me", authMiddleware, userController.GetUser)
+	r.GET("/me/music", authMiddleware, musicController.GetUserMusic)
+	r.GET("/me/usage", authMiddleware, quotaController.GetUsage)
+	r.GET("/me/playlist-invitations", authMiddleware, playlistController.ListInvitations)
+	r.PUT("/me/profile", authMiddleware, userController.UpdateProfile)
+
+	// Session routes
+	r.POST("/refresh", sessionController.Refresh)
+	r.POST("/logout", authMiddleware, sessionController.Logout)
+	r.POST("/logout-all", authMiddleware, sessionController.LogoutAll)
+	r.GET("/sessions", authMiddleware, sessionController.ListSessions)
+	r.DELETE("/sessions/:id", authMiddleware, sessionController.RevokeSession)
+
+	// Search route
+	r.GET("/search", authMiddleware, searchController.Search)
 
 	// Music routes
-	r.POST("/music/upload", utils.AuthMiddleware(), musicController.UploadMusic)
-	r.POST("/music/download", utils.AuthMiddleware(), musicController.DownloadMusicFromURL)
-	r.GET("/music/:id", utils.AuthMiddleware(), musicController.GetMusic)
+	r.POST("/music/upload", authMiddleware, utils.RequirePermission(domain.PermUploadMusic), utils.MaxBodySize(maxUploadSize), musicController.UploadMusic)
+	r.POST("/music/import", authMiddleware, utils.RequirePermission(domain.PermUploadMusic), utils.MaxBodySize(maxImportSize), musicController.ImportMusic)
+	r.POST("/music/download", authMiddleware, utils.RequirePermission(domain.PermUploadMusic), utils.MaxBodySize(maxJSONBodySize), musicController.DownloadMusicFromURL)
+
+	// Resumable uploads per the tus protocol, completed uploads are ingested
+	// like those of /music/upload
+	tus := r.Group("/music/tus", tusController.RequireTusVersion)
+	tus.OPTIONS("", tusController.Options)
+	tus.OPTIONS("/:id", tusController.Options)
+	tusUploads := tus.Group("", authMiddleware, utils.RequirePermission(domain.PermUploadMusic))
+	tusUploads.POST("", tusController.CreateUpload)
+	tusUploads.HEAD("/:id", tusController.GetUpload)
+	tusUploads.PATCH("/:id", tusController.PatchUpload)
+	tusUploads.DELETE("/:id", tusController.DeleteUpload)
+
+	r.GET("/music/:id", authMiddleware, musicController.GetMusic)
+	r.GET("/music/:id/stream-url", authMiddleware, musicController.GetStreamURL)
 	r.GET("/music/:id/stream", musicController.StreamMusic)
-	r.GET("/music", utils.AuthMiddleware(), musicController.ListMusic)
-	r.GET("/music/search", utils.AuthMiddleware(), musicController.SearchMusic)
-	r.DELETE("/music/:id", utils.AuthMiddleware(), musicController.DeleteMusic)
+	r.GET("/music/:id/hls/index.m3u8", authMiddleware, hlsController.GetPlaylist)
+	r.GET("/music/:id/hls/segments/:segment", hlsController.GetSegment)
+	r.GET("/music/:id/waveform", authMiddleware, waveformController.GetWaveform)
+	r.GET("/music/:id/cover", artworkController.GetMusicCover)
+	r.GET("/music", authMiddleware, musicController.ListMusic)
+	r.GET("/music/search", authMiddleware, musicController.SearchMusic)
+	r.DELETE("/music/:id", authMiddleware, musicController.DeleteMusic)
 
 	// Playlist routes
-	r.POST("/playlists", utils.AuthMiddleware(), playlistController.CreatePlaylist)
-	r.GET("/playlists/:id", utils.AuthMiddleware(), playlistController.GetPlaylist)
-	r.GET("/playlists", utils.AuthMiddleware(), playlistController.ListPlaylists)
-	r.DELETE("/playlists/:id", utils.AuthMiddleware(), playlistController.DeletePlaylist)
-	r.POST("/playlists/:id/songs", utils.AuthMiddleware(), playlistController.AddSongToPlaylist)
-	r.DELETE("/playlists/:id/songs/:musicId", utils.AuthMiddleware(), playlistController.RemoveSongFromPlaylist)
-	r.GET("/playlists/:id/songs", utils.AuthMiddleware(), playlistController.GetPlaylistSongs)
+	r.POST("/playlists", authMiddleware, playlistController.CreatePlaylist)
+	r.GET("/playlists/:id", authMiddleware, playlistController.GetPlaylist)
+	r.GET("/playlists", authMiddleware, playlistController.ListPlaylists)
+	r.DELETE("/playlists/:id", authMiddleware, playlistController.DeletePlaylist)
+	r.POST("/playlists/:id/songs", authMiddleware, playlistController.AddSongToPlaylist)
+	r.DELETE("/playlists/:id/songs/:musicId", authMiddleware, playlistController.RemoveSongFromPlaylist)
+	r.GET("/playlists/:id/songs", authMiddleware, playlistController.GetPlaylistSongs)
+	r.GET("/playlists/:id/entries", authMiddleware, playlistController.GetPlaylistEntries)
+	r.PUT("/playlists/:id/entries", authMiddleware, utils.MaxBodySize(maxJSONBodySize), playlistController.ReorderPlaylistEntries)
+	r.DELETE("/playlists/:id/entries/:entryId", authMiddleware, playlistController.RemovePlaylistEntry)
+	r.PUT("/playlists/:id/entries/:entryId/position", authMiddleware, playlistController.MovePlaylistEntry)
+	r.GET("/playlists/:id/export", authMiddleware, playlistController.ExportPlaylist)
+	r.GET("/playlists/:id/members", authMiddleware, playlistController.ListMembers)
+	r.POST("/playlists/:id/members", authMiddleware, playlistController.InviteMember)
+	r.PUT("/playlists/:id/members/:username", authMiddleware, playlistController.UpdateMember)
+	r.DELETE("/playlists/:id/members/:username", authMiddleware, playlistController.RemoveMember)
+	r.POST("/playlists/:id/accept", authMiddleware, playlistController.AcceptInvitation)
+	r.POST("/playlists/:id/leave", authMiddleware, playlistController.LeavePlaylist)
 
 	// Artist routes
-	r.GET("/artists/search", utils.AuthMiddleware(), artistController.SearchArtists)
-	r.POST("/artists", utils.AuthMiddleware(), artistController.CreateArtist)
+	r.GET("/artists/search", authMiddleware, artistController.SearchArtists)
+	r.POST("/artists", authMiddleware, artistController.CreateArtist)
+	r.GET("/artists/:id", authMiddleware, artistController.GetArtist)
+	r.PATCH("/artists/:id", authMiddleware, utils.RequirePermission(domain.PermManageArtists), artistController.UpdateArtist)
+	r.GET("/artists/:id/albums", authMiddleware, albumController.GetArtistAlbums)
+	r.GET("/artists/:id/image", artworkController.GetArtistImage)
+
+	// Album routes
+	r.GET("/albums", authMiddleware, albumController.ListAlbums)
+	r.GET("/albums/:id", authMiddleware, albumController.GetAlbum)
+	r.GET("/albums/:id/cover", artworkController.GetAlbumCover)
 
 	// Queue management routes
-	r.POST("/queue", utils.AuthMiddleware(), queueController.CreateQueue)
-	r.GET("/queue", utils.AuthMiddleware(), queueController.GetQueue)
-	r.POST("/queue/items", utils.AuthMiddleware(), queueController.AddToQueue)
-	r.POST("/queue/next", utils.AuthMiddleware(), queueController.AddToNext)
-	r.DELETE("/queue/items/:id", utils.AuthMiddleware(), queueController.RemoveFromQueue)
-	r.PUT("/queue/items/:id/position", utils.AuthMiddleware(), queueController.UpdateQueueItemPosition)
+	r.POST("/queue", authMiddleware, queueController.CreateQueue)
+	r.GET("/queue", authMiddleware, queueController.GetQueue)
+	r.POST("/queue/items", authMiddleware, queueController.AddToQueue)
+	r.POST("/queue/next", authMiddleware, queueController.AddToNext)
+	r.DELETE("/queue/items/:id", authMiddleware, queueController.RemoveFromQueue)
+	r.PUT("/queue/items/:id/position", authMiddleware, queueController.UpdateQueueItemPosition)
+
+	// Background job routes
+	r.GET("/jobs/:id", authMiddleware, jobController.GetJob)
+	r.POST("/jobs/:id/cancel", authMiddleware, jobController.CancelJob)
+
+	// Admin routes
+	admin := r.Group("/admin", authMiddleware)
+	admin.GET("/users", utils.RequirePermission(domain.PermManageUsers), adminController.ListUsers)
+	admin.PUT("/users/:username/role", utils.RequirePermission(domain.PermManageUsers), adminController.SetUserRole)
+	admin.POST("/users/:username/disable", utils.RequirePermission(domain.PermManageUsers), adminController.DisableUser)
+	admin.POST("/users/:username/enable", utils.RequirePermission(domain.PermManageUsers), adminController.EnableUser)
+	admin.DELETE("/music/:id", utils.RequirePermission(domain.PermDeleteAnyMusic), musicController.DeleteMusic)
+	admin.POST("/artists/merge", utils.RequirePermission(domain.PermManageArtists), adminController.MergeArtists)
+	admin.GET("/stats", utils.RequirePermission(domain.PermViewStats), adminController.GetStats)
 
 	// WebSocket route for synchronized listening
-	r.GET("/ws/listen", utils.AuthMiddleware(), websocketController.HandleWebSocket)
+	r.GET("/ws/listen", authMiddleware, websocketController.HandleWebSocket)
 }
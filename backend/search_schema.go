@@ -0,0 +1,88 @@
+package main
+
+import "gorm.io/gorm"
+
+// searchSchema sets up full-text and trigram search. Tracks are indexed by
+// title (weight A), credited artist names (B) and album (C); the vector is
+// kept up to date by triggers since it spans several tables. Artists, albums
+// and playlists only index their own name, so generated columns suffice
+var searchSchema = []string{
+	`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+
+	`CREATE OR REPLACE FUNCTION music_search_document(p_music_id bigint, p_title text, p_album text, p_artist_id bigint)
+	RETURNS tsvector AS $$
+		SELECT setweight(to_tsvector('simple', coalesce(p_title, '')), 'A') ||
+			setweight(to_tsvector('simple', coalesce((
+				SELECT string_agg(a.name, ' ') FROM artists a
+				WHERE a.id = p_artist_id
+					OR a.id IN (SELECT ta.artist_id FROM track_artists ta WHERE ta.music_id = p_music_id)
+			), '')), 'B') ||
+			setweight(to_tsvector('simple', coalesce(p_album, '')), 'C')
+	$$ LANGUAGE sql STABLE`,
+
+	`ALTER TABLE musics ADD COLUMN IF NOT EXISTS search_vector tsvector`,
+
+	`CREATE OR REPLACE FUNCTION musics_search_vector_update() RETURNS trigger AS $$
+	BEGIN
+		NEW.search_vector := music_search_document(NEW.id, NEW.title, NEW.album, NEW.artist_id);
+		RETURN NEW;
+	END
+	$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS musics_search_vector_trigger ON musics`,
+	`CREATE TRIGGER musics_search_vector_trigger BEFORE INSERT OR UPDATE OF title, album, artist_id ON musics
+		FOR EACH ROW EXECUTE FUNCTION musics_search_vector_update()`,
+
+	// Credits are inserted after their track, and artists may be renamed
+	`CREATE OR REPLACE FUNCTION track_artists_search_vector_update() RETURNS trigger AS $$
+	BEGIN
+		UPDATE musics SET search_vector = music_search_document(id, title, album, artist_id)
+		WHERE id = CASE WHEN TG_OP = 'DELETE' THEN OLD.music_id ELSE NEW.music_id END;
+		RETURN NULL;
+	END
+	$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS track_artists_search_vector_trigger ON track_artists`,
+	`CREATE TRIGGER track_artists_search_vector_trigger AFTER INSERT OR UPDATE OR DELETE ON track_artists
+		FOR EACH ROW EXECUTE FUNCTION track_artists_search_vector_update()`,
+
+	`CREATE OR REPLACE FUNCTION artists_search_vector_update() RETURNS trigger AS $$
+	BEGIN
+		UPDATE musics SET search_vector = music_search_document(id, title, album, artist_id)
+		WHERE artist_id = NEW.id OR id IN (SELECT music_id FROM track_artists WHERE artist_id = NEW.id);
+		RETURN NULL;
+	END
+	$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS artists_search_vector_trigger ON artists`,
+	`CREATE TRIGGER artists_search_vector_trigger AFTER UPDATE OF name ON artists
+		FOR EACH ROW EXECUTE FUNCTION artists_search_vector_update()`,
+
+	`UPDATE musics SET search_vector = music_search_document(id, title, album, artist_id) WHERE search_vector IS NULL`,
+
+	`ALTER TABLE artists ADD COLUMN IF NOT EXISTS search_vector tsvector
+		GENERATED ALWAYS AS (to_tsvector('simple', coalesce(name, ''))) STORED`,
+	`ALTER TABLE albums ADD COLUMN IF NOT EXISTS search_vector tsvector
+		GENERATED ALWAYS AS (to_tsvector('simple', coalesce(title, ''))) STORED`,
+	`ALTER TABLE playlists ADD COLUMN IF NOT EXISTS search_vector tsvector
+		GENERATED ALWAYS AS (to_tsvector('simple', coalesce(name, ''))) STORED`,
+
+	`CREATE INDEX IF NOT EXISTS idx_musics_search_vector ON musics USING GIN (search_vector)`,
+	`CREATE INDEX IF NOT EXISTS idx_artists_search_vector ON artists USING GIN (search_vector)`,
+	`CREATE INDEX IF NOT EXISTS idx_albums_search_vector ON albums USING GIN (search_vector)`,
+	`CREATE INDEX IF NOT EXISTS idx_playlists_search_vector ON playlists USING GIN (search_vector)`,
+
+	`CREATE INDEX IF NOT EXISTS idx_musics_title_trgm ON musics USING GIN (title gin_trgm_ops)`,
+	`CREATE INDEX IF NOT EXISTS idx_artists_name_trgm ON artists USING GIN (name gin_trgm_ops)`,
+	`CREATE INDEX IF NOT EXISTS idx_albums_title_trgm ON albums USING GIN (title gin_trgm_ops)`,
+	`CREATE INDEX IF NOT EXISTS idx_playlists_name_trgm ON playlists USING GIN (name gin_trgm_ops)`,
+}
+
+// migrateSearch creates the search columns, triggers and indexes
+func migrateSearch(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range searchSchema {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -1,7 +1,7 @@
 "use client";
 
 import { useEffect, useState, useRef, useCallback } from "react";
-import { playlists, music } from "@/lib/api";
+import { playlists } from "@/lib/api";
 import toast from "react-hot-toast";
 import axios from "axios";
 import Link from "next/link";
@@ -121,7 +121,7 @@ export default function PlaylistPage({ params }: { params: ParamsType }) {
       title: track.title,
       artist: track.artist.name,
       duration: track.duration,
-      url: music.stream(track.id),
+      position: null,
     }),
     []
   );
@@ -232,13 +232,7 @@ export default function PlaylistPage({ params }: { params: ParamsType }) {
                     >
                       <div className="flex-1">
                         <MusicItem
-                          music={{
-                            id: song.id,
-                            title: song.title,
-                            artist: song.artist,
-                            duration: song.duration,
-                            url: music.stream(song.id),
-                          }}
+                          music={song}
                           onPlay={() => handlePlayTrack(song)}
                           onRemove={() => handleRemoveSong(song.id)}
                           showRemoveButton={playlist.is_owner}
@@ -1,10 +1,8 @@
-import { auth } from "@/lib/api";
+import { auth, clearTokens, saveTokens } from "@/lib/api";
 import { User } from "@/types/domain";
-import Cookies from "js-cookie";
 export class AuthService {
   static async login(username: string, password: string): Promise<void> {
-    const { token } = await auth.login(username, password);
-    Cookies.set("token", token);
+    saveTokens(await auth.login(username, password));
   }
 
   static async register(username: string, password: string): Promise<void> {
@@ -12,7 +10,13 @@ export class AuthService {
   }
 
   static async logout(): Promise<void> {
-    Cookies.remove("token");
+    // Revoke the server session, the local tokens go either way
+    try {
+      await auth.logout();
+    } catch (error) {
+      console.error("Failed to revoke session:", error);
+    }
+    clearTokens();
   }
 
   static async getCurrentUser(): Promise<User> {
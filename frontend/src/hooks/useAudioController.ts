@@ -1,6 +1,7 @@
 import { useState, useEffect, useCallback, RefObject } from "react";
 import debounce from "lodash/debounce";
 import { usePlayer } from "@/store/PlayerContext";
+import { music } from "@/lib/api";
 
 export function useAudioController(audioRef: RefObject<HTMLAudioElement>) {
   const {
@@ -17,6 +18,29 @@ export function useAudioController(audioRef: RefObject<HTMLAudioElement>) {
   const [progress, setProgress] = useState(0);
   const [currentTime, setCurrentTime] = useState(0);
   const [buffered, setBuffered] = useState(0);
+  const [sourceUrl, setSourceUrl] = useState<string | null>(null);
+
+  // Streams are played from signed URLs, get one whenever the track changes
+  const trackId = currentTrack?.id;
+  useEffect(() => {
+    setSourceUrl(null);
+    if (trackId === undefined) return;
+
+    let canceled = false;
+    music
+      .streamUrl(trackId)
+      .then((url) => {
+        if (!canceled) setSourceUrl(url);
+      })
+      .catch((error) => {
+        console.error("Failed to get stream URL:", error);
+        if (!canceled) pause();
+      });
+
+    return () => {
+      canceled = true;
+    };
+  }, [trackId, pause]);
 
   const updateProgressState = useCallback(
     (audio: HTMLAudioElement) => {
@@ -109,15 +133,15 @@ export function useAudioController(audioRef: RefObject<HTMLAudioElement>) {
     audio.addEventListener("pause", handlePause);
 
     // Update audio properties
-    if (currentTrack?.url) {
+    if (sourceUrl) {
       // reset audio state if the track URL has changed
-      if (audio.src.indexOf(currentTrack.url) === -1) {
+      if (audio.src.indexOf(sourceUrl) === -1) {
         audio.pause();
         audio.currentTime = 0;
 
         // Ensure the URL is properly encoded and includes necessary headers
         try {
-          const url = new URL(currentTrack.url);
+          const url = new URL(sourceUrl);
           // Add cache-busting parameter to prevent caching issues
           url.searchParams.set("t", Date.now().toString());
           audio.src = url.toString();
@@ -126,7 +150,7 @@ export function useAudioController(audioRef: RefObject<HTMLAudioElement>) {
           audio.preload = "metadata";
           audio.crossOrigin = "anonymous"; // Enable CORS if needed
         } catch {
-          console.error("Invalid audio URL:", currentTrack.url);
+          console.error("Invalid audio URL:", sourceUrl);
           handlePause();
           return;
         }
@@ -141,7 +165,7 @@ export function useAudioController(audioRef: RefObject<HTMLAudioElement>) {
     audio.muted = isMuted;
 
     // Handle play/pause state
-    if (isPlaying && currentTrack?.url) {
+    if (isPlaying && sourceUrl) {
       handlePlay();
     } else {
       handlePause();
@@ -158,7 +182,7 @@ export function useAudioController(audioRef: RefObject<HTMLAudioElement>) {
     };
   }, [
     audioRef,
-    currentTrack?.url,
+    sourceUrl,
     isPlaying,
     volume,
     isMuted,
@@ -68,7 +68,7 @@ export const useQueueManagement = (): [
           title: nextItem.music.title,
           artist: nextItem.music.artistName,
           duration: nextItem.music.duration,
-          url: `/api/music/${nextItem.music.id}/stream`,
+          position: 0,
         });
         setIsPlaying(true);
       }
@@ -106,7 +106,6 @@ export const useQueueManagement = (): [
           title: item.music.title,
           artist: item.music.artist.name,
           duration: item.music.duration,
-          url: `/api/music/${item.music.id}/stream`,
           position: 0,
         });
         setIsPlaying(true);
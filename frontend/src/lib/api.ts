@@ -1,6 +1,6 @@
-import axios from "axios";
+import axios, { AxiosError, InternalAxiosRequestConfig } from "axios";
 import Cookies from "js-cookie";
-import { Music } from "@/types/domain";
+import { Artist, AuthTokens, Music, Page, Playlist } from "@/types/domain";
 export const API_URL = process.env.NEXT_PUBLIC_API_URL;
 
 const api = axios.create({
@@ -19,24 +19,95 @@ api.interceptors.request.use((config) => {
   return config;
 });
 
-// Add a response interceptor to handle errors
+// Access tokens are short lived, the refresh token gets a new pair
+export const saveTokens = (tokens: AuthTokens) => {
+  Cookies.set("token", tokens.token);
+  Cookies.set("refresh_token", tokens.refresh_token);
+};
+
+export const clearTokens = () => {
+  Cookies.remove("token");
+  Cookies.remove("refresh_token");
+};
+
+// Requests failing at once share one refresh, refresh tokens are single use
+let refreshing: Promise<string> | null = null;
+
+const refreshTokens = (): Promise<string> => {
+  if (!refreshing) {
+    refreshing = (async () => {
+      const refreshToken = Cookies.get("refresh_token");
+      if (!refreshToken) throw new Error("No refresh token found");
+      // Plain axios so a failed refresh does not trigger another one
+      const response = await axios.post<AuthTokens>(`${API_URL}/refresh`, {
+        refresh_token: refreshToken,
+      });
+      saveTokens(response.data);
+      return response.data.token;
+    })().finally(() => {
+      refreshing = null;
+    });
+  }
+  return refreshing;
+};
+
+// Add a response interceptor to refresh expired tokens and replay the
+// request once
 api.interceptors.response.use(
   (response) => response,
-  (error) => {
-    if (error.response?.status === 401) {
-      console.log("401");
+  async (error: AxiosError) => {
+    const config = error.config as
+      | (InternalAxiosRequestConfig & { _retried?: boolean })
+      | undefined;
+    if (
+      error.response?.status !== 401 ||
+      !config ||
+      config._retried ||
+      config.url === "/login"
+    ) {
+      return Promise.reject(error);
     }
-    return Promise.reject(error);
+
+    config._retried = true;
+    try {
+      const token = await refreshTokens();
+      config.headers.Authorization = `Bearer ${token}`;
+    } catch {
+      clearTokens();
+      return Promise.reject(error);
+    }
+    return api(config);
   }
 );
 
+// Lists come in pages, follow next_cursor until every item is loaded
+const fetchAllPages = async <T>(path: string): Promise<T[]> => {
+  const items: T[] = [];
+  let cursor: string | undefined;
+  do {
+    const response = await api.get<Page<T>>(path, {
+      params: { cursor, limit: 100 },
+    });
+    items.push(...response.data.items);
+    cursor = response.data.has_more ? response.data.next_cursor : undefined;
+  } while (cursor);
+  return items;
+};
+
 export const auth = {
   register: async (username: string, password: string) => {
     const response = await api.post("/register", { username, password });
     return response.data;
   },
   login: async (username: string, password: string) => {
-    const response = await api.post("/login", { username, password });
+    const response = await api.post<AuthTokens>("/login", {
+      username,
+      password,
+    });
+    return response.data;
+  },
+  logout: async () => {
+    const response = await api.post("/logout");
     return response.data;
   },
   getCurrentUser: async () => {
@@ -62,18 +133,23 @@ export const music = {
     return response.data;
   },
   getAll: async () => {
-    const response = await api.get("/music");
-    return response.data;
+    return fetchAllPages<Music>("/music");
   },
   getUserMusic: async () => {
-    const response = await api.get("/me/music");
-    return response.data;
+    return fetchAllPages<Music>("/me/music");
   },
   getById: async (id: number) => {
     const response = await api.get(`/music/${id}`);
     return response.data;
   },
-  stream: (id: number) => `${API_URL}/music/${id}/stream`,
+  // Streams need a signed URL since audio elements cannot send the auth
+  // header. Signed URLs expire, get a new one for every playback
+  streamUrl: async (id: number): Promise<string> => {
+    const response = await api.get<{ url: string; expires_at: string }>(
+      `/music/${id}/stream-url`
+    );
+    return `${API_URL}${response.data.url}`;
+  },
   streamChunk: async (url: string, range: { start: number; end: number }) => {
     const response = await fetch(url, {
       headers: {
@@ -93,11 +169,11 @@ export const music = {
   delete: async (id: number) => {
     await api.delete(`/music/${id}`);
   },
-  searchArtists: async (query: string) => {
-    const response = await api.get("/artists/search", {
+  searchArtists: async (query: string): Promise<Artist[]> => {
+    const response = await api.get<Page<Artist>>("/artists/search", {
       params: { query },
     });
-    return response.data;
+    return response.data.items;
   },
   createArtist: async (name: string) => {
     const response = await api.post("/artists", { name });
@@ -108,10 +184,10 @@ export const music = {
     return response.data;
   },
   search: async (query: string): Promise<Music[]> => {
-    const response = await api.get("/music/search", {
+    const response = await api.get<Page<Music>>("/music/search", {
       params: { q: query },
     });
-    return response.data;
+    return response.data.items;
   },
   downloadFromUrl: async (data: {
     url: string;
@@ -130,8 +206,7 @@ export const playlists = {
     return response.data;
   },
   getAll: async () => {
-    const response = await api.get("/playlists");
-    return response.data;
+    return fetchAllPages<Playlist>("/playlists");
   },
   getById: async (id: number) => {
     const response = await api.get(`/playlists/${id}`);
@@ -150,8 +225,7 @@ export const playlists = {
     await api.delete(`/playlists/${playlistId}/songs/${songId}`);
   },
   getSongs: async (playlistId: number) => {
-    const response = await api.get(`/playlists/${playlistId}/songs`);
-    return response.data;
+    return fetchAllPages<Music>(`/playlists/${playlistId}/songs`);
   },
 };
 
@@ -39,6 +39,20 @@ export interface Queue {
   items: QueueItem[];
 }
 
+// Auth types
+export interface AuthTokens {
+  token: string;
+  refresh_token: string;
+  expires_in: number;
+}
+
+// Pagination types
+export interface Page<T> {
+  items: T[];
+  next_cursor?: string;
+  has_more: boolean;
+}
+
 // Player domain types
 export interface PlayerTrack {
   id: number;